@@ -0,0 +1,32 @@
+package main
+
+import "time"
+
+// Number of recent history samples the volatility is computed over
+const adaptiveTTLSamples = 20
+
+// TTL for a new entry of the pair, scaled by how much its price has been
+// moving recently. Zero, i.e. the fixed CACHE_TTL, when adaptive TTLs are
+// disabled or there isn't enough history yet.
+func (s *Service) adaptiveTTL(pair string) time.Duration {
+	cfg := s.cfg()
+	if cfg.CacheTTLMin == 0 || cfg.CacheTTLMax == 0 {
+		return 0
+	}
+
+	volatility, ok := s.history.Volatility(pair, adaptiveTTLSamples)
+	if !ok {
+		return 0
+	}
+	return scaleTTL(volatility, cfg.CacheTTLMin, cfg.CacheTTLMax, cfg.AdaptiveTTLVolatility)
+}
+
+// Interpolate between max (a flat price) and min (volatility at or above
+// the reference), linearly in the volatility
+func scaleTTL(volatility float64, min, max time.Duration, reference float64) time.Duration {
+	if reference <= 0 || volatility >= reference {
+		return min
+	}
+	calm := 1 - volatility/reference
+	return min + time.Duration(calm*float64(max-min))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveTTL_ScalesWithVolatility(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CacheTTLMin = time.Second
+	cfg.CacheTTLMax = 30 * time.Second
+	cfg.AdaptiveTTLVolatility = 0.01
+	service := NewServiceWithConfig(cfg)
+
+	base := time.Now()
+	volatile := []float64{45000, 46500, 44200, 46800, 43900, 47000}
+	calm := []float64{45000, 45001, 45000, 45002, 45001, 45000}
+	for i := range volatile {
+		at := base.Add(time.Duration(i) * time.Second)
+		service.history.Record("BTC/USD", volatile[i], at)
+		service.history.Record("BTC/EUR", calm[i], at)
+	}
+
+	volatileTTL := service.adaptiveTTL("BTC/USD")
+	calmTTL := service.adaptiveTTL("BTC/EUR")
+
+	if volatileTTL >= calmTTL {
+		t.Errorf("Expected volatile TTL below calm TTL, got %v and %v", volatileTTL, calmTTL)
+	}
+	for _, ttl := range []time.Duration{volatileTTL, calmTTL} {
+		if ttl < cfg.CacheTTLMin || ttl > cfg.CacheTTLMax {
+			t.Errorf("Expected TTL within [%v, %v], got %v", cfg.CacheTTLMin, cfg.CacheTTLMax, ttl)
+		}
+	}
+	if volatileTTL != cfg.CacheTTLMin {
+		t.Errorf("Expected volatile TTL at the minimum, got %v", volatileTTL)
+	}
+}
+
+func TestAdaptiveTTL_FallsBackToFixedTTL(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CacheTTLMin = time.Second
+	cfg.CacheTTLMax = 30 * time.Second
+	service := NewServiceWithConfig(cfg)
+
+	service.history.Record("BTC/USD", 45000, time.Now())
+	if ttl := service.adaptiveTTL("BTC/USD"); ttl != 0 {
+		t.Errorf("Expected fixed TTL with too little history, got %v", ttl)
+	}
+
+	disabled := NewServiceWithConfig(DefaultConfig())
+	if ttl := disabled.adaptiveTTL("BTC/USD"); ttl != 0 {
+		t.Errorf("Expected fixed TTL when disabled, got %v", ttl)
+	}
+}
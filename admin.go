@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"time"
+)
+
+// Build the handler for management endpoints. These are only exposed on the
+// separate admin listener, never on the public API port.
+func (s *Service) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/cache", s.handleCacheAdmin)
+	mux.HandleFunc("/debug/inflight", s.handleInFlight)
+	mux.HandleFunc("/debug/errors", s.handleLastErrors)
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// Only backends that are scraped expose an endpoint
+	if scrape, ok := s.metrics.(http.Handler); ok {
+		mux.Handle("/metrics", scrape)
+	}
+
+	return loggingMiddleware(mux)
+}
+
+// Cache admin structures
+type CacheAdminResponse struct {
+	Entries []CacheAdminEntry `json:"entries"`
+}
+
+type CacheAdminEntry struct {
+	Pair       string    `json:"pair"`
+	Amount     Price     `json:"amount"`
+	AsOf       Timestamp `json:"as_of"`
+	AgeSeconds float64   `json:"age_seconds"`
+	Source     string    `json:"source,omitempty"`
+}
+
+// HTTP handler for /admin/cache: GET lists the cached entries, DELETE purges
+// a single pair (?pair=) or the whole cache
+func (s *Service) handleCacheAdmin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		entries := s.cache.Entries()
+
+		response := CacheAdminResponse{Entries: make([]CacheAdminEntry, 0, len(entries))}
+		for pair, entry := range entries {
+			response.Entries = append(response.Entries, CacheAdminEntry{
+				Pair:       pair,
+				Amount:     s.price(entry.ticker.Last),
+				AsOf:       Timestamp{Time: entry.asOf()},
+				AgeSeconds: time.Since(entry.timestamp).Seconds(),
+				Source:     entry.source,
+			})
+		}
+		sort.Slice(response.Entries, func(i, j int) bool {
+			return response.Entries[i].Pair < response.Entries[j].Pair
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Printf("Error encoding response: %v", err)
+		}
+
+	case http.MethodDelete:
+		if pair := r.URL.Query().Get("pair"); pair != "" {
+			s.cache.Delete(normalizePair(pair))
+		} else {
+			s.cache.Purge()
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdminListener_SeparateFromPublic(t *testing.T) {
+	service := NewService()
+	service.cache.data["BTC/USD"] = CacheEntry{ticker: Ticker{Last: 45000}, timestamp: time.Now()}
+
+	publicLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	adminLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- service.serve(ctx,
+			boundListener{name: "public", ln: publicLn, handler: service.routes()},
+			boundListener{name: "admin", ln: adminLn, handler: service.adminRoutes()},
+		)
+	}()
+	defer func() {
+		cancel()
+		if err := <-serveErr; err != nil {
+			t.Errorf("Expected clean shutdown, got %v", err)
+		}
+	}()
+
+	get := func(ln net.Listener, path string) int {
+		resp, err := http.Get("http://" + ln.Addr().String() + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for _, path := range []string{"/admin/cache", "/debug/pprof/"} {
+		if status := get(adminLn, path); status != http.StatusOK {
+			t.Errorf("Expected %s on admin listener to return 200, got %d", path, status)
+		}
+		if status := get(publicLn, path); status != http.StatusNotFound {
+			t.Errorf("Expected %s on public listener to return 404, got %d", path, status)
+		}
+	}
+
+	if status := get(publicLn, "/health"); status != http.StatusOK {
+		t.Errorf("Expected public API to keep serving, got %d", status)
+	}
+}
+
+func TestHandleCacheAdmin(t *testing.T) {
+	service := NewService()
+	service.cache.data["BTC/USD"] = CacheEntry{ticker: Ticker{Last: 45000}, timestamp: time.Now()}
+	service.cache.data["BTC/EUR"] = CacheEntry{ticker: Ticker{Last: 42000}, timestamp: time.Now()}
+
+	rec := httptest.NewRecorder()
+	service.handleCacheAdmin(rec, httptest.NewRequest("GET", "/admin/cache", nil))
+
+	var response CacheAdminResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Entries) != 2 || response.Entries[0].Pair != "BTC/EUR" {
+		t.Errorf("Expected two sorted entries, got %+v", response.Entries)
+	}
+
+	rec = httptest.NewRecorder()
+	service.handleCacheAdmin(rec, httptest.NewRequest("DELETE", "/admin/cache?pair=btc/usd", nil))
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rec.Code)
+	}
+	if entries := service.cache.Entries(); len(entries) != 1 {
+		t.Errorf("Expected BTC/USD to be purged, got %v", entries)
+	}
+}
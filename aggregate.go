@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+// Result of one provider call in an aggregate fetch
+type providerResult struct {
+	name   string
+	ticker Ticker
+	err    error
+}
+
+// Query all named providers concurrently and combine their prices. Every call
+// shares a context that's cancelled as soon as the caller's is, and the fetch
+// returns without waiting for calls that are still winding down.
+func (s *Service) aggregateFetch(ctx context.Context, pair string, names []string) (Ticker, error) {
+	tickers, err := s.fetchFromAll(ctx, pair, names)
+	if err != nil {
+		return Ticker{}, err
+	}
+	return s.combine(tickers), nil
+}
+
+// Query all named providers concurrently, returning the tickers of those
+// that succeeded, or the joined errors if none did
+func (s *Service) fetchFromAll(ctx context.Context, pair string, names []string) ([]Ticker, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no providers configured")
+	}
+
+	providers := make([]Provider, 0, len(names))
+	for _, name := range names {
+		provider, err := s.provider(name)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered so calls finishing after we've returned don't block
+	results := make(chan providerResult, len(providers))
+	for _, provider := range providers {
+		go func(provider Provider) {
+			release, err := s.acquireAggregateSlot(ctx)
+			if err != nil {
+				results <- providerResult{name: provider.Name(), err: err}
+				return
+			}
+			defer release()
+
+			ticker, err := s.callProvider(ctx, provider, pair)
+			results <- providerResult{name: provider.Name(), ticker: ticker, err: err}
+		}(provider)
+	}
+
+	var tickers []Ticker
+	var errs []error
+	for range providers {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case result := <-results:
+			if result.err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", result.name, result.err))
+				continue
+			}
+			tickers = append(tickers, result.ticker)
+		}
+	}
+
+	if len(tickers) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	return tickers, nil
+}
+
+// Combine the tickers of several providers per AGGREGATE_WEIGHTING
+func (s *Service) combine(tickers []Ticker) Ticker {
+	weighting := s.cfg().AggregateWeighting
+	if weighting == weightingMedian || weighting == "" {
+		return combineTickers(tickers)
+	}
+	return combineWeighted(tickers, s.aggregateWeights(tickers, weighting))
+}
+
+// Check a price from a single provider against the last price served for
+// the pair. One that moved by more than ANOMALY_THRESHOLD (a fraction) is
+// confirmed with the other configured providers and combined with their
+// prices, so a glitching provider is outvoted. Without a previous price or
+// any confirming provider, the price is served as it is.
+func (s *Service) confirmAnomaly(ctx context.Context, pair string, ticker Ticker) Ticker {
+	cfg := s.cfg()
+	previous, ok := s.cache.Peek(pair)
+	if cfg.AnomalyThreshold <= 0 || !ok || previous.ticker.Last <= 0 {
+		return ticker
+	}
+
+	deviation := math.Abs(ticker.Last-previous.ticker.Last) / previous.ticker.Last
+	if deviation <= cfg.AnomalyThreshold {
+		return ticker
+	}
+
+	var others []string
+	for _, name := range cfg.Providers {
+		if name != ticker.Provider {
+			others = append(others, name)
+		}
+	}
+	if len(others) == 0 {
+		return ticker
+	}
+
+	log.Printf("%s from %s deviates %.2f%% from the last price %v, confirming with %v",
+		pair, ticker.Provider, deviation*100, previous.ticker.Last, others)
+	confirmations, err := s.fetchFromAll(ctx, pair, others)
+	if err != nil {
+		log.Printf("Could not confirm %s, serving %s's price: %v", pair, ticker.Provider, err)
+		return ticker
+	}
+	return s.combine(append(confirmations, ticker))
+}
+
+// Ways of combining the prices of an aggregate fetch
+const (
+	weightingMedian  = "median"
+	weightingEqual   = "equal"
+	weightingVolume  = "volume"
+	weightingLatency = "latency"
+)
+
+// Floor for measured latencies, so a near-instant call can't take all the weight
+const minWeightLatency = time.Millisecond
+
+// Weight of each ticker in a weighted aggregate. Volume weighting falls back
+// to equal weights unless every ticker reports a volume; latency weighting
+// gives providers without a measurement the weight of the slowest one.
+func (s *Service) aggregateWeights(tickers []Ticker, weighting string) []float64 {
+	weights := make([]float64, len(tickers))
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	switch weighting {
+	case weightingVolume:
+		for _, ticker := range tickers {
+			if ticker.Volume24h <= 0 {
+				return weights
+			}
+		}
+		for i, ticker := range tickers {
+			weights[i] = ticker.Volume24h
+		}
+	case weightingLatency:
+		slowest := minWeightLatency
+		latencies := make([]time.Duration, len(tickers))
+		for i, ticker := range tickers {
+			if latency, ok := s.latencies.Latency(ticker.Provider); ok && latency != failedLatency {
+				latencies[i] = max(latency, minWeightLatency)
+				slowest = max(slowest, latencies[i])
+			}
+		}
+		for i, latency := range latencies {
+			if latency == 0 {
+				latency = slowest
+			}
+			weights[i] = 1 / latency.Seconds()
+		}
+	}
+	return weights
+}
+
+// Combine tickers from several providers into one whose last price is the
+// median. The other fields come from the ticker closest to the median.
+func combineTickers(tickers []Ticker) Ticker {
+	prices := make([]float64, len(tickers))
+	for i, ticker := range tickers {
+		prices[i] = ticker.Last
+	}
+	sort.Float64s(prices)
+
+	median := prices[len(prices)/2]
+	if len(prices)%2 == 0 {
+		median = (prices[len(prices)/2-1] + median) / 2
+	}
+	return combineAround(tickers, median)
+}
+
+// Combine tickers into one whose last price is the weighted mean of theirs
+func combineWeighted(tickers []Ticker, weights []float64) Ticker {
+	var sum, total float64
+	for i, ticker := range tickers {
+		sum += weights[i] * ticker.Last
+		total += weights[i]
+	}
+	return combineAround(tickers, sum/total)
+}
+
+// Build the combined ticker for price from the ticker closest to it, with
+// the sample count and dispersion of all of them
+func combineAround(tickers []Ticker, price float64) Ticker {
+	closest := tickers[0]
+	low, high := closest.Last, closest.Last
+	for _, ticker := range tickers[1:] {
+		if math.Abs(ticker.Last-price) < math.Abs(closest.Last-price) {
+			closest = ticker
+		}
+		low, high = min(low, ticker.Last), max(high, ticker.Last)
+	}
+
+	closest.Last = price
+	closest.SampleCount = len(tickers)
+	closest.Dispersion = high - low
+	if len(tickers) > 1 {
+		closest.Provider = providerAggregate
+	}
+	return closest
+}
+
+// Wait for a slot in the semaphore bounding concurrent aggregate calls
+// across all pairs and providers. Without a limit it returns immediately.
+func (s *Service) acquireAggregateSlot(ctx context.Context) (func(), error) {
+	if s.aggregateSlots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case s.aggregateSlots <- struct{}{}:
+		return func() { <-s.aggregateSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAggregateFetch_Median(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"a", "b", "c", "down"}
+	cfg.ProviderMode = providerModeAggregate
+	service := serviceWithProviders(cfg,
+		&stubProvider{name: "a", price: 100},
+		&stubProvider{name: "b", price: 103},
+		&stubProvider{name: "c", price: 101},
+		&stubProvider{name: "down", err: errors.New("down")},
+	)
+
+	ticker, err := service.fetchTicker(context.Background(), "BTC/USD")
+	if err != nil {
+		t.Fatalf("fetchTicker failed: %v", err)
+	}
+
+	if ticker.Last != 101 {
+		t.Errorf("Expected median 101, got %v", ticker.Last)
+	}
+}
+
+func TestAggregateWeights_Latency(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AggregateWeighting = weightingLatency
+	service := NewServiceWithConfig(cfg)
+	service.latencies.Record("fast", 10*time.Millisecond)
+	service.latencies.Record("slow", 40*time.Millisecond)
+
+	tickers := []Ticker{{Provider: "fast", Last: 100}, {Provider: "slow", Last: 110}}
+	weights := service.aggregateWeights(tickers, weightingLatency)
+	if weights[0] <= weights[1] {
+		t.Errorf("Expected the faster provider to weigh more, got %v", weights)
+	}
+
+	ticker := combineWeighted(tickers, weights)
+	if ticker.Last != 102 {
+		t.Errorf("Expected weighted price 102, got %v", ticker.Last)
+	}
+	if ticker.SampleCount != 2 || ticker.Dispersion != 10 {
+		t.Errorf("Expected 2 samples with dispersion 10, got %d and %v", ticker.SampleCount, ticker.Dispersion)
+	}
+}
+
+func TestAggregateWeights_VolumeFallsBackToEqual(t *testing.T) {
+	service := NewServiceWithConfig(DefaultConfig())
+
+	tickers := []Ticker{{Last: 100, Volume24h: 30}, {Last: 110}}
+	weights := service.aggregateWeights(tickers, weightingVolume)
+	if weights[0] != weights[1] {
+		t.Errorf("Expected equal weights without every volume, got %v", weights)
+	}
+
+	tickers[1].Volume24h = 10
+	ticker := combineWeighted(tickers, service.aggregateWeights(tickers, weightingVolume))
+	if ticker.Last != 102.5 {
+		t.Errorf("Expected volume-weighted price 102.5, got %v", ticker.Last)
+	}
+}
+
+func TestConfirmAnomaly(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"primary", "b", "c"}
+	cfg.AnomalyThreshold = 0.05
+	primary := &stubProvider{name: "primary", price: 45050}
+	b := &stubProvider{name: "b", price: 45100}
+	c := &stubProvider{name: "c", price: 44900}
+	service := serviceWithProviders(cfg, primary, b, c)
+	service.cache.data["BTC/USD"] = CacheEntry{ticker: Ticker{Last: 45000}, timestamp: time.Now().Add(-time.Hour)}
+
+	// A move within the threshold is served from the primary alone
+	ticker, err := service.fetchTicker(context.Background(), "BTC/USD")
+	if err != nil {
+		t.Fatalf("fetchTicker failed: %v", err)
+	}
+	if ticker.Last != 45050 || b.callCount() != 0 || c.callCount() != 0 {
+		t.Errorf("Expected 45050 without confirmation, got %v after %d and %d calls", ticker.Last, b.callCount(), c.callCount())
+	}
+
+	// An anomalous price is confirmed and outvoted
+	primary.price = 50000
+	ticker, err = service.fetchTicker(context.Background(), "BTC/USD")
+	if err != nil {
+		t.Fatalf("fetchTicker failed: %v", err)
+	}
+	if b.callCount() != 1 || c.callCount() != 1 {
+		t.Errorf("Expected one confirming call per provider, got %d and %d", b.callCount(), c.callCount())
+	}
+	if ticker.Last != 45100 {
+		t.Errorf("Expected the reconciled median 45100, got %v", ticker.Last)
+	}
+	if ticker.Provider != providerAggregate || ticker.SampleCount != 3 {
+		t.Errorf("Expected an aggregate of 3 samples, got %s with %d", ticker.Provider, ticker.SampleCount)
+	}
+}
+
+func TestAggregateFetch_AllFail(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"a", "b"}
+	cfg.ProviderMode = providerModeAggregate
+	service := serviceWithProviders(cfg,
+		&stubProvider{name: "a", err: ErrUpstreamRateLimited},
+		&stubProvider{name: "b", err: errors.New("down")},
+	)
+
+	_, err := service.fetchTicker(context.Background(), "BTC/USD")
+	if !errors.Is(err, ErrUpstreamRateLimited) {
+		t.Errorf("Expected joined provider errors, got %v", err)
+	}
+}
+
+func TestAggregateFetch_Cancellation(t *testing.T) {
+	providers := []*hangingProvider{{name: "a"}, {name: "b"}, {name: "c"}}
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"a", "b", "c"}
+	cfg.ProviderMode = providerModeAggregate
+	service := NewServiceWithConfig(cfg)
+	service.providers = make(map[string]Provider)
+	for _, p := range providers {
+		service.providers[p.name] = p
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := service.fetchTicker(ctx, "BTC/USD")
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if elapsed > 200*time.Millisecond {
+		t.Errorf("Expected a prompt return on cancellation, took %v", elapsed)
+	}
+
+	// Every provider call observes the cancellation
+	deadline := time.Now().Add(time.Second)
+	for _, p := range providers {
+		for {
+			p.mu.Lock()
+			observed := len(p.ctxErrs) == 1 && errors.Is(p.ctxErrs[0], context.Canceled)
+			p.mu.Unlock()
+
+			if observed {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Provider %s never observed the cancellation", p.name)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func TestHandleLTP_IncludeConfidence(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"a", "b", "c"}
+	cfg.ProviderMode = providerModeAggregate
+	service := serviceWithProviders(cfg,
+		&stubProvider{name: "a", price: 100},
+		&stubProvider{name: "b", price: 104},
+		&stubProvider{name: "c", price: 101},
+	)
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&include=confidence", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	ltp := response.LTP[0]
+	if ltp.SampleCount == nil || *ltp.SampleCount != 3 {
+		t.Errorf("Expected sample_count 3, got %v", ltp.SampleCount)
+	}
+	if ltp.Dispersion == nil || ltp.Dispersion.Value != 4 {
+		t.Errorf("Expected dispersion 4, got %v", ltp.Dispersion)
+	}
+}
+
+func TestSetConfidence_SingleSample(t *testing.T) {
+	var ltp PairLTP
+	ltp.setConfidence(Ticker{Last: 100})
+
+	if *ltp.SampleCount != 1 || ltp.Dispersion.Value != 0 {
+		t.Errorf("Expected 1 sample with no dispersion, got %d and %v", *ltp.SampleCount, ltp.Dispersion.Value)
+	}
+}
+
+// Provider that tracks how many of its calls, across all instances sharing
+// the counters, are in flight at once
+type countingProvider struct {
+	name     string
+	inFlight *atomic.Int32
+	peak     *atomic.Int32
+}
+
+func (p *countingProvider) Name() string {
+	return p.name
+}
+
+func (p *countingProvider) FetchTicker(ctx context.Context, pair string) (Ticker, error) {
+	current := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+
+	for {
+		peak := p.peak.Load()
+		if current <= peak || p.peak.CompareAndSwap(peak, current) {
+			break
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	return Ticker{Last: 100}, nil
+}
+
+func TestAggregateFetch_ConcurrencyCap(t *testing.T) {
+	var inFlight, peak atomic.Int32
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"a", "b", "c", "d"}
+	cfg.ProviderMode = providerModeAggregate
+	cfg.AggregateConcurrency = 3
+	service := NewServiceWithConfig(cfg)
+	service.providers = make(map[string]Provider)
+	for _, name := range cfg.Providers {
+		service.providers[name] = &countingProvider{name: name, inFlight: &inFlight, peak: &peak}
+	}
+
+	// Several pairs aggregated at once: 12 upstream calls in total
+	var wg sync.WaitGroup
+	for _, pair := range []string{"BTC/USD", "BTC/EUR", "BTC/CHF"} {
+		wg.Add(1)
+		go func(pair string) {
+			defer wg.Done()
+			if _, err := service.fetchTicker(context.Background(), pair); err != nil {
+				t.Errorf("fetchTicker %s failed: %v", pair, err)
+			}
+		}(pair)
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > 3 {
+		t.Errorf("Expected at most 3 concurrent upstream calls, got %d", got)
+	}
+	if got := peak.Load(); got < 2 {
+		t.Errorf("Expected calls to run concurrently up to the cap, got peak %d", got)
+	}
+}
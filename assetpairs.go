@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// Display decimals per quote currency, used for pairs Kraken's AssetPairs
+// metadata didn't cover
+var defaultQuoteDecimals = map[string]int{
+	"USD": 1,
+	"EUR": 1,
+	"CHF": 1,
+}
+
+// Kraken AssetPairs response, reduced to the fields we use
+type krakenAssetPairsResponse struct {
+	Error  []string                   `json:"error"`
+	Result map[string]krakenAssetPair `json:"result"`
+}
+
+type krakenAssetPair struct {
+	PairDecimals int `json:"pair_decimals"`
+}
+
+// Fetch the display decimals of every supported pair from Kraken's
+// AssetPairs endpoint, keyed by our pair names
+func (s *Service) fetchPairDecimals(ctx context.Context) (map[string]int, error) {
+	krakenPairs := make([]string, 0, len(supportedPairs))
+	for _, pair := range supportedPairs {
+		krakenPairs = append(krakenPairs, getKrakenPair(pair))
+	}
+
+	url := fmt.Sprintf("%s/0/public/AssetPairs?pair=%s", s.krakenURL(), strings.Join(krakenPairs, ","))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.krakenClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch asset pairs from Kraken: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var assetPairs krakenAssetPairsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&assetPairs); err != nil {
+		return nil, fmt.Errorf("failed to parse asset pairs: %w", err)
+	}
+	if krakenErrs := krakenErrorsOnly(assetPairs.Error); len(krakenErrs) > 0 {
+		return nil, fmt.Errorf("Kraken API error: %v", krakenErrs)
+	}
+
+	decimals := make(map[string]int)
+	for _, pair := range supportedPairs {
+		if info, ok := assetPairs.Result[getKrakenPair(pair)]; ok && info.PairDecimals >= 0 {
+			decimals[pair] = info.PairDecimals
+		}
+	}
+	return decimals, nil
+}
+
+// Learn the pairs' display decimals at startup. If Kraken can't be reached
+// the per-currency defaults are used instead.
+func (s *Service) loadPairDecimals(ctx context.Context) {
+	decimals, err := s.fetchPairDecimals(ctx)
+	if err != nil {
+		log.Printf("Could not load pair decimals, using defaults: %v", err)
+		decimals = map[string]int{}
+	} else {
+		log.Printf("Loaded decimals for %d pairs from Kraken", len(decimals))
+	}
+
+	s.decimalsMu.Lock()
+	s.pairDecimals = decimals
+	s.decimalsMu.Unlock()
+}
+
+// Decimals to round the pair's prices to; false when rounding is disabled
+func (s *Service) decimalsFor(pair string) (int, bool) {
+	s.decimalsMu.RLock()
+	defer s.decimalsMu.RUnlock()
+
+	if s.pairDecimals == nil {
+		return 0, false
+	}
+	if decimals, ok := s.pairDecimals[pair]; ok {
+		return decimals, true
+	}
+	_, quote, _ := splitPair(pair)
+	decimals, ok := defaultQuoteDecimals[quote]
+	return decimals, ok
+}
+
+// Copy of the ticker with its prices rounded to the given decimals. The raw
+// upstream data is left untouched.
+func (t Ticker) rounded(decimals int) Ticker {
+	scale := math.Pow10(decimals)
+	round := func(v float64) float64 {
+		return math.Round(v*scale) / scale
+	}
+
+	t.Last = round(t.Last)
+	t.Bid = round(t.Bid)
+	t.Ask = round(t.Ask)
+	t.VWAPToday = round(t.VWAPToday)
+	t.VWAP24h = round(t.VWAP24h)
+	return t
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Mock Kraken server with a BTC/USD ticker and, unless failing, AssetPairs
+// metadata giving it two decimals
+func assetPairsKrakenServer(assetPairsFail bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/0/public/AssetPairs":
+			if assetPairsFail {
+				w.Write([]byte(`{"error":["EGeneral:Internal error"]}`))
+				return
+			}
+			w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"altname":"XBTUSD","pair_decimals":2}}}`))
+		default:
+			w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["45000.567","0.5"]}}}`))
+		}
+	}))
+}
+
+func fetchRoundedAmount(t *testing.T, service *Service) float64 {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.LTP) != 1 {
+		t.Fatalf("Expected 1 pair, got %+v", response.LTP)
+	}
+	return response.LTP[0].Amount.Value
+}
+
+func TestPairDecimals_LearnedFromAssetPairs(t *testing.T) {
+	mockServer := assetPairsKrakenServer(false)
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	if amount := fetchRoundedAmount(t, service); amount != 45000.567 {
+		t.Errorf("Expected unrounded 45000.567 before loading decimals, got %v", amount)
+	}
+
+	service.loadPairDecimals(context.Background())
+	service.cache.Purge()
+
+	if amount := fetchRoundedAmount(t, service); amount != 45000.57 {
+		t.Errorf("Expected 45000.57 with the learned 2 decimals, got %v", amount)
+	}
+}
+
+func TestPairDecimals_FallBackToDefaults(t *testing.T) {
+	mockServer := assetPairsKrakenServer(true)
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+	service.loadPairDecimals(context.Background())
+
+	if amount := fetchRoundedAmount(t, service); amount != 45000.6 {
+		t.Errorf("Expected 45000.6 with the default USD decimals, got %v", amount)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+// Refresh the pairs with one batched Kraken call instead of one call per
+// pair. The call goes through the same health, timeout and metrics path as
+// single fetches, and unpinned prices are checked for anomalies like theirs.
+// Kraken sometimes leaves pairs out of a batch response; with
+// BATCH_BACKFILL those are retried one by one through the normal provider
+// routing, otherwise they're reported as failed. Pairs pinned to another
+// provider never join the batch.
+func (s *Service) refreshBatch(ctx context.Context, pairs []string) {
+	cfg := s.cfg()
+
+	var batched, individual []string
+	krakenPairs := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		krakenPair := getKrakenPair(pair)
+		if pin, pinned := cfg.ProviderPins[pair]; krakenPair == "" || (pinned && pin != providerKraken) {
+			individual = append(individual, pair)
+			continue
+		}
+		batched = append(batched, pair)
+		krakenPairs = append(krakenPairs, krakenPair)
+	}
+
+	var result map[string]KrakenTickData
+	if len(krakenPairs) > 0 {
+		err := s.instrumentProvider(ctx, providerKraken, func(ctx context.Context) error {
+			var err error
+			result, err = s.fetchKrakenTickData(ctx, krakenPairs)
+			return err
+		})
+		if err != nil {
+			log.Printf("Batch refresh of %d pairs failed: %v", len(batched), err)
+			individual = append(individual, batched...)
+			batched = nil
+		}
+	}
+
+	for _, pair := range batched {
+		tickData, exists := result[getKrakenPair(pair)]
+		if !exists {
+			if cfg.BatchBackfill {
+				individual = append(individual, pair)
+			} else {
+				log.Printf("Error refreshing %s: missing from batch response", pair)
+			}
+			continue
+		}
+
+		err := s.cache.Refresh(pair, func() (Ticker, error) {
+			ticker, err := s.parseKrakenTicker(pair, tickData)
+			if err == nil {
+				ticker.Provider = providerKraken
+				if _, pinned := cfg.ProviderPins[pair]; !pinned {
+					ticker = s.confirmAnomaly(ctx, pair, ticker)
+				}
+			}
+			return s.recordFetch(pair, ticker, err)
+		})
+		if err != nil {
+			log.Printf("Error refreshing %s: %v", pair, err)
+		}
+	}
+
+	for _, pair := range individual {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.refreshPair(ctx, pair); err != nil {
+			log.Printf("Error refreshing %s: %v", pair, err)
+		}
+	}
+}
+
+// Refresh a single pair through the normal provider routing
+func (s *Service) refreshPair(ctx context.Context, pair string) error {
+	return s.cache.Refresh(pair, func() (Ticker, error) {
+		return s.fetchTicker(ctx, pair)
+	})
+}
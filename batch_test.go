@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Mock Kraken host whose batch responses leave out BTC/EUR; single-pair
+// requests are answered in full
+func partialBatchKrakenServer(batchCalls, singleCalls *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pair := r.URL.Query().Get("pair")
+		if strings.Contains(pair, ",") {
+			batchCalls.Add(1)
+			w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["45000.00","0.5"]}}}`))
+			return
+		}
+
+		singleCalls.Add(1)
+		switch pair {
+		case "XXBTZUSD":
+			w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["45000.00","0.5"]}}}`))
+		case "XXBTZEUR":
+			w.Write([]byte(`{"error":[],"result":{"XXBTZEUR":{"c":["42000.00","0.4"]}}}`))
+		default:
+			w.Write([]byte(`{"error":["Unknown pair"],"result":{}}`))
+		}
+	}))
+}
+
+func batchService(url string, backfill bool) *Service {
+	cfg := DefaultConfig()
+	cfg.KrakenHosts = []string{url}
+	cfg.WarmPairs = []string{"BTC/USD", "BTC/EUR"}
+	cfg.RefreshBatch = true
+	cfg.BatchBackfill = backfill
+	return NewServiceWithConfig(cfg)
+}
+
+func TestRefreshBatch_BackfillsOmittedPairs(t *testing.T) {
+	var batchCalls, singleCalls atomic.Int32
+	server := partialBatchKrakenServer(&batchCalls, &singleCalls)
+	defer server.Close()
+
+	service := batchService(server.URL, true)
+	service.refreshOnce(context.Background())
+
+	if batchCalls.Load() != 1 {
+		t.Errorf("Expected 1 batch call, got %d", batchCalls.Load())
+	}
+	if singleCalls.Load() != 1 {
+		t.Errorf("Expected 1 backfill call, got %d", singleCalls.Load())
+	}
+
+	usd, ok := service.cache.Peek("BTC/USD")
+	if !ok || usd.ticker.Last != 45000.00 {
+		t.Errorf("Expected BTC/USD cached at 45000.00, got %v (cached %v)", usd.ticker.Last, ok)
+	}
+	eur, ok := service.cache.Peek("BTC/EUR")
+	if !ok || eur.ticker.Last != 42000.00 {
+		t.Errorf("Expected BTC/EUR backfilled at 42000.00, got %v (cached %v)", eur.ticker.Last, ok)
+	}
+}
+
+func TestRefreshBatch_WithoutBackfillLeavesOmittedPairs(t *testing.T) {
+	var batchCalls, singleCalls atomic.Int32
+	server := partialBatchKrakenServer(&batchCalls, &singleCalls)
+	defer server.Close()
+
+	service := batchService(server.URL, false)
+	service.refreshOnce(context.Background())
+
+	if singleCalls.Load() != 0 {
+		t.Errorf("Expected no backfill calls, got %d", singleCalls.Load())
+	}
+	if _, ok := service.cache.Peek("BTC/USD"); !ok {
+		t.Error("Expected BTC/USD to be cached from the batch")
+	}
+	if _, ok := service.cache.Peek("BTC/EUR"); ok {
+		t.Error("Expected BTC/EUR to stay uncached without backfill")
+	}
+}
+
+func TestRefreshBatch_FallsBackToSinglePairsOnFailure(t *testing.T) {
+	var singleCalls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Query().Get("pair"), ",") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		singleCalls.Add(1)
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["45000.00","0.5"]},"XXBTZEUR":{"c":["42000.00","0.4"]}}}`))
+	}))
+	defer server.Close()
+
+	service := batchService(server.URL, false)
+	service.refreshOnce(context.Background())
+
+	if singleCalls.Load() != 2 {
+		t.Errorf("Expected 2 single-pair calls after batch failure, got %d", singleCalls.Load())
+	}
+	if _, ok := service.cache.Peek("BTC/EUR"); !ok {
+		t.Error("Expected BTC/EUR to be cached after falling back")
+	}
+}
+
+func TestRefreshBatch_GoesThroughProviderPath(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.KrakenHosts = []string{server.URL}
+	cfg.WarmPairs = []string{"BTC/USD", "BTC/EUR"}
+	cfg.RefreshBatch = true
+	cfg.ProviderFailureThreshold = 1
+	cfg.ProviderCooldown = time.Minute
+	service := NewServiceWithConfig(cfg)
+	metrics := &recordingMetrics{}
+	service.metrics = metrics
+
+	// The failed batch trips Kraken's circuit, so neither the single-pair
+	// fallback nor the next refresh reaches it
+	service.refreshOnce(context.Background())
+	service.refreshOnce(context.Background())
+	if calls.Load() != 1 {
+		t.Errorf("Expected only the first batch call to reach Kraken, got %d calls", calls.Load())
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if !slices.Contains(metrics.counters, `upstream_requests_total{provider="kraken",result="upstream"}`) {
+		t.Errorf("Expected the batch call in upstream_requests_total, got %v", metrics.counters)
+	}
+	if !slices.Contains(metrics.observed, `upstream_request_duration_seconds{provider="kraken"}`) {
+		t.Errorf("Expected the batch call in upstream_request_duration_seconds, got %v", metrics.observed)
+	}
+}
+
+func TestRefreshBatch_ConfirmsAnomalies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["90000.00","0.5"]}}}`))
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.KrakenHosts = []string{server.URL}
+	cfg.WarmPairs = []string{"BTC/USD"}
+	cfg.RefreshBatch = true
+	cfg.Providers = []string{providerKraken, "stub"}
+	cfg.AnomalyThreshold = 0.05
+	service := NewServiceWithConfig(cfg)
+	confirming := &stubProvider{name: "stub", price: 45000}
+	service.providers["stub"] = confirming
+	service.cache.data["BTC/USD"] = CacheEntry{ticker: Ticker{Last: 45000}, timestamp: time.Now().Add(-time.Hour)}
+
+	service.refreshOnce(context.Background())
+
+	if confirming.callCount() != 1 {
+		t.Errorf("Expected the jump to be confirmed with the other provider, got %d calls", confirming.callCount())
+	}
+	if entry, _ := service.cache.Peek("BTC/USD"); entry.ticker.Last == 90000 {
+		t.Error("Expected the unconfirmed price not to be served as it is")
+	}
+}
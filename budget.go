@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Outcome of collecting one pair within a budget
+type pairOutcome struct {
+	index  int
+	ltps   []PairLTP
+	errors []PairError
+}
+
+// Collect the pairs like collectLTP, but concurrently and only until the
+// budget has elapsed, so one slow pair can't use up the budget of the
+// others. Pairs collected by then are returned as they are; the rest fall
+// back to their cached entry, served as stale whatever its age, or are
+// reported with ErrResponseBudgetExceeded. Fetches still running are
+// cancelled.
+func (s *Service) collectWithinBudget(ctx context.Context, pairs []string, include IncludeOptions, budget time.Duration) ([]PairLTP, []PairError) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered so collectors never block once we've stopped listening
+	outcomes := make(chan pairOutcome, len(pairs))
+	for i, pair := range pairs {
+		go func() {
+			ltps, errs := s.collectLTP(ctx, []string{pair}, include)
+			outcomes <- pairOutcome{index: i, ltps: ltps, errors: errs}
+		}()
+	}
+
+	timer := time.NewTimer(budget)
+	defer timer.Stop()
+
+	collected := make([]*pairOutcome, len(pairs))
+wait:
+	for received := 0; received < len(pairs); received++ {
+		select {
+		case outcome := <-outcomes:
+			collected[outcome.index] = &outcome
+		case <-timer.C:
+			break wait
+		}
+	}
+
+	var result []PairLTP
+	var pairErrs []PairError
+	for i, pair := range pairs {
+		if outcome := collected[i]; outcome != nil {
+			result = append(result, outcome.ltps...)
+			pairErrs = append(pairErrs, outcome.errors...)
+			continue
+		}
+
+		pair = normalizePair(pair)
+		// The cache can't stand in for a forced provider
+		if entry, ok := s.cache.Peek(pair); ok && providerOverride(ctx) == "" {
+			result = append(result, s.pairLTP(pair, entry, cacheStale, include))
+			continue
+		}
+		err := fmt.Errorf("%w after %v: %s", ErrResponseBudgetExceeded, budget, pair)
+		pairErrs = append(pairErrs, PairError{Pair: pair, Message: err.Error(), err: err})
+	}
+	return result, pairErrs
+}
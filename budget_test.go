@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Provider answering instantly except for one pair, which hangs until the
+// request is cancelled
+type slowPairProvider struct {
+	slowPair string
+}
+
+func (p *slowPairProvider) Name() string {
+	return "slow"
+}
+
+func (p *slowPairProvider) FetchTicker(ctx context.Context, pair string) (Ticker, error) {
+	if pair == p.slowPair {
+		<-ctx.Done()
+		return Ticker{}, ctx.Err()
+	}
+	return Ticker{Last: 45000}, nil
+}
+
+func TestHandleLTP_ResponseBudget(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"slow"}
+	cfg.ResponseBudget = 100 * time.Millisecond
+	service := NewServiceWithConfig(cfg)
+	service.providers = map[string]Provider{"slow": &slowPairProvider{slowPair: "BTC/EUR"}}
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pairs=BTC/USD,BTC/EUR&include_errors=true", nil)
+	rec := httptest.NewRecorder()
+
+	start := time.Now()
+	service.handleLTP(rec, req)
+	elapsed := time.Since(start)
+
+	if elapsed > time.Second {
+		t.Errorf("Expected the response within the budget, took %v", elapsed)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.LTP) != 1 || response.LTP[0].Pair != "BTC/USD" {
+		t.Errorf("Expected BTC/USD, got %+v", response.LTP)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].Pair != "BTC/EUR" {
+		t.Errorf("Expected a budget error for BTC/EUR, got %+v", response.Errors)
+	}
+}
+
+func TestCollectWithinBudget_FallsBackToCache(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"slow"}
+	service := NewServiceWithConfig(cfg)
+	service.providers = map[string]Provider{"slow": &slowPairProvider{slowPair: "BTC/EUR"}}
+
+	// An expired price is better than nothing once the budget runs out
+	service.cache.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	service.cache.GetOrFetch("BTC/EUR", func() (float64, error) { return 42000, nil })
+	service.cache.now = nil
+
+	ltps, pairErrs := service.collectWithinBudget(context.Background(), []string{"BTC/USD", "BTC/EUR"}, IncludeOptions{}, 50*time.Millisecond)
+
+	if len(pairErrs) != 0 {
+		t.Errorf("Expected no errors, got %+v", pairErrs)
+	}
+	if len(ltps) != 2 || ltps[1].Pair != "BTC/EUR" || !ltps[1].Stale || ltps[1].Amount.Value != 42000 {
+		t.Errorf("Expected BTC/USD fresh and BTC/EUR stale from the cache, got %+v", ltps)
+	}
+
+	// Without a cached entry the pair is reported
+	service.cache.Purge()
+	_, pairErrs = service.collectWithinBudget(context.Background(), []string{"BTC/EUR"}, IncludeOptions{}, 50*time.Millisecond)
+	if len(pairErrs) != 1 || !errors.Is(pairErrs[0].err, ErrResponseBudgetExceeded) {
+		t.Errorf("Expected ErrResponseBudgetExceeded, got %+v", pairErrs)
+	}
+}
+
+func TestCollectWithinBudget_SlowPairDoesNotDelayOthers(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"slow"}
+	service := NewServiceWithConfig(cfg)
+	service.providers = map[string]Provider{"slow": &slowPairProvider{slowPair: "BTC/USD"}}
+
+	// The slow pair comes first, yet the pairs after it are still fetched
+	ltps, pairErrs := service.collectWithinBudget(context.Background(), []string{"BTC/USD", "BTC/EUR", "BTC/CHF"}, IncludeOptions{}, 50*time.Millisecond)
+
+	if len(ltps) != 2 || ltps[0].Pair != "BTC/EUR" || ltps[1].Pair != "BTC/CHF" || ltps[0].Stale {
+		t.Errorf("Expected BTC/EUR and BTC/CHF fresh, got %+v", ltps)
+	}
+	if len(pairErrs) != 1 || pairErrs[0].Pair != "BTC/USD" || !errors.Is(pairErrs[0].err, ErrResponseBudgetExceeded) {
+		t.Errorf("Expected a budget error for BTC/USD only, got %+v", pairErrs)
+	}
+}
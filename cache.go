@@ -0,0 +1,526 @@
+package main
+
+import (
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sources for cache entries that didn't come from a live fetch
+const sourceSnapshot = "snapshot"
+
+// How a lookup was answered, as reported in X-Cache-Status
+const (
+	cacheHit   = "hit"   // Fresh entry from the cache
+	cacheMiss  = "miss"  // Fetched from upstream
+	cacheStale = "stale" // Last-known-good entry served instead of a fetch
+)
+
+// Cache structure for rate limiting protection
+type Cache struct {
+	mu   sync.Mutex
+	data map[string]CacheEntry
+	ttl  time.Duration
+
+	// Optional per-pair TTL for new entries, e.g. adaptive to volatility
+	ttlFunc func(pair string) time.Duration
+
+	// EWMA weight of a new fetch against the previous cached price; zero
+	// stores fetched prices as they are
+	smoothing float64
+
+	// Largest price change still treated as no change, keeping the entry's
+	// as_of; zero treats every fetch as a change
+	epsilon float64
+
+	// How long past its timestamp an entry may still be served when a
+	// refetch fails; zero serves only snapshot entries
+	staleIfError time.Duration
+
+	// Sources lookups are answered from, in order; nil means the default
+	fallbackOrder []string
+
+	// How long a miss waits for its fetch before answering with the expired
+	// entry and letting the fetch finish in the background; zero always waits
+	softTimeout time.Duration
+
+	// Age past which an expired entry is no longer served while it's
+	// refreshed in the background; zero means no limit
+	syncRefreshAge time.Duration
+
+	// Serializes fetches per pair so concurrent misses share one upstream call
+	fetching keyedMutex
+
+	// Background fetches started by soft-timeout lookups, per pair
+	pending map[string]*pendingFetch
+
+	// Start time of every upstream fetch currently running, per pair
+	inFlight map[string]time.Time
+
+	hits   atomic.Int64
+	misses atomic.Int64
+
+	// Called with the age of every entry served as a hit; nil ignores them
+	onHit func(pair string, age time.Duration)
+
+	// Clock used for entry timestamps and TTL checks; nil means time.Now
+	now func() time.Time
+
+	// How far in the future an entry's timestamp may be, after the clock
+	// jumped backwards, before it's re-anchored to now; beyond maxSkew the
+	// timestamp is implausible and the entry is treated as expired instead
+	skewTolerance time.Duration
+	maxSkew       time.Duration
+}
+
+// A fetch running in the background; done is closed once entry/err are set
+type pendingFetch struct {
+	done  chan struct{}
+	entry CacheEntry
+	err   error
+}
+
+type CacheEntry struct {
+	ticker    Ticker
+	timestamp time.Time
+	source    string        // Empty for live data
+	ttl       time.Duration // Overrides the cache-wide TTL when set
+
+	// When the price last moved by more than the cache's epsilon; zero
+	// means it moved with this fetch
+	changedAt time.Time
+}
+
+// When the entry's price was last seen to move, reported as as_of. A refetch
+// within epsilon of the previous price keeps the earlier time.
+func (e CacheEntry) asOf() time.Time {
+	if !e.changedAt.IsZero() {
+		return e.changedAt
+	}
+	return e.timestamp
+}
+
+// NewCache creates an empty cache with the given TTL
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		data: make(map[string]CacheEntry),
+		ttl:  ttl,
+	}
+}
+
+// Now returns the current time according to the cache's clock
+func (c *Cache) Now() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+// Get cached value or fetch new one
+func (c *Cache) GetOrFetch(pair string, fetcher func() (float64, error)) (float64, error) {
+	entry, _, err := c.GetOrFetchEntry(pair, func() (Ticker, error) {
+		value, err := fetcher()
+		return Ticker{Last: value}, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return entry.ticker.Last, nil
+}
+
+// Get cached entry or fetch new one, reporting how the lookup was answered.
+// The sources are tried in the cache's fallback order; by default a fresh
+// entry, then a fetch, then a last-known-good entry within the
+// stale-if-error window, then a snapshot-loaded one, the latter two as stale.
+func (c *Cache) GetOrFetchEntry(pair string, fetcher func() (Ticker, error)) (CacheEntry, string, error) {
+	return c.resolve(pair, fetcher)
+}
+
+// Fetch the pair from upstream and store it. With reuseFresh, a fresh entry
+// found once the pair's lock is held is returned as a hit; otherwise only
+// one fetched by another caller meanwhile is. With slowStale and a soft
+// timeout, a slow fetch is answered with the expired entry.
+func (c *Cache) fetchLive(pair string, reuseFresh, slowStale bool, fetcher func() (Ticker, error)) (CacheEntry, string, error) {
+	requested := c.Now()
+
+	c.mu.Lock()
+	expired, exists := c.data[pair]
+	softTimeout := c.softTimeout
+	c.mu.Unlock()
+	if slowStale && softTimeout > 0 && exists && c.refreshableAsync(expired) {
+		return c.getWithSoftTimeout(pair, expired, softTimeout, fetcher)
+	}
+
+	unlock := c.fetching.Lock(pair)
+	defer unlock()
+
+	// Another caller may have fetched the pair while we waited for the lock
+	if entry, ok := c.fresh(pair); ok && (reuseFresh || entry.timestamp.After(requested)) {
+		c.recordHit(pair, entry)
+		return entry, cacheHit, nil
+	}
+	c.misses.Add(1)
+
+	entry, err := c.store(pair, fetcher)
+	if err != nil {
+		return CacheEntry{}, cacheMiss, err
+	}
+	return entry, cacheMiss, nil
+}
+
+// Wait up to softTimeout for the pair's fetch. If it takes longer, answer
+// with the expired entry right away; the fetch keeps running and warms the
+// cache when it completes. Concurrent lookups share the one fetch.
+func (c *Cache) getWithSoftTimeout(pair string, expired CacheEntry, softTimeout time.Duration, fetcher func() (Ticker, error)) (CacheEntry, string, error) {
+	c.misses.Add(1)
+	fetch := c.startFetch(pair, fetcher)
+
+	timer := time.NewTimer(softTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-fetch.done:
+		if fetch.err != nil {
+			return CacheEntry{}, cacheMiss, fetch.err
+		}
+		return fetch.entry, cacheMiss, nil
+	case <-timer.C:
+		return expired, cacheStale, nil
+	}
+}
+
+// Start fetching the pair in the background, or join the fetch already
+// running for it
+func (c *Cache) startFetch(pair string, fetcher func() (Ticker, error)) *pendingFetch {
+	c.mu.Lock()
+	if fetch, running := c.pending[pair]; running {
+		c.mu.Unlock()
+		return fetch
+	}
+	if c.pending == nil {
+		c.pending = make(map[string]*pendingFetch)
+	}
+	fetch := &pendingFetch{done: make(chan struct{})}
+	c.pending[pair] = fetch
+	c.mu.Unlock()
+
+	go func() {
+		unlock := c.fetching.Lock(pair)
+		defer unlock()
+
+		ticker, err := c.track(pair, fetcher)
+		if err == nil {
+			fetch.entry = c.newEntry(pair, ticker)
+		}
+
+		c.mu.Lock()
+		if err == nil {
+			c.data[pair] = fetch.entry
+		}
+		fetch.err = err
+		delete(c.pending, pair)
+		c.mu.Unlock()
+
+		close(fetch.done)
+	}()
+
+	return fetch
+}
+
+// RefreshInBackground starts fetching the pair without waiting for the
+// result, joining the background fetch already running for it if any
+func (c *Cache) RefreshInBackground(pair string, fetcher func() (Ticker, error)) {
+	c.startFetch(pair, fetcher)
+}
+
+// SetSmoothing sets the EWMA weight (0 < alpha < 1) of new fetches against
+// the cached price; zero disables smoothing
+func (c *Cache) SetSmoothing(alpha float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.smoothing = alpha
+}
+
+// Count a hit and report the served entry's age
+func (c *Cache) recordHit(pair string, entry CacheEntry) {
+	c.hits.Add(1)
+
+	c.mu.Lock()
+	onHit := c.onHit
+	c.mu.Unlock()
+	if onHit != nil {
+		onHit(pair, c.Now().Sub(entry.timestamp))
+	}
+}
+
+// SetHitObserver sets the function told the age of every entry served as a
+// hit, e.g. to find out whether a longer TTL would pay off
+func (c *Cache) SetHitObserver(onHit func(pair string, age time.Duration)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onHit = onHit
+}
+
+// SetPriceEpsilon sets the largest price change that keeps an entry's as_of;
+// zero disables the comparison
+func (c *Cache) SetPriceEpsilon(epsilon float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epsilon = epsilon
+}
+
+// SetSoftTimeout changes how long a miss with an expired entry waits for
+// its fetch
+func (c *Cache) SetSoftTimeout(timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.softTimeout = timeout
+}
+
+// Whether an expired entry is recent enough to be served while it's
+// refreshed in the background, rather than making the caller wait
+func (c *Cache) refreshableAsync(entry CacheEntry) bool {
+	if entry.timestamp.IsZero() {
+		return false
+	}
+
+	c.mu.Lock()
+	limit := c.syncRefreshAge
+	c.mu.Unlock()
+
+	return limit <= 0 || c.age(entry) <= limit
+}
+
+// SetSyncRefreshAge changes the age past which expired entries are
+// refreshed synchronously; zero removes the limit
+func (c *Cache) SetSyncRefreshAge(age time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.syncRefreshAge = age
+}
+
+// The pair's live entry if it's within the stale-if-error window
+func (c *Cache) staleEntry(pair string) (CacheEntry, bool) {
+	c.mu.Lock()
+	entry, exists := c.data[pair]
+	window := c.staleIfError
+	c.mu.Unlock()
+
+	return entry, exists && entry.source == "" && window > 0 && c.age(entry) < window
+}
+
+// The pair's entry if it was loaded from a snapshot and not yet replaced
+func (c *Cache) snapshotEntry(pair string) (CacheEntry, bool) {
+	c.mu.Lock()
+	entry, exists := c.data[pair]
+	c.mu.Unlock()
+
+	return entry, exists && entry.source == sourceSnapshot
+}
+
+// Age of the entry by the cache's clock. A timestamp in the future, left by
+// the clock jumping backwards, counts as brand new rather than negative.
+func (c *Cache) age(entry CacheEntry) time.Duration {
+	return max(c.Now().Sub(entry.timestamp), 0)
+}
+
+// SetClockSkewTolerance changes how far in the future an entry's timestamp
+// may be before it's re-anchored to now
+func (c *Cache) SetClockSkewTolerance(tolerance time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.skewTolerance = tolerance
+}
+
+// SetMaxClockSkew changes how far in the future an entry's timestamp may be
+// before it's no longer trusted at all; zero removes the limit
+func (c *Cache) SetMaxClockSkew(limit time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxSkew = limit
+}
+
+// SetStaleIfError changes how long past their timestamp entries may be
+// served when a refetch fails
+func (c *Cache) SetStaleIfError(window time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.staleIfError = window
+}
+
+// Build an entry for a freshly fetched ticker, with its own TTL when the
+// cache has a TTL function. With smoothing, the stored price is the EWMA of
+// the fetched one and the previous live entry; the fetched one is kept as
+// Unsmoothed.
+func (c *Cache) newEntry(pair string, ticker Ticker) CacheEntry {
+	c.mu.Lock()
+	ttlFunc, alpha, epsilon := c.ttlFunc, c.smoothing, c.epsilon
+	previous, exists := c.data[pair]
+	c.mu.Unlock()
+
+	if alpha > 0 && alpha < 1 && exists && previous.source == "" {
+		ticker.Unsmoothed = ticker.Last
+		ticker.Last = alpha*ticker.Last + (1-alpha)*previous.ticker.Last
+	}
+
+	entry := CacheEntry{
+		ticker:    ticker,
+		timestamp: c.Now(),
+	}
+
+	// The entry is fresh again either way, but an unmoved price keeps the
+	// time it last moved
+	if epsilon > 0 && exists && previous.source == "" && math.Abs(ticker.Last-previous.ticker.Last) <= epsilon {
+		entry.changedAt = previous.asOf()
+	}
+
+	if ttlFunc != nil {
+		entry.ttl = ttlFunc(pair)
+	}
+	return entry
+}
+
+// Look up the entry for pair, reporting whether it's live and within the TTL.
+// The entry is returned even if it isn't fresh.
+func (c *Cache) fresh(pair string) (CacheEntry, bool) {
+	now := c.Now()
+
+	c.mu.Lock()
+	entry, exists := c.data[pair]
+
+	// After a large backwards clock jump the entry would stay fresh until the
+	// clock caught up; re-anchor it so it expires one TTL from now instead.
+	// A timestamp further ahead than any plausible jump (a corrupt snapshot,
+	// a wildly wrong upstream clock) says nothing about how recent the price
+	// is, so the entry is anchored one TTL back and treated as expired.
+	if skew := entry.timestamp.Sub(now); exists && skew > c.skewTolerance {
+		if c.maxSkew > 0 && skew > c.maxSkew {
+			log.Printf("Clock skew detected: %s cached %v in the future, beyond the %v limit; treating it as expired", pair, skew, c.maxSkew)
+			ttl := entry.ttl
+			if ttl <= 0 {
+				ttl = c.ttl
+			}
+			entry.timestamp = now.Add(-ttl)
+		} else {
+			log.Printf("Clock skew detected: %s cached %v in the future, re-anchoring it to now", pair, skew)
+			entry.timestamp = now
+		}
+		c.data[pair] = entry
+	}
+	c.mu.Unlock()
+
+	return entry, exists && entry.source != sourceSnapshot && c.age(entry) < c.TTLOf(entry)
+}
+
+// TTLOf returns the TTL in effect for entry: its own if it has one,
+// otherwise the cache-wide TTL
+func (c *Cache) TTLOf(entry CacheEntry) time.Duration {
+	if entry.ttl > 0 {
+		return entry.ttl
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttl
+}
+
+// SetTTLFunc makes new entries take their TTL from fn; entries for which it
+// returns zero, and all entries when fn is nil, use the cache-wide TTL
+func (c *Cache) SetTTLFunc(fn func(pair string) time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttlFunc = fn
+}
+
+// SetTTL changes the TTL applied to every entry, including existing ones
+func (c *Cache) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// Fetch the pair and store it regardless of the current entry's age
+func (c *Cache) Refresh(pair string, fetcher func() (Ticker, error)) error {
+	unlock := c.fetching.Lock(pair)
+	defer unlock()
+
+	_, err := c.store(pair, fetcher)
+	return err
+}
+
+// RefreshShared is Refresh for callers that may pile up on the same pair:
+// a caller that waited for another one's refresh to finish takes its result
+// instead of fetching again, so concurrent refreshes cost one upstream call
+func (c *Cache) RefreshShared(pair string, fetcher func() (Ticker, error)) (CacheEntry, error) {
+	requested := c.Now()
+
+	unlock := c.fetching.Lock(pair)
+	defer unlock()
+
+	c.mu.Lock()
+	entry, exists := c.data[pair]
+	c.mu.Unlock()
+	if exists && entry.source == "" && entry.timestamp.After(requested) {
+		return entry, nil
+	}
+
+	return c.store(pair, fetcher)
+}
+
+// Fetch the pair and store the result; the caller holds the pair's lock
+func (c *Cache) store(pair string, fetcher func() (Ticker, error)) (CacheEntry, error) {
+	ticker, err := c.track(pair, fetcher)
+	if err != nil {
+		return CacheEntry{}, err
+	}
+
+	entry := c.newEntry(pair, ticker)
+
+	c.mu.Lock()
+	c.data[pair] = entry
+	c.mu.Unlock()
+
+	return entry, nil
+}
+
+// Len returns the number of cached entries
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.data)
+}
+
+// Entries returns a copy of every cached entry, keyed by pair
+func (c *Cache) Entries() map[string]CacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make(map[string]CacheEntry, len(c.data))
+	for pair, entry := range c.data {
+		entries[pair] = entry
+	}
+	return entries
+}
+
+// Peek returns the pair's entry whatever its age, without fetching
+func (c *Cache) Peek(pair string) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.data[pair]
+	return entry, ok
+}
+
+// Delete removes the pair's entry
+func (c *Cache) Delete(pair string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.data, pair)
+}
+
+// Purge removes every entry
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data = make(map[string]CacheEntry)
+}
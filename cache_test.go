@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetLTP_OverlappingRequestsFetchOnce(t *testing.T) {
+	service := NewService()
+
+	var fetches atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["45000.00","0.5"]}}}`))
+	}))
+	defer mockServer.Close()
+
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each request also lists the pair twice
+			ltpData, err := service.getLTP(context.Background(), []string{"BTC/USD", "btc/usd"}, IncludeOptions{})
+			if err != nil {
+				t.Errorf("getLTP failed: %v", err)
+				return
+			}
+			for _, ltp := range ltpData {
+				if ltp.Amount.Value != 45000.0 {
+					t.Errorf("Expected 45000, got %v", ltp.Amount)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("Expected a single upstream fetch, got %d", got)
+	}
+}
+
+func TestKeyedMutex_ReleasesLocks(t *testing.T) {
+	var k keyedMutex
+
+	unlockA := k.Lock("a")
+	unlockB := k.Lock("b") // Different keys don't block each other
+	unlockA()
+	unlockB()
+
+	if len(k.locks) != 0 {
+		t.Errorf("Expected all locks to be released, got %d", len(k.locks))
+	}
+}
+
+func TestGetLTP_FetchDelayOnMissOnly(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	cfg := DefaultConfig()
+	cfg.FetchDelay = 100 * time.Millisecond
+	service := NewServiceWithConfig(cfg)
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	start := time.Now()
+	if _, err := service.getLTP(context.Background(), []string{"BTC/USD"}, IncludeOptions{}); err != nil {
+		t.Fatalf("getLTP failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected the miss to be delayed by 100ms, took %v", elapsed)
+	}
+
+	start = time.Now()
+	if _, err := service.getLTP(context.Background(), []string{"BTC/USD"}, IncludeOptions{}); err != nil {
+		t.Fatalf("getLTP failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("Expected the hit not to be delayed, took %v", elapsed)
+	}
+}
+
+func TestHandleLTP_CacheStatusHeader(t *testing.T) {
+	var failing atomic.Bool
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.Write([]byte(`{"error":["EService:Unavailable"],"result":{}}`))
+			return
+		}
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["45000.00","0.5"]}}}`))
+	}))
+	defer mockServer.Close()
+
+	cfg := DefaultConfig()
+	cfg.CacheTTL = 10 * time.Second
+	cfg.StaleIfError = time.Minute
+	service := NewServiceWithConfig(cfg)
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	now := time.Now()
+	service.cache.now = func() time.Time { return now }
+
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+		rec := httptest.NewRecorder()
+		service.handleLTP(rec, req)
+		return rec
+	}
+
+	if status := get().Header().Get("X-Cache-Status"); status != cacheMiss {
+		t.Errorf("Expected miss on first request, got %q", status)
+	}
+	if status := get().Header().Get("X-Cache-Status"); status != cacheHit {
+		t.Errorf("Expected hit on second request, got %q", status)
+	}
+
+	// Expired and upstream down: the last-known-good price is served
+	now = now.Add(30 * time.Second)
+	failing.Store(true)
+
+	rec := get()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 when serving stale, got %d", rec.Code)
+	}
+	if status := rec.Header().Get("X-Cache-Status"); status != cacheStale {
+		t.Errorf("Expected stale after upstream failure, got %q", status)
+	}
+	if !strings.Contains(rec.Body.String(), `"stale":true`) {
+		t.Errorf("Expected stale flag in body, got %s", rec.Body.String())
+	}
+
+	// Beyond the stale-if-error window the failure surfaces
+	now = now.Add(time.Minute)
+	if rec := get(); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 past the stale window, got %d", rec.Code)
+	}
+}
+
+func TestGetLTP_SoftTimeoutServesStale(t *testing.T) {
+	var fetches atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["46000.00","0.5"]}}}`))
+	}))
+	defer mockServer.Close()
+
+	cfg := DefaultConfig()
+	cfg.CacheTTL = time.Minute
+	cfg.SoftTimeout = 20 * time.Millisecond
+	service := NewServiceWithConfig(cfg)
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	// An expired entry is available
+	service.cache.data["BTC/USD"] = CacheEntry{ticker: Ticker{Last: 45000}, timestamp: time.Now().Add(-2 * time.Minute)}
+
+	start := time.Now()
+	ltpData, err := service.getLTP(context.Background(), []string{"BTC/USD"}, IncludeOptions{})
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("getLTP failed: %v", err)
+	}
+	if ltpData[0].Amount.Value != 45000 || !ltpData[0].Stale {
+		t.Errorf("Expected the stale 45000, got %+v", ltpData[0])
+	}
+	if elapsed > 150*time.Millisecond {
+		t.Errorf("Expected the stale value within the soft timeout, took %v", elapsed)
+	}
+
+	// The background fetch warms the cache
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		ltpData, err = service.getLTP(context.Background(), []string{"BTC/USD"}, IncludeOptions{})
+		if err == nil && ltpData[0].Amount.Value == 46000 && !ltpData[0].Stale {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the cache to be updated in the background, got %+v", ltpData)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("Expected a single upstream fetch, got %d", got)
+	}
+}
+
+func TestCache_EntryTTLFromFunc(t *testing.T) {
+	cache := NewCache(time.Minute)
+	cache.SetTTLFunc(func(pair string) time.Duration {
+		if pair == "BTC/USD" {
+			return time.Millisecond
+		}
+		return 0
+	})
+
+	fetches := 0
+	fetch := func() (float64, error) {
+		fetches++
+		return 45000, nil
+	}
+
+	cache.GetOrFetch("BTC/USD", fetch)
+	cache.GetOrFetch("BTC/EUR", fetch)
+	time.Sleep(5 * time.Millisecond)
+	cache.GetOrFetch("BTC/USD", fetch)
+	cache.GetOrFetch("BTC/EUR", fetch)
+
+	if fetches != 3 {
+		t.Errorf("Expected 3 fetches, got %d", fetches)
+	}
+}
+
+func TestCache_Smoothing(t *testing.T) {
+	cache := NewCache(time.Minute)
+	cache.SetSmoothing(0.25)
+
+	prices := []float64{100, 200, 100, 100}
+	expected := []float64{100, 125, 118.75, 114.0625}
+
+	for i, price := range prices {
+		if err := cache.Refresh("BTC/USD", func() (Ticker, error) {
+			return Ticker{Last: price}, nil
+		}); err != nil {
+			t.Fatalf("Refresh failed: %v", err)
+		}
+
+		entry, _ := cache.Peek("BTC/USD")
+		if entry.ticker.Last != expected[i] {
+			t.Errorf("Step %d: expected %v, got %v", i, expected[i], entry.ticker.Last)
+		}
+		if i > 0 && entry.ticker.Unsmoothed != price {
+			t.Errorf("Step %d: expected unsmoothed %v, got %v", i, price, entry.ticker.Unsmoothed)
+		}
+	}
+}
+
+func TestCache_BackwardsClockJump(t *testing.T) {
+	cache := NewCache(30 * time.Second)
+	cache.SetClockSkewTolerance(5 * time.Second)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	fetches := 0
+	fetch := func() (float64, error) {
+		fetches++
+		return 45000, nil
+	}
+	cache.GetOrFetch("BTC/USD", fetch)
+
+	// NTP pulls the clock back an hour: the entry must not look expired
+	now = now.Add(-time.Hour)
+	cache.GetOrFetch("BTC/USD", fetch)
+	if fetches != 1 {
+		t.Errorf("Expected the entry to stay fresh after the jump, got %d fetches", fetches)
+	}
+	if age := cache.Stats().Ages["BTC/USD"]; age < 0 {
+		t.Errorf("Expected a non-negative age, got %v", age)
+	}
+
+	// Re-anchored to the new clock, it expires one TTL later rather than
+	// staying fresh for the hour it takes the clock to catch up
+	now = now.Add(31 * time.Second)
+	cache.GetOrFetch("BTC/USD", fetch)
+	if fetches != 2 {
+		t.Errorf("Expected a refetch one TTL after the jump, got %d fetches", fetches)
+	}
+}
+
+func TestCache_ImplausibleClockSkew(t *testing.T) {
+	cache := NewCache(30 * time.Second)
+	cache.SetClockSkewTolerance(5 * time.Second)
+	cache.SetMaxClockSkew(24 * time.Hour)
+	cache.SetStaleIfError(time.Minute)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	cache.data["BTC/USD"] = CacheEntry{ticker: Ticker{Last: 45000}, timestamp: now.AddDate(10, 0, 0)}
+
+	// Ten years ahead isn't a clock jump: the entry must not be served as fresh
+	if _, ok := cache.fresh("BTC/USD"); ok {
+		t.Error("Expected an entry far in the future to be treated as expired")
+	}
+	if entry, ok := cache.staleEntry("BTC/USD"); !ok || entry.ticker.Last != 45000 {
+		t.Errorf("Expected the entry to remain available as stale, got %v, %v", entry.ticker.Last, ok)
+	}
+
+	fetches := 0
+	price, _ := cache.GetOrFetch("BTC/USD", func() (float64, error) {
+		fetches++
+		return 46000, nil
+	})
+	if fetches != 1 || price != 46000 {
+		t.Errorf("Expected a live fetch of 46000, got %v after %d fetches", price, fetches)
+	}
+}
+
+func TestCache_PriceEpsilonKeepsAsOf(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewCache(time.Minute)
+	cache.now = func() time.Time { return now }
+	cache.SetPriceEpsilon(1)
+
+	refresh := func(price float64) CacheEntry {
+		if err := cache.Refresh("BTC/USD", func() (Ticker, error) {
+			return Ticker{Last: price}, nil
+		}); err != nil {
+			t.Fatalf("Refresh failed: %v", err)
+		}
+		entry, _ := cache.Peek("BTC/USD")
+		return entry
+	}
+
+	first := now
+	refresh(45000)
+
+	// A sub-epsilon change refreshes the entry but keeps its as_of
+	now = now.Add(2 * time.Minute)
+	entry := refresh(45000.5)
+	if !entry.asOf().Equal(first) {
+		t.Errorf("Expected as_of to stay %v, got %v", first, entry.asOf())
+	}
+	if _, fresh := cache.fresh("BTC/USD"); !fresh {
+		t.Error("Expected the refetched entry to be fresh")
+	}
+
+	// A larger move advances it
+	now = now.Add(2 * time.Minute)
+	entry = refresh(45010)
+	if !entry.asOf().Equal(now) {
+		t.Errorf("Expected as_of to advance to %v, got %v", now, entry.asOf())
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// CacheStats is a point-in-time view of cache usage
+type CacheStats struct {
+	Hits    int64
+	Misses  int64
+	Entries int
+	Ages    map[string]time.Duration
+}
+
+// Stats returns the cache's counters and the age of every entry
+func (c *Cache) Stats() CacheStats {
+	entries := c.Entries()
+
+	stats := CacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: len(entries),
+		Ages:    make(map[string]time.Duration, len(entries)),
+	}
+	now := c.Now()
+	for pair, entry := range entries {
+		stats.Ages[pair] = max(now.Sub(entry.timestamp), 0)
+	}
+	return stats
+}
+
+// HitRatio is the fraction of lookups served from the cache, 0 before any lookup
+func (cs CacheStats) HitRatio() float64 {
+	total := cs.Hits + cs.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(cs.Hits) / float64(total)
+}
+
+// Periodically log cache stats until ctx is done, for deployments without
+// a metrics backend
+func (s *Service) runCacheStatsLogger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			logCacheStats(slog.Default(), s.cache.Stats())
+		}
+	}
+}
+
+func logCacheStats(logger *slog.Logger, stats CacheStats) {
+	pairs := make([]string, 0, len(stats.Ages))
+	for pair := range stats.Ages {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+
+	ages := make([]any, 0, len(pairs))
+	for _, pair := range pairs {
+		ages = append(ages, slog.Float64(pair, stats.Ages[pair].Seconds()))
+	}
+
+	logger.Info("cache stats",
+		slog.Float64("hit_ratio", stats.HitRatio()),
+		slog.Int64("hits", stats.Hits),
+		slog.Int64("misses", stats.Misses),
+		slog.Int("entries", stats.Entries),
+		slog.Group("age_seconds", ages...),
+	)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestLogCacheStats_HitRatio(t *testing.T) {
+	cache := NewCache(time.Minute)
+	cache.hits.Store(3)
+	cache.misses.Store(1)
+	cache.data["BTC/USD"] = CacheEntry{timestamp: time.Now().Add(-10 * time.Second)}
+
+	var buf bytes.Buffer
+	logCacheStats(slog.New(slog.NewJSONHandler(&buf, nil)), cache.Stats())
+
+	var record struct {
+		HitRatio   float64            `json:"hit_ratio"`
+		Entries    int                `json:"entries"`
+		AgeSeconds map[string]float64 `json:"age_seconds"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Failed to decode log record %q: %v", buf.String(), err)
+	}
+
+	if record.HitRatio != 0.75 {
+		t.Errorf("Expected hit ratio 0.75, got %v", record.HitRatio)
+	}
+	if record.Entries != 1 {
+		t.Errorf("Expected 1 entry, got %d", record.Entries)
+	}
+	if age := record.AgeSeconds["BTC/USD"]; age < 10 || age > 11 {
+		t.Errorf("Expected BTC/USD age ~10s, got %v", age)
+	}
+}
+
+func TestCacheStats_CountsHitsAndMisses(t *testing.T) {
+	cache := NewCache(time.Minute)
+	fetcher := func() (float64, error) { return 100.0, nil }
+
+	cache.GetOrFetch("BTC/USD", fetcher)
+	cache.GetOrFetch("BTC/USD", fetcher)
+	cache.GetOrFetch("BTC/USD", fetcher)
+
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, got %+v", stats)
+	}
+
+	if (CacheStats{}).HitRatio() != 0 {
+		t.Error("Expected zero hit ratio before any lookup")
+	}
+}
+
+func TestRunCacheStatsLogger_StopsOnShutdown(t *testing.T) {
+	service := NewService()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		service.runCacheStatsLogger(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Expected stats logger to stop when the context is cancelled")
+	}
+}
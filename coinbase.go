@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Default Coinbase Exchange API base URL
+const defaultCoinbaseBaseURL = "https://api.exchange.coinbase.com"
+
+// Coinbase ticker response
+type CoinbaseTicker struct {
+	Price  string `json:"price"`
+	Bid    string `json:"bid"`
+	Ask    string `json:"ask"`
+	Volume string `json:"volume"`
+}
+
+// coinbaseProvider fetches tickers from the Coinbase Exchange public API
+type coinbaseProvider struct {
+	client  *http.Client
+	baseURL string
+}
+
+// Map internal pair names to Coinbase product IDs
+func getCoinbaseProduct(pair string) string {
+	switch strings.ToUpper(pair) {
+	case "BTC/USD":
+		return "BTC-USD"
+	case "BTC/EUR":
+		return "BTC-EUR"
+	default:
+		return ""
+	}
+}
+
+func (p *coinbaseProvider) Name() string {
+	return providerCoinbase
+}
+
+func (p *coinbaseProvider) FetchTicker(ctx context.Context, pair string) (Ticker, error) {
+	product := getCoinbaseProduct(pair)
+	if product == "" {
+		return Ticker{}, fmt.Errorf("%w: %s", ErrUnsupportedPair, pair)
+	}
+
+	url := fmt.Sprintf("%s/products/%s/ticker", p.baseURL, product)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Ticker{}, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Ticker{}, fmt.Errorf("failed to fetch from Coinbase: %w", upstreamTimeout(ctx, err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return Ticker{}, fmt.Errorf("Coinbase API error: %w", ErrUpstreamRateLimited)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Ticker{}, fmt.Errorf("Coinbase API returned status %d", resp.StatusCode)
+	}
+
+	var cbTicker CoinbaseTicker
+	if err := json.NewDecoder(resp.Body).Decode(&cbTicker); err != nil {
+		return Ticker{}, fmt.Errorf("failed to parse response: %w", upstreamTimeout(ctx, err))
+	}
+
+	price, err := strconv.ParseFloat(cbTicker.Price, 64)
+	if err != nil {
+		return Ticker{}, fmt.Errorf("failed to parse price: %w", err)
+	}
+
+	ticker := Ticker{Last: price}
+
+	// Bid and ask are best-effort, as with Kraken
+	if bid, err := strconv.ParseFloat(cbTicker.Bid, 64); err == nil {
+		ticker.Bid = bid
+	}
+	if ask, err := strconv.ParseFloat(cbTicker.Ask, 64); err == nil {
+		ticker.Ask = ask
+	}
+	if volume, err := strconv.ParseFloat(cbTicker.Volume, 64); err == nil {
+		ticker.Volume24h = volume
+	}
+
+	return ticker, nil
+}
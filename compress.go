@@ -0,0 +1,123 @@
+package main
+
+import (
+	"compress/gzip"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Compress responses with gzip for clients that accept it. The body is held
+// back until minSize bytes have been written, so small responses, where
+// compression costs more than it saves, go out as they are.
+func gzipMiddleware(level, minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Every response depends on Accept-Encoding, so shared caches
+			// must not hand an identity response to a gzip client or back
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			gw := &gzipResponseWriter{ResponseWriter: w, level: level, minSize: minSize, status: http.StatusOK}
+			defer gw.finish()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// Whether the request lists gzip among its accepted encodings
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the start of a response until it knows whether
+// the response is large enough to compress
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	level   int
+	minSize int
+
+	status      int
+	buf         []byte
+	wroteHeader bool
+	gz          *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+	}
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if w.wroteHeader {
+		if w.gz != nil {
+			return w.gz.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.minSize {
+		if err := w.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Switch to compressed output and flush what was buffered through it
+func (w *gzipResponseWriter) startGzip() error {
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" {
+		return w.flushPlain() // Already encoded by the handler
+	}
+
+	gz, err := gzip.NewWriterLevel(w.ResponseWriter, w.level)
+	if err != nil {
+		return err
+	}
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	w.gz = gz
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(w.status)
+
+	_, err = gz.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// Send the buffered bytes uncompressed
+func (w *gzipResponseWriter) flushPlain() error {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// Complete the response once the handler returns
+func (w *gzipResponseWriter) finish() {
+	var err error
+	if w.gz != nil {
+		err = w.gz.Close()
+	} else if !w.wroteHeader {
+		err = w.flushPlain()
+	}
+	if err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
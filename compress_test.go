@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipMiddleware_Threshold(t *testing.T) {
+	small := strings.Repeat("a", 100)
+	large := strings.Repeat(`{"pair":"BTC/USD","amount":45000}`, 100)
+
+	handler := gzipMiddleware(gzip.BestCompression, 1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("size") == "small" {
+			w.Write([]byte(small))
+			return
+		}
+		// Written in pieces so the threshold is crossed mid-response
+		w.WriteHeader(http.StatusAccepted)
+		for i := 0; i < len(large); i += 500 {
+			w.Write([]byte(large[i:min(i+500, len(large))]))
+		}
+	}))
+
+	// Below the threshold: sent as is
+	req := httptest.NewRequest("GET", "/?size=small", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected no Content-Encoding for a small body, got %s", rec.Header().Get("Content-Encoding"))
+	}
+	if rec.Body.String() != small {
+		t.Errorf("Expected small body unchanged, got %q", rec.Body.String())
+	}
+	if vary := rec.Header().Get("Vary"); vary != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding on an uncompressed body, got %q", vary)
+	}
+
+	// Above the threshold: compressed at the configured level
+	req = httptest.NewRequest("GET", "/?size=large", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("Expected status 202 to pass through, got %d", rec.Code)
+	}
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected Content-Encoding gzip, got %q", rec.Header().Get("Content-Encoding"))
+	}
+
+	var expected bytes.Buffer
+	gz, _ := gzip.NewWriterLevel(&expected, gzip.BestCompression)
+	gz.Write([]byte(large))
+	gz.Close()
+	if !bytes.Equal(rec.Body.Bytes(), expected.Bytes()) {
+		t.Errorf("Expected body compressed at level %d", gzip.BestCompression)
+	}
+
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to open gzip body: %v", err)
+	}
+	decoded, _ := io.ReadAll(reader)
+	if string(decoded) != large {
+		t.Errorf("Expected decompressed body to match the original")
+	}
+}
+
+func TestGzipMiddleware_ClientWithoutGzip(t *testing.T) {
+	body := strings.Repeat("a", 2048)
+	handler := gzipMiddleware(gzip.BestSpeed, 0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+
+	for _, accept := range []string{"", "br", "gzip;q=0"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", accept)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != body {
+			t.Errorf("Accept-Encoding %q: expected an uncompressed body", accept)
+		}
+		// Caches must still key the identity response on Accept-Encoding
+		if vary := rec.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("Accept-Encoding %q: expected Vary: Accept-Encoding, got %q", accept, vary)
+		}
+	}
+}
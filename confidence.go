@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfidenceWeights are the relative weights of the components of the
+// confidence score. They don't need to add up to one.
+type ConfidenceWeights struct {
+	Freshness float64
+	Agreement float64
+	Staleness float64
+}
+
+func defaultConfidenceWeights() ConfidenceWeights {
+	return ConfidenceWeights{Freshness: 0.5, Agreement: 0.3, Staleness: 0.2}
+}
+
+// Relative spread between the highest and lowest provider price at which
+// agreement drops to zero
+const maxConfidenceDispersion = 0.01
+
+// Score how much a price can be trusted, between 0 and 1:
+//
+//	freshness = 1 - min(age / CONFIDENCE_MAX_AGE, 1)
+//	agreement = 1 - min((dispersion / price) / 1%, 1)
+//	staleness = 0 if served stale, 1 otherwise
+//	score     = (wf*freshness + wa*agreement + ws*staleness) / (wf + wa + ws)
+//
+// A price from a single provider has no dispersion and fully agrees.
+func confidenceScore(weights ConfidenceWeights, maxAge, age time.Duration, ticker Ticker, stale bool) float64 {
+	freshness := 1.0
+	if maxAge > 0 {
+		freshness = 1 - math.Min(float64(age)/float64(maxAge), 1)
+	}
+
+	agreement := 1.0
+	if ticker.Dispersion > 0 && ticker.Last > 0 {
+		agreement = 1 - math.Min(ticker.Dispersion/ticker.Last/maxConfidenceDispersion, 1)
+	}
+
+	staleness := 1.0
+	if stale {
+		staleness = 0
+	}
+
+	total := weights.Freshness + weights.Agreement + weights.Staleness
+	if total <= 0 {
+		return 0
+	}
+	score := (weights.Freshness*max(freshness, 0) + weights.Agreement*agreement + weights.Staleness*staleness) / total
+	return math.Round(score*1000) / 1000
+}
+
+// Parse "component=weight" entries, e.g. "freshness=0.6,agreement=0.4,staleness=0".
+// Components that aren't listed keep their default weight.
+func parseConfidenceWeights(value string) (ConfidenceWeights, error) {
+	weights := defaultConfidenceWeights()
+	for _, item := range strings.Split(value, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		name, weightText, ok := strings.Cut(item, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok {
+			return weights, fmt.Errorf("malformed entry %q", item)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(weightText), 64)
+		if err != nil || weight < 0 || math.IsInf(weight, 0) {
+			return weights, fmt.Errorf("invalid weight %q for %s", weightText, name)
+		}
+
+		switch name {
+		case "freshness":
+			weights.Freshness = weight
+		case "agreement":
+			weights.Agreement = weight
+		case "staleness":
+			weights.Staleness = weight
+		default:
+			return weights, fmt.Errorf("unknown component %q", name)
+		}
+	}
+	if weights.Freshness+weights.Agreement+weights.Staleness == 0 {
+		return weights, fmt.Errorf("at least one weight must be positive")
+	}
+	return weights, nil
+}
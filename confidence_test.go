@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConfidenceScore(t *testing.T) {
+	weights := defaultConfidenceWeights()
+	ticker := Ticker{Last: 45000}
+
+	fresh := confidenceScore(weights, time.Minute, time.Second, ticker, false)
+	if fresh < 0.95 {
+		t.Errorf("Expected a fresh single-source price to score near 1, got %v", fresh)
+	}
+
+	stale := confidenceScore(weights, time.Minute, 2*time.Minute, ticker, true)
+	if stale >= fresh {
+		t.Errorf("Expected a stale price to score lower than %v, got %v", fresh, stale)
+	}
+
+	// Providers 2% apart don't agree at all
+	ticker.SampleCount, ticker.Dispersion = 3, 900
+	disagreeing := confidenceScore(weights, time.Minute, time.Second, ticker, false)
+	if disagreeing >= fresh {
+		t.Errorf("Expected disagreeing providers to score lower than %v, got %v", fresh, disagreeing)
+	}
+}
+
+func TestParseConfidenceWeights(t *testing.T) {
+	weights, err := parseConfidenceWeights("freshness=1, staleness=0")
+	if err != nil {
+		t.Fatalf("parseConfidenceWeights failed: %v", err)
+	}
+	if weights.Freshness != 1 || weights.Agreement != 0.3 || weights.Staleness != 0 {
+		t.Errorf("Expected weights 1/0.3/0, got %+v", weights)
+	}
+
+	for _, value := range []string{"freshness", "freshness=-1", "speed=1", "freshness=0,agreement=0,staleness=0"} {
+		if _, err := parseConfidenceWeights(value); err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+}
+
+func TestHandleLTP_IncludeConfidenceScore(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	get := func() float64 {
+		req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&include=confidence_score", nil)
+		rec := httptest.NewRecorder()
+		service.handleLTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+
+		var response LTPResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.LTP[0].Confidence == nil {
+			t.Fatal("Expected confidence_score in the response")
+		}
+		return *response.LTP[0].Confidence
+	}
+
+	if score := get(); score < 0.95 {
+		t.Errorf("Expected a fresh price to score near 1, got %v", score)
+	}
+
+	// The cached price is still served, but has aged past CONFIDENCE_MAX_AGE
+	service.cache.SetTTL(time.Hour)
+	service.cache.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if score := get(); score > 0.5 {
+		t.Errorf("Expected an old price to score lower, got %v", score)
+	}
+}
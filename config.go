@@ -0,0 +1,922 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"maps"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the runtime configuration of the service
+type Config struct {
+	Port     string
+	CacheTTL time.Duration
+
+	// AdminAddr is the address of the admin listener serving management
+	// endpoints; empty disables them
+	AdminAddr string
+
+	// HealthAddr is the address of a listener serving only /health and
+	// /readiness, so probes get through when the public listener is
+	// saturated; empty serves them on the public listener alone
+	HealthAddr string
+
+	// KrakenRequestIDHeader names the header carrying a unique ID on every
+	// Kraken request; empty sends none
+	KrakenRequestIDHeader string
+
+	// RoutePrefix is prepended to every API route, e.g. /ltp-service for
+	// mounting behind a gateway; OpsRoutePrefix is prepended to /health
+	// and /readiness. Both are empty or start with a slash.
+	RoutePrefix    string
+	OpsRoutePrefix string
+
+	// ServePairs restricts which pairs the service will serve.
+	// An empty allowlist means "all supported pairs".
+	ServePairs []string
+
+	// DefaultPairs are returned by a bare request; empty means all supported
+	DefaultPairs []string
+
+	// RequireExplicitPairs rejects bare requests instead of answering them
+	// with DefaultPairs, to avoid accidental over-fetching
+	RequireExplicitPairs bool
+
+	// PrimaryCurrency builds DefaultPairs from every supported pair quoted in
+	// it, unless DEFAULT_PAIRS lists them explicitly
+	PrimaryCurrency string
+
+	// StaleWhileSlow serves a request from expired entries right away, and
+	// refreshes them in the background, when every pair it asks for is
+	// cached but expired and the smoothed latency of the providers they'd
+	// be fetched from is above this; zero disables it
+	StaleWhileSlow time.Duration
+
+	// SyncRefreshAge is how long past its fetch time an expired entry may
+	// still be served while it's refreshed in the background, by
+	// STALE_WHILE_SLOW or SOFT_TIMEOUT; older entries make the request wait
+	// for the refresh. Zero means no limit.
+	SyncRefreshAge time.Duration
+
+	// DeprecatedPairs are still served, but flagged as going away
+	DeprecatedPairs []string
+
+	// DefaultInclude is the include set of requests that don't pass one
+	DefaultInclude IncludeOptions
+
+	// RetryOnParseError requests Kraken once more when a response isn't
+	// valid JSON, such as a truncated body
+	RetryOnParseError bool
+
+	// ShareResponses lets identical concurrent LTP requests share one
+	// computation and its response bytes
+	ShareResponses bool
+
+	// WarmPairs are kept fresh by the refresher; empty means DefaultPairs
+	WarmPairs []string
+
+	// ValidatePairs rejects a configuration whose DEFAULT_PAIRS, WARM_PAIRS
+	// or SERVE_PAIRS name a pair the service can't resolve
+	ValidatePairs bool
+
+	// MaxPairs caps the number of pairs in one request, including pairs
+	// expanded from bases and quotes; zero means no limit
+	MaxPairs int
+
+	// HistorySize is the number of samples kept per pair; zero disables history
+	HistorySize int
+
+	// HistoryMaxSamples caps the samples kept across all pairs, evicting the
+	// oldest of any pair past it; zero is unbounded
+	HistoryMaxSamples int
+
+	// HistoryInterval is the minimum spacing between recorded samples of a
+	// pair; fetches in between aren't recorded. Zero records every fetch.
+	HistoryInterval time.Duration
+
+	// SnapshotPath enables persisting the cache to disk; empty disables it
+	SnapshotPath     string
+	SnapshotInterval time.Duration
+
+	// ReadinessTimeout bounds the upstream check done by /readiness
+	ReadinessTimeout time.Duration
+
+	// DeepCheckPair is the canary fetched end-to-end by /readiness?deep=true;
+	// its outcome is reused for DeepCheckInterval to protect the upstream
+	DeepCheckPair     string
+	DeepCheckInterval time.Duration
+
+	// ShutdownTimeout is the grace period for in-flight requests on shutdown
+	ShutdownTimeout time.Duration
+
+	// ShutdownDelay keeps the listeners open this long after the shutdown
+	// signal, so load balancers see RejectDuringShutdown's 503s and take
+	// the instance out of rotation before connections are refused
+	ShutdownDelay time.Duration
+
+	// RejectDuringShutdown answers requests arriving after shutdown began
+	// with 503 instead of serving them
+	RejectDuringShutdown bool
+
+	// KrakenHosts are the Kraken API base URLs to choose from; the first is
+	// used until the refresher has probed them
+	KrakenHosts []string
+
+	// Providers is the fallback order of upstream providers
+	Providers []string
+
+	// ProviderMode selects between trying Providers in order (fallback) and
+	// querying all of them concurrently and combining the prices (aggregate)
+	ProviderMode string
+
+	// AggregateConcurrency caps the upstream calls in flight for aggregate
+	// fetches, shared across pairs and providers; zero means no limit
+	AggregateConcurrency int
+
+	// AggregateWeighting is how aggregate fetches combine prices: median,
+	// equal (mean), volume (weighted by 24h volume) or latency (weighted
+	// by the inverse of each provider's last call duration)
+	AggregateWeighting string
+
+	// AnomalyThreshold is the relative move from the last price beyond which
+	// a fallback-mode price is confirmed with the other providers; zero
+	// disables confirmation
+	AnomalyThreshold float64
+
+	// ProviderPins routes a pair to a single provider, bypassing the fallback order
+	ProviderPins map[string]string
+
+	// ProviderTimeouts bounds each call to a provider; providers without an
+	// entry are only bounded by their HTTP client timeout
+	ProviderTimeouts map[string]time.Duration
+
+	// ProviderFailureThreshold is the number of consecutive failures after
+	// which a provider is skipped for ProviderCooldown; zero never skips
+	ProviderFailureThreshold int
+	ProviderCooldown         time.Duration
+
+	CoinbaseBaseURL string
+
+	// ScriptedPrices are the price sequences per pair served by the
+	// scripted provider, loaded from SCRIPTED_PRICES_FILE; ScriptedLoop
+	// starts a sequence over once it runs out
+	ScriptedPrices map[string][]float64
+	ScriptedLoop   bool
+
+	// CacheStatsInterval enables periodic cache stats logging; zero disables it
+	CacheStatsInterval time.Duration
+
+	// RefreshMinInterval is how recent a pair's live price may be for a
+	// forced refresh to return it instead of asking upstream again; zero
+	// makes every refresh fetch
+	RefreshMinInterval time.Duration
+
+	// RefreshBatch makes the refresher fetch all warm pairs from Kraken in
+	// one call; BatchBackfill retries pairs the batch response left out
+	RefreshBatch  bool
+	BatchBackfill bool
+
+	// RefreshInterval enables the background refresher; zero disables it
+	RefreshInterval time.Duration
+
+	// WarmupTimeout enables warming the cache before the server starts,
+	// retrying failed pairs for at most this long; zero disables it
+	WarmupTimeout time.Duration
+
+	// CacheTTLMin and CacheTTLMax enable adaptive TTLs when both are set:
+	// new entries get a TTL between them, shorter the more volatile the
+	// pair's recent history. AdaptiveTTLVolatility is the volatility (stddev
+	// of relative price changes) at which the TTL bottoms out at the minimum.
+	CacheTTLMin           time.Duration
+	CacheTTLMax           time.Duration
+	AdaptiveTTLVolatility float64
+
+	// ResponseBudget bounds the wall-clock time of an LTP request; pairs not
+	// ready when it runs out are served from the cache or reported as
+	// errors. Zero waits for every pair.
+	ResponseBudget time.Duration
+
+	// PriceSmoothing is the EWMA weight (0 < alpha < 1) of a new fetch
+	// against the previous cached price; zero stores prices unsmoothed
+	PriceSmoothing float64
+
+	// PriceEpsilon is the largest price change a refetch may bring while
+	// keeping the entry's as_of, so unchanged prices don't look like moves;
+	// zero disables it
+	PriceEpsilon float64
+
+	// ConfidenceWeights weigh freshness, provider agreement and staleness in
+	// the score returned with ?include=confidence_score
+	ConfidenceWeights ConfidenceWeights
+
+	// ConfidenceMaxAge is the age at which a price no longer counts as fresh
+	// for the confidence score
+	ConfidenceMaxAge time.Duration
+
+	// ClockSkewTolerance is how far in the future a cached entry may be,
+	// after the clock jumped backwards, before it's re-anchored to now.
+	// Entries further ahead than ClockSkewMax are treated as expired.
+	ClockSkewTolerance time.Duration
+	ClockSkewMax       time.Duration
+
+	// StaleIfError lets an expired entry be served, flagged as stale, for
+	// this long past its fetch time when refetching it fails; zero disables it
+	StaleIfError time.Duration
+
+	// SoftTimeout bounds how long a miss waits for upstream when an expired
+	// entry exists; past it the expired entry is served while the fetch
+	// finishes in the background. Zero always waits.
+	SoftTimeout time.Duration
+
+	// FallbackOrder is the order in which lookups try the fresh cache, a
+	// live fetch, the stale cache and snapshot entries; sources left out
+	// are never used
+	FallbackOrder []string
+
+	// FetchDelay is an artificial delay added to every cache miss, to
+	// simulate a slow upstream in staging; zero disables it
+	FetchDelay time.Duration
+
+	// FetchMode is on_demand to fetch cache misses from upstream, or
+	// refresher_only to serve only what the refresher keeps warm
+	FetchMode string
+
+	// ErrorStatuses maps upstream error categories to HTTP statuses
+	ErrorStatuses map[string]int
+
+	// EmptyOK answers 200 with an empty result and the per-pair errors when
+	// no pair could be fetched, instead of an error status
+	EmptyOK bool
+
+	// SinglePairErrors answers a failed single-pair request with that pair's
+	// own error and a specific status (400 unsupported, 502 upstream) instead
+	// of the generic multi-pair error
+	SinglePairErrors bool
+
+	// TrailingSlash is how paths with a trailing slash are handled: redirect
+	// or serve
+	TrailingSlash string
+
+	// AllowZeroPrice serves a zero price from Kraken instead of rejecting it
+	// as a glitch; negative prices are always rejected
+	AllowZeroPrice bool
+
+	// SignificantDigits caps the significant digits prices are encoded
+	// with in JSON responses; zero encodes every digit
+	SignificantDigits int
+
+	// PairDecimals rounds prices to each pair's display decimals, learned
+	// from Kraken's AssetPairs metadata at startup
+	PairDecimals bool
+
+	// SecurityHeaders enables hardening headers; pure-API setups may disable it
+	SecurityHeaders bool
+
+	// GzipLevel enables gzip responses at this compression level (1-9) for
+	// clients that accept them; zero disables compression. Responses smaller
+	// than GzipMinSize bytes are sent uncompressed.
+	GzipLevel   int
+	GzipMinSize int
+
+	// MaxBodySize caps the JSON body of POST /api/v1/ltp, in bytes
+	MaxBodySize int64
+
+	// MetricsBackend selects where instrumentation is reported: none or prometheus
+	MetricsBackend string
+
+	// TrustedProxies lists the proxy networks whose forwarding headers are honored
+	TrustedProxies []netip.Prefix
+}
+
+// DefaultConfig returns the configuration used when no environment overrides are set
+func DefaultConfig() Config {
+	return Config{
+		Port:                  "8080",
+		CacheTTL:              30 * time.Second,
+		SnapshotInterval:      time.Minute,
+		HistorySize:           1000,
+		MaxPairs:              20,
+		ReadinessTimeout:      2 * time.Second,
+		ConfidenceWeights:     defaultConfidenceWeights(),
+		ConfidenceMaxAge:      time.Minute,
+		FallbackOrder:         defaultFallbackOrder(),
+		ClockSkewTolerance:    5 * time.Second,
+		ClockSkewMax:          24 * time.Hour,
+		DeepCheckPair:         "BTC/USD",
+		DeepCheckInterval:     10 * time.Second,
+		ShutdownTimeout:       10 * time.Second,
+		RejectDuringShutdown:  true,
+		KrakenHosts:           []string{defaultKrakenBaseURL},
+		FetchMode:             fetchModeOnDemand,
+		Providers:             []string{providerKraken},
+		ProviderMode:          providerModeFallback,
+		ValidatePairs:         true,
+		AggregateWeighting:    weightingMedian,
+		ProviderCooldown:      30 * time.Second,
+		CoinbaseBaseURL:       defaultCoinbaseBaseURL,
+		ErrorStatuses:         defaultErrorStatuses(),
+		SecurityHeaders:       true,
+		KrakenRequestIDHeader: "X-Request-ID",
+		GzipMinSize:           1024,
+		MaxBodySize:           64 << 10,
+		SinglePairErrors:      true,
+		AdaptiveTTLVolatility: 0.001,
+		TrailingSlash:         trailingSlashRedirect,
+		MetricsBackend:        metricsBackendNone,
+	}
+}
+
+// LoadConfig builds the configuration from environment variables and, when
+// CONFIG_FILE is set, the settings in that file
+func LoadConfig() (Config, error) {
+	cfg := DefaultConfig()
+
+	env, err := loadConfigEnv(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return cfg, fmt.Errorf("invalid CONFIG_FILE: %w", err)
+	}
+
+	if port := env.get("PORT"); port != "" {
+		cfg.Port = port
+	}
+
+	cfg.AdminAddr = env.get("ADMIN_ADDR")
+	cfg.HealthAddr = env.get("HEALTH_ADDR")
+	if cfg.HealthAddr != "" && cfg.HealthAddr == cfg.AdminAddr {
+		return cfg, fmt.Errorf("HEALTH_ADDR %q must differ from ADMIN_ADDR", cfg.HealthAddr)
+	}
+
+	// KRAKEN_REQUEST_ID_HEADER= (set but empty) turns the header off
+	if header, set := os.LookupEnv("KRAKEN_REQUEST_ID_HEADER"); set {
+		cfg.KrakenRequestIDHeader = strings.TrimSpace(header)
+	}
+
+	// Health and metrics follow the API prefix unless given their own;
+	// OPS_ROUTE_PREFIX=/ keeps them at the root
+	cfg.RoutePrefix = normalizeRoutePrefix(env.get("ROUTE_PREFIX"))
+	cfg.OpsRoutePrefix = cfg.RoutePrefix
+	if prefix, set := os.LookupEnv("OPS_ROUTE_PREFIX"); set && prefix != "" {
+		cfg.OpsRoutePrefix = normalizeRoutePrefix(prefix)
+	}
+
+	cfg.ServePairs = parsePairList(env.get("SERVE_PAIRS"))
+	cfg.DefaultPairs = parsePairList(env.get("DEFAULT_PAIRS"))
+	if currency := env.get("PRIMARY_CURRENCY"); currency != "" {
+		cfg.PrimaryCurrency = normalizePair(currency)
+		if len(cfg.DefaultPairs) == 0 {
+			cfg.DefaultPairs = pairsQuotedIn(cfg.PrimaryCurrency)
+			if len(cfg.DefaultPairs) == 0 {
+				return cfg, fmt.Errorf("invalid PRIMARY_CURRENCY %q: no supported pair is quoted in it", currency)
+			}
+		}
+	}
+	include, err := parseInclude(env.get("DEFAULT_INCLUDE"))
+	if err != nil {
+		return cfg, fmt.Errorf("invalid DEFAULT_INCLUDE: %w", err)
+	}
+	cfg.DefaultInclude = include
+
+	cfg.WarmPairs = parsePairList(env.get("WARM_PAIRS"))
+	cfg.DeprecatedPairs = parsePairList(env.get("DEPRECATED_PAIRS"))
+	cfg.SnapshotPath = env.get("SNAPSHOT_PATH")
+
+	if pair := env.get("DEEP_CHECK_PAIR"); pair != "" {
+		cfg.DeepCheckPair = normalizePair(pair)
+	}
+
+	durations := []struct {
+		name   string
+		target *time.Duration
+	}{
+		{"CACHE_TTL", &cfg.CacheTTL},
+		{"SNAPSHOT_INTERVAL", &cfg.SnapshotInterval},
+		{"READINESS_TIMEOUT", &cfg.ReadinessTimeout},
+		{"CONFIDENCE_MAX_AGE", &cfg.ConfidenceMaxAge},
+		{"DEEP_CHECK_INTERVAL", &cfg.DeepCheckInterval},
+		{"SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout},
+		{"SHUTDOWN_DELAY", &cfg.ShutdownDelay},
+		{"REFRESH_MIN_INTERVAL", &cfg.RefreshMinInterval},
+		{"REFRESH_INTERVAL", &cfg.RefreshInterval},
+		{"CACHE_STATS_INTERVAL", &cfg.CacheStatsInterval},
+		{"WARMUP_TIMEOUT", &cfg.WarmupTimeout},
+		{"HISTORY_INTERVAL", &cfg.HistoryInterval},
+		{"FETCH_DELAY", &cfg.FetchDelay},
+		{"STALE_IF_ERROR", &cfg.StaleIfError},
+		{"SOFT_TIMEOUT", &cfg.SoftTimeout},
+		{"RESPONSE_BUDGET", &cfg.ResponseBudget},
+		{"STALE_WHILE_SLOW", &cfg.StaleWhileSlow},
+		{"SYNC_REFRESH_AGE", &cfg.SyncRefreshAge},
+		{"CLOCK_SKEW_TOLERANCE", &cfg.ClockSkewTolerance},
+		{"CLOCK_SKEW_MAX", &cfg.ClockSkewMax},
+		{"CACHE_TTL_MIN", &cfg.CacheTTLMin},
+		{"CACHE_TTL_MAX", &cfg.CacheTTLMax},
+		{"PROVIDER_COOLDOWN", &cfg.ProviderCooldown},
+	}
+	for _, d := range durations {
+		if err := durationFromEnv(env, d.name, d.target); err != nil {
+			return cfg, err
+		}
+	}
+
+	if cfg.ClockSkewMax < cfg.ClockSkewTolerance {
+		return cfg, fmt.Errorf("CLOCK_SKEW_MAX must not be below CLOCK_SKEW_TOLERANCE")
+	}
+
+	if hosts := env.get("KRAKEN_HOSTS"); hosts != "" {
+		cfg.KrakenHosts = nil
+		for _, host := range strings.Split(hosts, ",") {
+			if host = strings.TrimRight(strings.TrimSpace(host), "/"); host != "" {
+				cfg.KrakenHosts = append(cfg.KrakenHosts, host)
+			}
+		}
+		if len(cfg.KrakenHosts) == 0 {
+			return cfg, fmt.Errorf("invalid KRAKEN_HOSTS %q", hosts)
+		}
+	}
+
+	if providers := env.get("PROVIDERS"); providers != "" {
+		cfg.Providers = nil
+		for _, name := range strings.Split(providers, ",") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				if !isKnownProvider(name) {
+					return cfg, fmt.Errorf("invalid PROVIDERS: unknown provider %q", name)
+				}
+				cfg.Providers = append(cfg.Providers, name)
+			}
+		}
+	}
+
+	if mode := env.get("PROVIDER_MODE"); mode != "" {
+		mode = strings.ToLower(strings.TrimSpace(mode))
+		if mode != providerModeFallback && mode != providerModeAggregate {
+			return cfg, fmt.Errorf("invalid PROVIDER_MODE %q", mode)
+		}
+		cfg.ProviderMode = mode
+	}
+
+	if order := env.get("FALLBACK_ORDER"); order != "" {
+		cfg.FallbackOrder, err = parseFallbackOrder(order)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid FALLBACK_ORDER: %w", err)
+		}
+	}
+
+	if weighting := env.get("AGGREGATE_WEIGHTING"); weighting != "" {
+		weighting = strings.ToLower(strings.TrimSpace(weighting))
+		switch weighting {
+		case weightingMedian, weightingEqual, weightingVolume, weightingLatency:
+			cfg.AggregateWeighting = weighting
+		default:
+			return cfg, fmt.Errorf("invalid AGGREGATE_WEIGHTING %q", weighting)
+		}
+	}
+
+	pins, err := parseProviderPins(env.get("PROVIDER_PINS"))
+	if err != nil {
+		return cfg, fmt.Errorf("invalid PROVIDER_PINS: %w", err)
+	}
+	cfg.ProviderPins = pins
+
+	timeouts, err := parseProviderTimeouts(env.get("PROVIDER_TIMEOUTS"))
+	if err != nil {
+		return cfg, fmt.Errorf("invalid PROVIDER_TIMEOUTS: %w", err)
+	}
+	cfg.ProviderTimeouts = timeouts
+
+	if baseURL := env.get("COINBASE_BASE_URL"); baseURL != "" {
+		cfg.CoinbaseBaseURL = strings.TrimRight(baseURL, "/")
+	}
+
+	if path := env.get("SCRIPTED_PRICES_FILE"); path != "" {
+		prices, err := loadScriptedPrices(path)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid SCRIPTED_PRICES_FILE: %w", err)
+		}
+		cfg.ScriptedPrices = prices
+	}
+	if err := boolFromEnv(env, "SCRIPTED_LOOP", &cfg.ScriptedLoop); err != nil {
+		return cfg, err
+	}
+	if slices.Contains(cfg.Providers, providerScripted) && cfg.ScriptedPrices == nil {
+		return cfg, fmt.Errorf("invalid PROVIDERS: %s requires SCRIPTED_PRICES_FILE", providerScripted)
+	}
+
+	if err := intFromEnv(env, "HISTORY_SIZE", &cfg.HistorySize); err != nil {
+		return cfg, err
+	}
+
+	if err := intFromEnv(env, "HISTORY_MAX_SAMPLES", &cfg.HistoryMaxSamples); err != nil {
+		return cfg, err
+	}
+
+	if (cfg.CacheTTLMin == 0) != (cfg.CacheTTLMax == 0) || cfg.CacheTTLMin > cfg.CacheTTLMax {
+		return cfg, fmt.Errorf("CACHE_TTL_MIN and CACHE_TTL_MAX must be set together, with MIN <= MAX")
+	}
+
+	if value := env.get("PRICE_SMOOTHING"); value != "" {
+		alpha, err := strconv.ParseFloat(value, 64)
+		if err != nil || alpha < 0 || alpha >= 1 {
+			return cfg, fmt.Errorf("invalid PRICE_SMOOTHING %q: must be in [0, 1)", value)
+		}
+		cfg.PriceSmoothing = alpha
+	}
+
+	if value := env.get("ANOMALY_THRESHOLD"); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil || threshold < 0 {
+			return cfg, fmt.Errorf("invalid ANOMALY_THRESHOLD %q", value)
+		}
+		cfg.AnomalyThreshold = threshold
+	}
+
+	if value := env.get("PRICE_EPSILON"); value != "" {
+		epsilon, err := strconv.ParseFloat(value, 64)
+		if err != nil || epsilon < 0 {
+			return cfg, fmt.Errorf("invalid PRICE_EPSILON %q", value)
+		}
+		cfg.PriceEpsilon = epsilon
+	}
+
+	weights, err := parseConfidenceWeights(env.get("CONFIDENCE_WEIGHTS"))
+	if err != nil {
+		return cfg, fmt.Errorf("invalid CONFIDENCE_WEIGHTS: %w", err)
+	}
+	cfg.ConfidenceWeights = weights
+
+	if value := env.get("ADAPTIVE_TTL_VOLATILITY"); value != "" {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || v <= 0 {
+			return cfg, fmt.Errorf("invalid ADAPTIVE_TTL_VOLATILITY %q", value)
+		}
+		cfg.AdaptiveTTLVolatility = v
+	}
+
+	if err := intFromEnv(env, "MAX_PAIRS", &cfg.MaxPairs); err != nil {
+		return cfg, err
+	}
+
+	if value := env.get("MAX_BODY_SIZE"); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size <= 0 {
+			return cfg, fmt.Errorf("invalid MAX_BODY_SIZE %q", value)
+		}
+		cfg.MaxBodySize = size
+	}
+
+	if err := intFromEnv(env, "AGGREGATE_CONCURRENCY", &cfg.AggregateConcurrency); err != nil {
+		return cfg, err
+	}
+
+	if err := intFromEnv(env, "PROVIDER_FAILURE_THRESHOLD", &cfg.ProviderFailureThreshold); err != nil {
+		return cfg, err
+	}
+
+	statuses, err := parseErrorStatuses(env.get("ERROR_STATUS_MAP"))
+	if err != nil {
+		return cfg, fmt.Errorf("invalid ERROR_STATUS_MAP: %w", err)
+	}
+	cfg.ErrorStatuses = statuses
+
+	if err := boolFromEnv(env, "SECURITY_HEADERS", &cfg.SecurityHeaders); err != nil {
+		return cfg, err
+	}
+
+	if err := boolFromEnv(env, "REJECT_DURING_SHUTDOWN", &cfg.RejectDuringShutdown); err != nil {
+		return cfg, err
+	}
+
+	if err := intFromEnv(env, "GZIP_LEVEL", &cfg.GzipLevel); err != nil {
+		return cfg, err
+	}
+	if cfg.GzipLevel > gzip.BestCompression {
+		return cfg, fmt.Errorf("invalid GZIP_LEVEL %d: must be between %d and %d", cfg.GzipLevel, gzip.BestSpeed, gzip.BestCompression)
+	}
+
+	if err := intFromEnv(env, "GZIP_MIN_SIZE", &cfg.GzipMinSize); err != nil {
+		return cfg, err
+	}
+
+	if err := boolFromEnv(env, "PAIR_DECIMALS", &cfg.PairDecimals); err != nil {
+		return cfg, err
+	}
+
+	if err := intFromEnv(env, "PRICE_SIGNIFICANT_DIGITS", &cfg.SignificantDigits); err != nil {
+		return cfg, err
+	}
+	if cfg.SignificantDigits > 17 {
+		return cfg, fmt.Errorf("invalid PRICE_SIGNIFICANT_DIGITS %d: at most 17", cfg.SignificantDigits)
+	}
+
+	if err := boolFromEnv(env, "ALLOW_ZERO_PRICE", &cfg.AllowZeroPrice); err != nil {
+		return cfg, err
+	}
+
+	if err := boolFromEnv(env, "EMPTY_OK", &cfg.EmptyOK); err != nil {
+		return cfg, err
+	}
+
+	if err := boolFromEnv(env, "REFRESH_BATCH", &cfg.RefreshBatch); err != nil {
+		return cfg, err
+	}
+
+	if err := boolFromEnv(env, "BATCH_BACKFILL", &cfg.BatchBackfill); err != nil {
+		return cfg, err
+	}
+
+	if err := boolFromEnv(env, "REQUIRE_EXPLICIT_PAIRS", &cfg.RequireExplicitPairs); err != nil {
+		return cfg, err
+	}
+
+	if err := boolFromEnv(env, "SINGLE_PAIR_ERRORS", &cfg.SinglePairErrors); err != nil {
+		return cfg, err
+	}
+
+	if err := boolFromEnv(env, "SHARE_RESPONSES", &cfg.ShareResponses); err != nil {
+		return cfg, err
+	}
+
+	if err := boolFromEnv(env, "RETRY_ON_PARSE_ERROR", &cfg.RetryOnParseError); err != nil {
+		return cfg, err
+	}
+
+	if mode := env.get("FETCH_MODE"); mode != "" {
+		mode = strings.ToLower(strings.TrimSpace(mode))
+		if mode != fetchModeOnDemand && mode != fetchModeRefresherOnly {
+			return cfg, fmt.Errorf("invalid FETCH_MODE %q", mode)
+		}
+		cfg.FetchMode = mode
+	}
+	if cfg.FetchMode == fetchModeRefresherOnly && cfg.RefreshInterval == 0 {
+		return cfg, fmt.Errorf("FETCH_MODE=%s requires REFRESH_INTERVAL", fetchModeRefresherOnly)
+	}
+
+	if mode := env.get("TRAILING_SLASH"); mode != "" {
+		mode = strings.ToLower(strings.TrimSpace(mode))
+		if mode != trailingSlashRedirect && mode != trailingSlashServe {
+			return cfg, fmt.Errorf("invalid TRAILING_SLASH %q", mode)
+		}
+		cfg.TrailingSlash = mode
+	}
+
+	if backend := env.get("METRICS_BACKEND"); backend != "" {
+		backend = strings.ToLower(strings.TrimSpace(backend))
+		if backend != metricsBackendNone && backend != metricsBackendPrometheus {
+			return cfg, fmt.Errorf("invalid METRICS_BACKEND %q", backend)
+		}
+		cfg.MetricsBackend = backend
+	}
+
+	proxies, err := parsePrefixList(env.get("TRUSTED_PROXIES"))
+	if err != nil {
+		return cfg, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+	cfg.TrustedProxies = proxies
+
+	if err := boolFromEnv(env, "VALIDATE_PAIRS", &cfg.ValidatePairs); err != nil {
+		return cfg, err
+	}
+	if cfg.ValidatePairs {
+		if err := validatePairs(cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// Settings LoadConfig reads: the process environment, overridden by the
+// KEY=VALUE lines of CONFIG_FILE. The environment of a running process
+// can't change, so the file is what a SIGHUP reload picks edits up from.
+type configEnv struct {
+	file map[string]string
+}
+
+// Read a config file of KEY=VALUE lines; blank lines and lines starting
+// with # are skipped, and values may be wrapped in quotes. An empty path
+// leaves only the environment.
+func loadConfigEnv(path string) (configEnv, error) {
+	if path == "" {
+		return configEnv{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return configEnv{}, err
+	}
+
+	file := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, found := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return configEnv{}, fmt.Errorf("line %d: expected KEY=VALUE, got %q", i+1, line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		file[name] = value
+	}
+	return configEnv{file: file}, nil
+}
+
+// Value of the named setting, from the config file if it sets it
+func (env configEnv) get(name string) string {
+	if value, ok := env.file[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// Parse a positive duration from the named environment variable, leaving
+// target untouched when the variable is unset
+func durationFromEnv(env configEnv, name string, target *time.Duration) error {
+	value := env.get(name)
+	if value == "" {
+		return nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("invalid %s %q: must be positive", name, value)
+	}
+
+	*target = d
+	return nil
+}
+
+// Parse a non-negative integer from the named environment variable, leaving
+// target untouched when the variable is unset
+func intFromEnv(env configEnv, name string, target *int) error {
+	value := env.get(name)
+	if value == "" {
+		return nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid %s %q", name, value)
+	}
+
+	*target = n
+	return nil
+}
+
+// Parse a boolean from the named environment variable, leaving target
+// untouched when the variable is unset
+func boolFromEnv(env configEnv, name string, target *bool) error {
+	value := env.get(name)
+	if value == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+
+	*target = b
+	return nil
+}
+
+// Split a comma-separated pair list, normalizing and dropping empty entries
+func parsePairList(value string) []string {
+	var pairs []string
+	for _, pair := range strings.Split(value, ",") {
+		pair = normalizePair(pair)
+		if pair != "" {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// Check that every configured pair is one the service can resolve, reporting
+// all unknown pairs at once so a typo doesn't wait for a request to surface
+func validatePairs(cfg Config) error {
+	lists := []struct {
+		name  string
+		pairs []string
+	}{
+		{"DEFAULT_PAIRS", cfg.DefaultPairs},
+		{"WARM_PAIRS", cfg.WarmPairs},
+		{"SERVE_PAIRS", cfg.ServePairs},
+		{"DEPRECATED_PAIRS", cfg.DeprecatedPairs},
+		{"PROVIDER_PINS", slices.Sorted(maps.Keys(cfg.ProviderPins))},
+		{"DEEP_CHECK_PAIR", []string{cfg.DeepCheckPair}},
+	}
+
+	var invalid []string
+	for _, list := range lists {
+		for _, pair := range list.pairs {
+			if pair != "" && !slices.Contains(supportedPairs, pair) {
+				invalid = append(invalid, fmt.Sprintf("%s in %s", pair, list.name))
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("%w: %s (supported pairs: %s)", ErrUnsupportedPair,
+			strings.Join(invalid, ", "), strings.Join(supportedPairs, ", "))
+	}
+	return nil
+}
+
+// Bring a route prefix to the form "/a/b", or "" for the root
+func normalizeRoutePrefix(prefix string) string {
+	prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+// Parse a comma-separated list of CIDRs; bare IPs are treated as single hosts
+func parsePrefixList(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Parse "PAIR=provider" entries, e.g. "BTC/CHF=kraken,BTC/USD=coinbase"
+func parseProviderPins(value string) (map[string]string, error) {
+	pins := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		pair, name, ok := strings.Cut(item, "=")
+		pair = normalizePair(pair)
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || pair == "" {
+			return nil, fmt.Errorf("malformed entry %q", item)
+		}
+		if !isKnownProvider(name) {
+			return nil, fmt.Errorf("unknown provider %q", name)
+		}
+		pins[pair] = name
+	}
+	return pins, nil
+}
+
+// Parse "provider=duration" entries, e.g. "kraken=5s,coinbase=2s"
+func parseProviderTimeouts(value string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, item := range strings.Split(value, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		name, timeoutText, ok := strings.Cut(item, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("malformed entry %q", item)
+		}
+		if !isKnownProvider(name) {
+			return nil, fmt.Errorf("unknown provider %q", name)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(timeoutText))
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q for %s", timeoutText, name)
+		}
+		timeouts[name] = timeout
+	}
+	return timeouts, nil
+}
+
+func isKnownProvider(name string) bool {
+	for _, known := range knownProviders {
+		if known == name {
+			return true
+		}
+	}
+	return false
+}
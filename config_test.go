@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("PORT", "9000")
+	t.Setenv("CACHE_TTL", "5s")
+	t.Setenv("SERVE_PAIRS", " btc/usd, ,BTC/EUR")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if cfg.Port != "9000" {
+		t.Errorf("Expected port 9000, got %s", cfg.Port)
+	}
+
+	if cfg.CacheTTL != 5*time.Second {
+		t.Errorf("Expected TTL 5s, got %v", cfg.CacheTTL)
+	}
+
+	if len(cfg.ServePairs) != 2 || cfg.ServePairs[0] != "BTC/USD" || cfg.ServePairs[1] != "BTC/EUR" {
+		t.Errorf("Unexpected SERVE_PAIRS: %v", cfg.ServePairs)
+	}
+}
+
+func TestLoadConfig_InvalidTTL(t *testing.T) {
+	t.Setenv("CACHE_TTL", "soon")
+
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected error for invalid CACHE_TTL")
+	}
+}
+
+func TestParsePrefixList(t *testing.T) {
+	prefixes, err := parsePrefixList("10.0.0.0/8, 192.168.1.5")
+	if err != nil {
+		t.Fatalf("parsePrefixList failed: %v", err)
+	}
+
+	if len(prefixes) != 2 || prefixes[1].Bits() != 32 {
+		t.Errorf("Unexpected prefixes: %v", prefixes)
+	}
+
+	if _, err := parsePrefixList("not-a-cidr"); err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+}
+
+func TestParseProviderPins(t *testing.T) {
+	pins, err := parseProviderPins("btc/chf=kraken, BTC/USD = Coinbase")
+	if err != nil {
+		t.Fatalf("parseProviderPins failed: %v", err)
+	}
+
+	if pins["BTC/CHF"] != "kraken" || pins["BTC/USD"] != "coinbase" {
+		t.Errorf("Unexpected pins: %v", pins)
+	}
+
+	if _, err := parseProviderPins("BTC/USD=bitstamp"); err == nil {
+		t.Error("Expected error for unknown provider")
+	}
+
+	if _, err := parseProviderPins("BTC/USD"); err == nil {
+		t.Error("Expected error for malformed entry")
+	}
+}
+
+func TestParseProviderTimeouts(t *testing.T) {
+	timeouts, err := parseProviderTimeouts("kraken=5s, coinbase=250ms")
+	if err != nil {
+		t.Fatalf("parseProviderTimeouts failed: %v", err)
+	}
+
+	if timeouts["kraken"] != 5*time.Second || timeouts["coinbase"] != 250*time.Millisecond {
+		t.Errorf("Unexpected timeouts: %v", timeouts)
+	}
+
+	for _, value := range []string{"kraken", "bitstamp=1s", "kraken=-1s", "kraken=soon"} {
+		if _, err := parseProviderTimeouts(value); err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+}
+
+func TestLoadConfig_RefresherOnlyNeedsRefresher(t *testing.T) {
+	t.Setenv("FETCH_MODE", "refresher_only")
+
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected error for refresher_only without REFRESH_INTERVAL")
+	}
+
+	t.Setenv("REFRESH_INTERVAL", "10s")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.FetchMode != fetchModeRefresherOnly {
+		t.Errorf("Expected refresher_only, got %s", cfg.FetchMode)
+	}
+}
+
+func TestLoadConfig_ClockSkewMax(t *testing.T) {
+	t.Setenv("CLOCK_SKEW_TOLERANCE", "1h")
+	t.Setenv("CLOCK_SKEW_MAX", "10m")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected an error for CLOCK_SKEW_MAX below CLOCK_SKEW_TOLERANCE")
+	}
+
+	t.Setenv("CLOCK_SKEW_MAX", "48h")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.ClockSkewMax != 48*time.Hour {
+		t.Errorf("Expected 48h, got %v", cfg.ClockSkewMax)
+	}
+}
+
+func TestLoadConfig_PrimaryCurrency(t *testing.T) {
+	t.Setenv("PRIMARY_CURRENCY", "eur")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewServiceWithConfig(cfg)
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.LTP) != 1 || response.LTP[0].Pair != "BTC/EUR" {
+		t.Errorf("Expected only BTC/EUR, got %+v", response.LTP)
+	}
+
+	// An explicit DEFAULT_PAIRS takes precedence
+	t.Setenv("DEFAULT_PAIRS", "BTC/USD")
+	if cfg, err = LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.DefaultPairs) != 1 || cfg.DefaultPairs[0] != "BTC/USD" {
+		t.Errorf("Expected DEFAULT_PAIRS to win, got %v", cfg.DefaultPairs)
+	}
+}
+
+func TestLoadConfig_UnsupportedPrimaryCurrency(t *testing.T) {
+	t.Setenv("PRIMARY_CURRENCY", "JPY")
+
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected error for a currency without supported pairs")
+	}
+}
+
+func TestLoadConfig_GzipLevel(t *testing.T) {
+	t.Setenv("GZIP_LEVEL", "9")
+	t.Setenv("GZIP_MIN_SIZE", "256")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.GzipLevel != 9 || cfg.GzipMinSize != 256 {
+		t.Errorf("Expected level 9 and min size 256, got %d and %d", cfg.GzipLevel, cfg.GzipMinSize)
+	}
+
+	for _, level := range []string{"10", "-1"} {
+		t.Setenv("GZIP_LEVEL", level)
+		if _, err := LoadConfig(); err == nil {
+			t.Errorf("Expected error for GZIP_LEVEL %s", level)
+		}
+	}
+}
+
+func TestLoadConfig_RoutePrefix(t *testing.T) {
+	t.Setenv("ROUTE_PREFIX", "ltp-service/")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.RoutePrefix != "/ltp-service" || cfg.OpsRoutePrefix != "/ltp-service" {
+		t.Errorf("Expected both prefixes /ltp-service, got %q and %q", cfg.RoutePrefix, cfg.OpsRoutePrefix)
+	}
+
+	// Health and metrics can be kept at the root
+	t.Setenv("OPS_ROUTE_PREFIX", "/")
+	if cfg, err = LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.OpsRoutePrefix != "" {
+		t.Errorf("Expected empty ops prefix, got %q", cfg.OpsRoutePrefix)
+	}
+}
+
+func TestLoadConfig_ValidatePairs(t *testing.T) {
+	t.Setenv("DEFAULT_PAIRS", "BTC/USD,BTC/USX")
+	t.Setenv("WARM_PAIRS", "ETH/USD")
+
+	_, err := LoadConfig()
+	if !errors.Is(err, ErrUnsupportedPair) {
+		t.Fatalf("Expected ErrUnsupportedPair, got %v", err)
+	}
+	for _, want := range []string{"BTC/USX in DEFAULT_PAIRS", "ETH/USD in WARM_PAIRS", "BTC/USD, BTC/CHF, BTC/EUR"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got %q", want, err)
+		}
+	}
+
+	t.Setenv("DEFAULT_PAIRS", "")
+	t.Setenv("WARM_PAIRS", "")
+	t.Setenv("DEPRECATED_PAIRS", "BTC/GBX")
+	t.Setenv("PROVIDER_PINS", "BTC/USD=kraken,BTC/JPX=coinbase")
+	t.Setenv("DEEP_CHECK_PAIR", "BTC/USDX")
+
+	_, err = LoadConfig()
+	if !errors.Is(err, ErrUnsupportedPair) {
+		t.Fatalf("Expected ErrUnsupportedPair, got %v", err)
+	}
+	for _, want := range []string{"BTC/GBX in DEPRECATED_PAIRS", "BTC/JPX in PROVIDER_PINS", "BTC/USDX in DEEP_CHECK_PAIR"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got %q", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "BTC/USD in") {
+		t.Errorf("Expected the supported pin to pass, got %q", err)
+	}
+
+	// Validation can be turned off, e.g. for a pair list shared across deployments
+	t.Setenv("VALIDATE_PAIRS", "false")
+	if _, err := LoadConfig(); err != nil {
+		t.Errorf("Expected no error with VALIDATE_PAIRS=false, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// pollCursor records, per pair, the as_of of the price a client last
+// received. It travels as an opaque token: base64url-encoded JSON of
+// pair to Unix nanoseconds.
+type pollCursor map[string]int64
+
+// Parse a cursor from a previous response; an empty one starts a new poll
+func parseCursor(token string) (pollCursor, error) {
+	cursor := pollCursor{}
+	if token == "" {
+		return cursor, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	return cursor, nil
+}
+
+// Encode the cursor as an opaque token
+func (c pollCursor) String() string {
+	data, _ := json.Marshal(map[string]int64(c))
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Split the prices into the ones that changed since the cursor, and the
+// cursor for the next poll, which also remembers pairs not in this response
+func (c pollCursor) delta(ltpData []PairLTP) ([]PairLTP, pollCursor) {
+	next := make(pollCursor, len(c)+len(ltpData))
+	for pair, asOf := range c {
+		next[pair] = asOf
+	}
+
+	changed := []PairLTP{}
+	for _, ltp := range ltpData {
+		asOf := ltp.AsOf.UnixNano()
+		if last, seen := c[ltp.Pair]; !seen || asOf > last {
+			changed = append(changed, ltp)
+		}
+		next[ltp.Pair] = max(next[ltp.Pair], asOf)
+	}
+	return changed, next
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHandleLTP_CursorDelta(t *testing.T) {
+	service := NewService()
+	start := time.Now()
+	service.cache.data["BTC/USD"] = CacheEntry{ticker: Ticker{Last: 45000}, timestamp: start}
+	service.cache.data["BTC/EUR"] = CacheEntry{ticker: Ticker{Last: 41000}, timestamp: start}
+
+	poll := func(cursor string) LTPResponse {
+		req := httptest.NewRequest("GET", "/api/v1/ltp?pairs=BTC/USD,BTC/EUR&cursor="+url.QueryEscape(cursor), nil)
+		rec := httptest.NewRecorder()
+		service.handleLTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var response LTPResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Cursor == "" {
+			t.Fatal("Expected a cursor in the response")
+		}
+		return response
+	}
+
+	first := poll("")
+	if len(first.LTP) != 2 {
+		t.Fatalf("Expected both pairs on the first poll, got %d", len(first.LTP))
+	}
+
+	// Only BTC/USD moves before the next poll
+	service.cache.data["BTC/USD"] = CacheEntry{ticker: Ticker{Last: 45100}, timestamp: start.Add(time.Second)}
+
+	second := poll(first.Cursor)
+	if len(second.LTP) != 1 || second.LTP[0].Pair != "BTC/USD" {
+		t.Fatalf("Expected only BTC/USD on the second poll, got %+v", second.LTP)
+	}
+	if second.LTP[0].Amount.Value != 45100 {
+		t.Errorf("Expected amount 45100, got %v", second.LTP[0].Amount)
+	}
+
+	third := poll(second.Cursor)
+	if len(third.LTP) != 0 {
+		t.Errorf("Expected no pairs when nothing changed, got %d", len(third.LTP))
+	}
+}
+
+func TestHandleLTP_InvalidCursor(t *testing.T) {
+	service := NewService()
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?cursor=not-a-cursor!", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Outcome of the last canary fetch. It's reused until DeepCheckInterval has
+// passed, so however often probes ask, the upstream sees at most one canary
+// fetch per interval.
+type deepCheck struct {
+	// Semaphore of one guarding the outcome, held across the fetch so
+	// concurrent probes wait for one result
+	running chan struct{}
+
+	checkedAt time.Time
+	err       error
+}
+
+func newDeepCheck() *deepCheck {
+	return &deepCheck{running: make(chan struct{}, 1)}
+}
+
+// Fetch the canary pair end-to-end, through provider routing and parsing but
+// bypassing the price cache, and check the result is a usable price
+func (s *Service) checkCanary(ctx context.Context) error {
+	cfg := s.cfg()
+
+	// A probe that gives up waiting gets its own deadline's error
+	select {
+	case s.deepCheck.running <- struct{}{}:
+		defer func() { <-s.deepCheck.running }()
+	case <-ctx.Done():
+		return fmt.Errorf("canary %s: %w", cfg.DeepCheckPair, ctx.Err())
+	}
+
+	now := s.cache.Now()
+	if !s.deepCheck.checkedAt.IsZero() && now.Sub(s.deepCheck.checkedAt) < cfg.DeepCheckInterval {
+		return s.deepCheck.err
+	}
+
+	ticker, err := s.fetchTicker(ctx, cfg.DeepCheckPair)
+	if err == nil && ticker.Last <= 0 {
+		err = fmt.Errorf("implausible price %v", ticker.Last)
+	}
+	if err != nil {
+		err = fmt.Errorf("canary %s: %w", cfg.DeepCheckPair, err)
+	}
+
+	s.deepCheck.checkedAt = now
+	s.deepCheck.err = err
+	return err
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Kraken mock answering only the readiness ping
+func pingOnlyKrakenServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"error":[],"result":{"unixtime":1700000000}}`))
+	}))
+}
+
+func TestReadiness_DeepCheckReflectsCanary(t *testing.T) {
+	mockServer := pingOnlyKrakenServer()
+	defer mockServer.Close()
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"stub"}
+	canary := &stubProvider{name: "stub", err: errors.New("parse failure")}
+	service := serviceWithProviders(cfg, canary)
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service.cache.now = func() time.Time { return now }
+
+	readiness := func(query string) int {
+		req := httptest.NewRequest("GET", "/readiness"+query, nil)
+		rec := httptest.NewRecorder()
+		service.handleReadiness(rec, req)
+		return rec.Code
+	}
+
+	// The shallow check only pings and doesn't notice the broken fetch path
+	if code := readiness(""); code != http.StatusOK {
+		t.Errorf("Expected shallow check 200, got %d", code)
+	}
+	if code := readiness("?deep=true"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected deep check 503 on canary failure, got %d", code)
+	}
+
+	// Within the interval the previous outcome is reused without refetching
+	canary.err, canary.price = nil, 45000
+	if code := readiness("?deep=true"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected cached deep check 503, got %d", code)
+	}
+	if calls := canary.callCount(); calls != 1 {
+		t.Errorf("Expected 1 canary fetch, got %d", calls)
+	}
+
+	now = now.Add(cfg.DeepCheckInterval)
+	if code := readiness("?deep=true"); code != http.StatusOK {
+		t.Errorf("Expected deep check 200 after the canary recovered, got %d", code)
+	}
+	if calls := canary.callCount(); calls != 2 {
+		t.Errorf("Expected 2 canary fetches, got %d", calls)
+	}
+}
+
+func TestReadiness_DeepCheckRejectsZeroPrice(t *testing.T) {
+	mockServer := pingOnlyKrakenServer()
+	defer mockServer.Close()
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"stub"}
+	service := serviceWithProviders(cfg, &stubProvider{name: "stub"})
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/readiness?deep=true", nil)
+	rec := httptest.NewRecorder()
+	service.handleReadiness(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rec.Code)
+	}
+}
+
+func TestCheckCanary_WaitingProbeHonoursDeadline(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"gated"}
+	service := NewServiceWithConfig(cfg)
+	provider := &gatedProvider{release: make(chan struct{}), calls: make(map[string]int)}
+	service.providers = map[string]Provider{"gated": provider}
+
+	// The first probe holds the canary fetch until released
+	first := make(chan error, 1)
+	go func() { first <- service.checkCanary(context.Background()) }()
+	for {
+		provider.mu.Lock()
+		calls := provider.calls[cfg.DeepCheckPair]
+		provider.mu.Unlock()
+		if calls == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := service.checkCanary(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the waiting probe to hit its deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the waiting probe to return at its deadline, took %v", elapsed)
+	}
+
+	close(provider.release)
+	if err := <-first; err != nil {
+		t.Errorf("Expected the first probe to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Upstream error taxonomy. Handlers map these categories to HTTP statuses
+// through a configurable table, so the wire status is decoupled from how
+// the error was detected.
+var (
+	// ErrUpstreamMaintenance is returned when the upstream reports it is under
+	// maintenance or its markets are in a restricted system status
+	ErrUpstreamMaintenance = errors.New("upstream under maintenance")
+
+	// ErrUpstreamRateLimited is returned when the upstream rejects us for
+	// exceeding its rate limits
+	ErrUpstreamRateLimited = errors.New("upstream rate limit exceeded")
+
+	// ErrUnsupportedPair is returned for pairs a provider can't resolve
+	ErrUnsupportedPair = errors.New("unsupported pair")
+
+	// ErrPairNotWarm is returned in refresher-only mode, or when
+	// FALLBACK_ORDER leaves out live fetches, for pairs the refresher
+	// hasn't got a price for
+	ErrPairNotWarm = errors.New("pair not available: not kept warm by the refresher")
+
+	// ErrResponseBudgetExceeded is reported for pairs that weren't ready
+	// when the RESPONSE_BUDGET ran out and had nothing cached to fall back on
+	ErrResponseBudgetExceeded = errors.New("response budget exceeded")
+
+	// ErrUpstreamTimeout is returned when the deadline of a fetch ran out,
+	// or it was cancelled, before the upstream response was fully read
+	ErrUpstreamTimeout = errors.New("upstream timed out")
+)
+
+// Error categories used as keys of the status mapping
+const (
+	categoryMaintenance = "maintenance"
+	categoryRateLimit   = "rate_limit"
+	categoryUnsupported = "unsupported"
+	categoryNotWarm     = "not_warm"
+	categoryTimeout     = "timeout"
+	categoryUpstream    = "upstream"
+)
+
+// Default HTTP status per error category
+func defaultErrorStatuses() map[string]int {
+	return map[string]int{
+		categoryMaintenance: http.StatusServiceUnavailable,
+		categoryRateLimit:   http.StatusServiceUnavailable,
+		categoryUnsupported: http.StatusInternalServerError,
+		categoryNotWarm:     http.StatusServiceUnavailable,
+		categoryTimeout:     http.StatusGatewayTimeout,
+		categoryUpstream:    http.StatusInternalServerError,
+	}
+}
+
+// Classify an error into one of the categories. A joined error from a
+// multi-pair request takes the most specific category found.
+func errorCategory(err error) string {
+	switch {
+	case errors.Is(err, ErrUpstreamMaintenance):
+		return categoryMaintenance
+	case errors.Is(err, ErrUpstreamRateLimited):
+		return categoryRateLimit
+	case errors.Is(err, ErrUnsupportedPair):
+		return categoryUnsupported
+	case errors.Is(err, ErrPairNotWarm):
+		return categoryNotWarm
+	case errors.Is(err, ErrUpstreamTimeout):
+		return categoryTimeout
+	default:
+		return categoryUpstream
+	}
+}
+
+// Report a failed upstream call as ErrUpstreamTimeout when it failed because
+// its context ended or the HTTP client timed out, rather than as whatever
+// read or decode error that caused; other errors are returned unchanged
+func upstreamTimeout(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%w: %w", ErrUpstreamTimeout, ctxErr)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %w", ErrUpstreamTimeout, err)
+	}
+	return err
+}
+
+// HTTP status for an error according to the configured mapping
+func (s *Service) statusForError(err error) int {
+	category := errorCategory(err)
+	if status, ok := s.cfg().ErrorStatuses[category]; ok {
+		return status
+	}
+	return defaultErrorStatuses()[category]
+}
+
+// HTTP status for the error of a single-pair request: the client asked for
+// exactly one thing, so an unsupported pair is its mistake and any other
+// upstream failure a bad gateway. Other categories keep their mapping.
+func (s *Service) statusForPairError(err error) int {
+	switch errorCategory(err) {
+	case categoryUnsupported:
+		return http.StatusBadRequest
+	case categoryUpstream:
+		return http.StatusBadGateway
+	default:
+		return s.statusForError(err)
+	}
+}
+
+// Parse "category=status" overrides on top of the defaults,
+// e.g. "rate_limit=502,maintenance=503"
+func parseErrorStatuses(value string) (map[string]int, error) {
+	statuses := defaultErrorStatuses()
+	for _, item := range strings.Split(value, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		category, statusText, ok := strings.Cut(item, "=")
+		category = strings.ToLower(strings.TrimSpace(category))
+		if !ok {
+			return nil, fmt.Errorf("malformed entry %q", item)
+		}
+		if _, known := statuses[category]; !known {
+			return nil, fmt.Errorf("unknown error category %q", category)
+		}
+		status, err := strconv.Atoi(strings.TrimSpace(statusText))
+		if err != nil || status < 400 || status > 599 {
+			return nil, fmt.Errorf("invalid status %q for %s", statusText, category)
+		}
+		statuses[category] = status
+	}
+	return statuses, nil
+}
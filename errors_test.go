@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Mock Kraken server rejecting every request with a rate-limit error
+func rateLimitedKrakenServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(KrakenResponse{
+			Error: []string{"EAPI:Rate limit exceeded"},
+		})
+	}))
+}
+
+func TestHandleLTP_ErrorStatusMapping(t *testing.T) {
+	mockServer := rateLimitedKrakenServer()
+	defer mockServer.Close()
+
+	tests := []struct {
+		overrides string
+		expected  int
+	}{
+		{"", http.StatusServiceUnavailable},
+		{"rate_limit=502", http.StatusBadGateway},
+	}
+
+	for _, test := range tests {
+		statuses, err := parseErrorStatuses(test.overrides)
+		if err != nil {
+			t.Fatalf("parseErrorStatuses(%q) failed: %v", test.overrides, err)
+		}
+
+		cfg := DefaultConfig()
+		cfg.ErrorStatuses = statuses
+		service := NewServiceWithConfig(cfg)
+		service.krakenClient = mockServer.Client()
+		service.krakenBaseURL = mockServer.URL
+
+		req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+		rec := httptest.NewRecorder()
+		service.handleLTP(rec, req)
+
+		if rec.Code != test.expected {
+			t.Errorf("%q: expected status %d, got %d", test.overrides, test.expected, rec.Code)
+		}
+	}
+}
+
+func TestErrorCategory(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{ErrUpstreamMaintenance, categoryMaintenance},
+		{errors.Join(errors.New("other"), ErrUpstreamRateLimited), categoryRateLimit},
+		{ErrUnsupportedPair, categoryUnsupported},
+		{fmt.Errorf("failed to read response: %w", ErrUpstreamTimeout), categoryTimeout},
+		{errors.New("connection refused"), categoryUpstream},
+	}
+
+	for _, test := range tests {
+		if got := errorCategory(test.err); got != test.expected {
+			t.Errorf("errorCategory(%v) = %s; want %s", test.err, got, test.expected)
+		}
+	}
+}
+
+func TestFetchKrakenTickData_DeadlineDuringRead(t *testing.T) {
+	// Headers and the start of the body arrive, then the server stalls
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["45000`))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	service := NewService()
+	service.krakenClient = server.Client()
+	service.krakenBaseURL = server.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := service.fetchKrakenTickData(ctx, []string{"XXBTZUSD"})
+	if !errors.Is(err, ErrUpstreamTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected ErrUpstreamTimeout wrapping the deadline, got %v", err)
+	}
+	if status := service.statusForError(err); status != http.StatusGatewayTimeout {
+		t.Errorf("Expected status 504, got %d", status)
+	}
+}
+
+func TestParseErrorStatuses_Invalid(t *testing.T) {
+	for _, value := range []string{"rate_limit", "bogus=500", "rate_limit=200", "rate_limit=abc"} {
+		if _, err := parseErrorStatuses(value); err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+}
+
+func TestHandleLTP_SinglePairErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		err      error
+		expected int
+	}{
+		{"single unsupported", "pair=BTC/USD", fmt.Errorf("%w: BTC/USD", ErrUnsupportedPair), http.StatusBadRequest},
+		{"single upstream failure", "pair=BTC/USD", errors.New("connection reset"), http.StatusBadGateway},
+		{"multi-pair unsupported", "pairs=BTC/USD,BTC/EUR", ErrUnsupportedPair, http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		cfg := DefaultConfig()
+		cfg.Providers = []string{"stub"}
+		service := serviceWithProviders(cfg, &stubProvider{name: "stub", err: test.err})
+
+		req := httptest.NewRequest("GET", "/api/v1/ltp?"+test.query, nil)
+		rec := httptest.NewRecorder()
+		service.handleLTP(rec, req)
+
+		if rec.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.expected, rec.Code)
+		}
+		if strings.HasPrefix(test.query, "pair=") {
+			if body := rec.Body.String(); !strings.Contains(body, "BTC/USD") || strings.Contains(body, "failed to fetch any") {
+				t.Errorf("%s: expected the pair's own error, got %q", test.name, body)
+			}
+		}
+	}
+
+	// The generic error can be restored
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"stub"}
+	cfg.SinglePairErrors = false
+	service := serviceWithProviders(cfg, &stubProvider{name: "stub", err: errors.New("connection reset")})
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 with SINGLE_PAIR_ERRORS=false, got %d", rec.Code)
+	}
+}
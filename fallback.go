@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Sources a lookup can be answered from, tried in the configured order
+const (
+	fallbackCache    = "cache"    // Fresh cached entry
+	fallbackLive     = "live"     // Fetch from upstream
+	fallbackStale    = "stale"    // Expired entry within STALE_IF_ERROR
+	fallbackSnapshot = "snapshot" // Entry loaded from SNAPSHOT_PATH
+)
+
+var fallbackSources = []string{fallbackCache, fallbackLive, fallbackStale, fallbackSnapshot}
+
+// The order lookups used before it became configurable
+func defaultFallbackOrder() []string {
+	return []string{fallbackCache, fallbackLive, fallbackStale, fallbackSnapshot}
+}
+
+// Parse a FALLBACK_ORDER value, e.g. "live,cache,stale". Sources left out
+// are never used; each may appear once.
+func parseFallbackOrder(value string) ([]string, error) {
+	var order []string
+	for _, source := range strings.Split(value, ",") {
+		source = strings.ToLower(strings.TrimSpace(source))
+		if source == "" {
+			continue
+		}
+		if !slices.Contains(fallbackSources, source) {
+			return nil, fmt.Errorf("unknown source %q (expected %s)", source, strings.Join(fallbackSources, ", "))
+		}
+		if slices.Contains(order, source) {
+			return nil, fmt.Errorf("source %q listed twice", source)
+		}
+		order = append(order, source)
+	}
+	if len(order) == 0 {
+		return nil, fmt.Errorf("no sources listed")
+	}
+	return order, nil
+}
+
+// Answer a lookup from the first source in the fallback order that has the
+// pair, reporting which one through the cache status: fresh entries are
+// hits, fetches are misses, and stale or snapshot entries are stale (the
+// latter also carry the snapshot source). When none has it, the error of
+// the live fetch is returned, or ErrPairNotWarm if live isn't in the order.
+func (c *Cache) resolve(pair string, fetcher func() (Ticker, error)) (CacheEntry, string, error) {
+	order := c.FallbackOrder()
+
+	var fetchErr error
+	for i, source := range order {
+		switch source {
+		case fallbackCache:
+			if entry, ok := c.fresh(pair); ok {
+				c.recordHit(pair, entry)
+				return entry, cacheHit, nil
+			}
+		case fallbackLive:
+			reuseFresh := slices.Contains(order[:i], fallbackCache)
+			slowStale := slices.Contains(order[i+1:], fallbackStale)
+			entry, status, err := c.fetchLive(pair, reuseFresh, slowStale, fetcher)
+			if err == nil {
+				return entry, status, nil
+			}
+			fetchErr = err
+		case fallbackStale:
+			if entry, ok := c.staleEntry(pair); ok {
+				return entry, cacheStale, nil
+			}
+		case fallbackSnapshot:
+			if entry, ok := c.snapshotEntry(pair); ok {
+				return entry, cacheStale, nil
+			}
+		}
+	}
+
+	if fetchErr == nil {
+		fetchErr = fmt.Errorf("%w: %s", ErrPairNotWarm, pair)
+	}
+	return CacheEntry{}, cacheMiss, fetchErr
+}
+
+// FallbackOrder returns the sources lookups are answered from, in order
+func (c *Cache) FallbackOrder() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fallbackOrder == nil {
+		return defaultFallbackOrder()
+	}
+	return c.fallbackOrder
+}
+
+// SetFallbackOrder changes the sources lookups are answered from; nil
+// restores the default order
+func (c *Cache) SetFallbackOrder(order []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fallbackOrder = order
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseFallbackOrder(t *testing.T) {
+	order, err := parseFallbackOrder(" Live, cache ,stale")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !slices.Equal(order, []string{"live", "cache", "stale"}) {
+		t.Errorf("Expected [live cache stale], got %v", order)
+	}
+
+	for _, value := range []string{"cache,seed", "cache,live,cache", " , "} {
+		if _, err := parseFallbackOrder(value); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+}
+
+func TestGetLTP_FallbackOrder(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		order     []string
+		entry     CacheEntry // Cached before the lookup; zero means none
+		upstream  error
+		want      float64 // Zero means the lookup fails
+		wantState string
+		wantCalls int
+	}{
+		{
+			name:      "live before a fresh cache",
+			order:     []string{fallbackLive, fallbackCache},
+			entry:     CacheEntry{ticker: Ticker{Last: 100}, timestamp: now},
+			want:      200,
+			wantState: cacheMiss,
+			wantCalls: 1,
+		},
+		{
+			name:      "fresh cache when live fails",
+			order:     []string{fallbackLive, fallbackCache},
+			entry:     CacheEntry{ticker: Ticker{Last: 100}, timestamp: now},
+			upstream:  errors.New("down"),
+			want:      100,
+			wantState: cacheHit,
+			wantCalls: 1,
+		},
+		{
+			name:      "snapshot before live",
+			order:     []string{fallbackCache, fallbackSnapshot, fallbackLive},
+			entry:     CacheEntry{ticker: Ticker{Last: 90}, timestamp: now.Add(-time.Hour), source: sourceSnapshot},
+			want:      90,
+			wantState: cacheStale,
+			wantCalls: 0,
+		},
+		{
+			name:      "stale cache when live fails",
+			order:     []string{fallbackCache, fallbackLive, fallbackStale},
+			entry:     CacheEntry{ticker: Ticker{Last: 80}, timestamp: now.Add(-2 * time.Minute)},
+			upstream:  errors.New("down"),
+			want:      80,
+			wantState: cacheStale,
+			wantCalls: 1,
+		},
+		{
+			name:      "stale cache left out",
+			order:     []string{fallbackCache, fallbackLive, fallbackSnapshot},
+			entry:     CacheEntry{ticker: Ticker{Last: 80}, timestamp: now.Add(-2 * time.Minute)},
+			upstream:  errors.New("down"),
+			wantCalls: 1,
+		},
+		{
+			name:      "live left out",
+			order:     []string{fallbackCache, fallbackStale},
+			wantCalls: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		provider := &stubProvider{name: "stub", price: 200, err: tt.upstream}
+
+		cfg := DefaultConfig()
+		cfg.Providers = []string{"stub"}
+		cfg.StaleIfError = 10 * time.Minute
+		cfg.FallbackOrder = tt.order
+		service := serviceWithProviders(cfg, provider)
+		if !tt.entry.timestamp.IsZero() {
+			service.cache.data["BTC/USD"] = tt.entry
+		}
+
+		ltpData, err := service.getLTP(context.Background(), []string{"BTC/USD"}, IncludeOptions{})
+		if calls := provider.callCount(); calls != tt.wantCalls {
+			t.Errorf("%s: Expected %d upstream calls, got %d", tt.name, tt.wantCalls, calls)
+		}
+		if tt.want == 0 {
+			if err == nil {
+				t.Errorf("%s: Expected an error, got %v", tt.name, ltpData)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		if ltpData[0].Amount.Value != tt.want {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.want, ltpData[0].Amount)
+		}
+		if ltpData[0].cacheStatus != tt.wantState {
+			t.Errorf("%s: Expected cache status %s, got %s", tt.name, tt.wantState, ltpData[0].cacheStatus)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sample is a single recorded price
+type Sample struct {
+	Price float64
+	Time  time.Time
+}
+
+// History keeps a bounded ring buffer of recent samples per pair. The map
+// of buffers has its own lock and each buffer is guarded separately, so
+// recording one pair never waits on readers or writers of another.
+type History struct {
+	mu       sync.RWMutex
+	size     int
+	interval time.Duration
+	buffers  map[string]*ringBuffer
+
+	// Cap on samples across all pairs; zero is unbounded. Past it the
+	// oldest sample of any pair is evicted.
+	maxSamples int
+	total      atomic.Int64
+	evictMu    sync.Mutex
+}
+
+// ringBuffer holds up to size samples, overwriting the oldest. The backing
+// slice grows as samples arrive, so sparse pairs don't cost a full buffer.
+type ringBuffer struct {
+	mu      sync.Mutex
+	size    int
+	samples []Sample
+	start   int
+	count   int
+}
+
+// NewHistory creates a history keeping up to size samples per pair, at
+// most one per interval
+func NewHistory(size int, interval time.Duration) *History {
+	return &History{
+		size:     size,
+		interval: interval,
+		buffers:  make(map[string]*ringBuffer),
+	}
+}
+
+// SetMaxSamples caps the number of samples kept across all pairs
+func (h *History) SetMaxSamples(n int) {
+	h.evictMu.Lock()
+	h.maxSamples = n
+	h.evictMu.Unlock()
+	h.evict()
+}
+
+// Record a sample for the pair
+func (h *History) Record(pair string, price float64, at time.Time) {
+	if h.size <= 0 {
+		return
+	}
+
+	if h.buffer(pair, true).push(Sample{Price: price, Time: at}, h.interval) {
+		h.total.Add(1)
+		h.evict()
+	}
+}
+
+// Drop the oldest samples across all pairs until the total is within the cap
+func (h *History) evict() {
+	h.evictMu.Lock()
+	defer h.evictMu.Unlock()
+
+	for h.maxSamples > 0 && h.total.Load() > int64(h.maxSamples) {
+		var oldest *ringBuffer
+		var oldestTime time.Time
+
+		h.mu.RLock()
+		for _, buf := range h.buffers {
+			if sample, ok := buf.oldest(); ok && (oldest == nil || sample.Time.Before(oldestTime)) {
+				oldest, oldestTime = buf, sample.Time
+			}
+		}
+		h.mu.RUnlock()
+
+		if oldest == nil {
+			return
+		}
+		if oldest.dropOldest() {
+			h.total.Add(-1)
+		}
+	}
+}
+
+// Samples returns the pair's samples recorded after since, oldest first
+func (h *History) Samples(pair string, since time.Time) []Sample {
+	buf := h.buffer(pair, false)
+	if buf == nil {
+		return nil
+	}
+	return buf.since(since)
+}
+
+// PriceRange summarizes the samples within a window
+type PriceRange struct {
+	Low     float64
+	High    float64
+	Count   int
+	Partial bool // History doesn't reach back to the start of the window
+}
+
+// Range computes the low and high of the pair's samples after from. The
+// result is partial when no recorded sample predates the window, i.e. the
+// buffer can't vouch for the whole window.
+func (h *History) Range(pair string, from time.Time) PriceRange {
+	buf := h.buffer(pair, false)
+	if buf == nil {
+		return PriceRange{Partial: true}
+	}
+
+	r := PriceRange{Partial: true}
+	for _, sample := range buf.snapshot() {
+		if !sample.Time.After(from) {
+			r.Partial = false
+			continue
+		}
+		if r.Count == 0 || sample.Price < r.Low {
+			r.Low = sample.Price
+		}
+		if r.Count == 0 || sample.Price > r.High {
+			r.High = sample.Price
+		}
+		r.Count++
+	}
+	return r
+}
+
+// Volatility is the standard deviation of the relative changes between the
+// pair's last n samples. It needs at least three samples to be meaningful.
+func (h *History) Volatility(pair string, n int) (float64, bool) {
+	buf := h.buffer(pair, false)
+	if buf == nil {
+		return 0, false
+	}
+
+	samples := buf.snapshot()
+	if len(samples) > n {
+		samples = samples[len(samples)-n:]
+	}
+	if len(samples) < 3 {
+		return 0, false
+	}
+
+	returns := make([]float64, 0, len(samples)-1)
+	for i := 1; i < len(samples); i++ {
+		if samples[i-1].Price == 0 {
+			continue
+		}
+		returns = append(returns, samples[i].Price/samples[i-1].Price-1)
+	}
+	if len(returns) < 2 {
+		return 0, false
+	}
+
+	var mean float64
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	var variance float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	variance /= float64(len(returns))
+
+	return math.Sqrt(variance), true
+}
+
+// Pairs returns every pair with recorded history, sorted
+func (h *History) Pairs() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	pairs := make([]string, 0, len(h.buffers))
+	for pair := range h.buffers {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// Look up the pair's buffer, creating it when create is set
+func (h *History) buffer(pair string, create bool) *ringBuffer {
+	h.mu.RLock()
+	buf, exists := h.buffers[pair]
+	h.mu.RUnlock()
+	if exists || !create {
+		return buf
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Another recorder may have created it in the meantime
+	if buf, exists = h.buffers[pair]; !exists {
+		buf = &ringBuffer{size: h.size}
+		h.buffers[pair] = buf
+	}
+	return buf
+}
+
+// Append the sample unless it's within interval of the newest one,
+// reporting whether the buffer grew rather than overwrote its oldest sample
+func (b *ringBuffer) push(sample Sample, interval time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if interval > 0 && b.count > 0 {
+		newest := b.samples[(b.start+b.count-1)%len(b.samples)]
+		if sample.Time.Sub(newest.Time) < interval {
+			return false
+		}
+	}
+
+	// Until the slice is full, the live samples end at its end
+	if len(b.samples) < b.size {
+		b.samples = append(b.samples, sample)
+		b.count++
+		return true
+	}
+
+	end := (b.start + b.count) % len(b.samples)
+	b.samples[end] = sample
+	if b.count < len(b.samples) {
+		b.count++
+		return true
+	}
+	b.start = (b.start + 1) % len(b.samples)
+	return false
+}
+
+// The oldest sample, if any
+func (b *ringBuffer) oldest() (Sample, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.count == 0 {
+		return Sample{}, false
+	}
+	return b.samples[b.start], true
+}
+
+// Remove the oldest sample. Once at most half the slice is in use, the
+// live samples are copied into a right-sized one to give the memory back.
+func (b *ringBuffer) dropOldest() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.count == 0 {
+		return false
+	}
+	b.samples[b.start] = Sample{}
+	b.start = (b.start + 1) % len(b.samples)
+	b.count--
+
+	if b.count <= len(b.samples)/2 {
+		compacted := make([]Sample, b.count)
+		for i := range compacted {
+			compacted[i] = b.samples[(b.start+i)%len(b.samples)]
+		}
+		b.samples, b.start = compacted, 0
+	}
+	return true
+}
+
+// Copy out all samples, oldest first, as of a single point in time
+func (b *ringBuffer) snapshot() []Sample {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	result := make([]Sample, b.count)
+	for i := range result {
+		result[i] = b.samples[(b.start+i)%len(b.samples)]
+	}
+	return result
+}
+
+// Copy out the samples after since, oldest first
+func (b *ringBuffer) since(since time.Time) []Sample {
+	all := b.snapshot()
+	result := all[:0]
+	for _, sample := range all {
+		if sample.Time.After(since) {
+			result = append(result, sample)
+		}
+	}
+	return result
+}
+
+// History export structures
+type HistoryExport struct {
+	History []PairHistory `json:"history"`
+}
+
+type PairHistory struct {
+	Pair    string          `json:"pair"`
+	Samples []HistorySample `json:"samples"`
+}
+
+type HistorySample struct {
+	Amount Price     `json:"amount"`
+	Time   Timestamp `json:"time"`
+}
+
+// HTTP handler for /api/v1/ltp/history/export
+func (s *Service) handleHistoryExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var since time.Time
+	if sinceParam := r.URL.Query().Get("since"); sinceParam != "" {
+		parsed, err := time.Parse(time.RFC3339, sinceParam)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid since: %s", sinceParam), http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	pairs := s.history.Pairs()
+	if pairParam := r.URL.Query().Get("pair"); pairParam != "" {
+		pairs = []string{normalizePair(pairParam)}
+	}
+
+	export := HistoryExport{History: make([]PairHistory, 0, len(pairs))}
+	for _, pair := range pairs {
+		samples := s.history.Samples(pair, since)
+		if len(samples) == 0 {
+			continue
+		}
+
+		pairHistory := PairHistory{Pair: pair, Samples: make([]HistorySample, 0, len(samples))}
+		for _, sample := range samples {
+			pairHistory.Samples = append(pairHistory.Samples, HistorySample{
+				Amount: s.price(sample.Price),
+				Time:   Timestamp{Time: sample.Time},
+			})
+		}
+		export.History = append(export.History, pairHistory)
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		writeHistoryCSV(w, export)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(export); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// Write the export as CSV with one row per sample
+func writeHistoryCSV(w http.ResponseWriter, export HistoryExport) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"pair", "amount", "time"})
+	for _, pairHistory := range export.History {
+		for _, sample := range pairHistory.Samples {
+			cw.Write([]string{
+				pairHistory.Pair,
+				strconv.FormatFloat(sample.Amount.Value, 'f', -1, 64),
+				sample.Time.UTC().Format(time.RFC3339Nano),
+			})
+		}
+	}
+	cw.Flush()
+
+	if err := cw.Error(); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
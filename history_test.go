@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistory_RingBufferOverwritesOldest(t *testing.T) {
+	history := NewHistory(3, 0)
+	base := time.Now()
+
+	for i := 0; i < 5; i++ {
+		history.Record("BTC/USD", float64(100+i), base.Add(time.Duration(i)*time.Second))
+	}
+
+	samples := history.Samples("BTC/USD", time.Time{})
+	if len(samples) != 3 {
+		t.Fatalf("Expected 3 samples, got %d", len(samples))
+	}
+
+	for i, sample := range samples {
+		if sample.Price != float64(102+i) {
+			t.Errorf("Sample %d: expected %d, got %v", i, 102+i, sample.Price)
+		}
+	}
+}
+
+func TestHistory_SamplingInterval(t *testing.T) {
+	service := NewService()
+	service.history = NewHistory(10, 5*time.Second)
+
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	for i := 0; i < 4; i++ {
+		if _, err := service.fetchTicker(context.Background(), "BTC/USD"); err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+	}
+
+	if samples := service.history.Samples("BTC/USD", time.Time{}); len(samples) != 1 {
+		t.Errorf("Expected 1 sample within the sampling interval, got %d", len(samples))
+	}
+
+	// A sample past the interval is recorded again
+	service.history.Record("BTC/USD", 45000, time.Now().Add(6*time.Second))
+	if samples := service.history.Samples("BTC/USD", time.Time{}); len(samples) != 2 {
+		t.Errorf("Expected 2 samples after the interval, got %d", len(samples))
+	}
+}
+
+func TestHistory_ConcurrentRecordAndRead(t *testing.T) {
+	const size = 50
+	const writes = 500
+
+	history := NewHistory(size, 0)
+	base := time.Now()
+	pairs := []string{"BTC/USD", "BTC/EUR"}
+
+	var wg sync.WaitGroup
+	for _, pair := range pairs {
+		wg.Add(1)
+		go func(pair string) {
+			defer wg.Done()
+			// Each sample's price encodes its offset so readers can verify it
+			for i := 0; i < writes; i++ {
+				history.Record(pair, float64(i), base.Add(time.Duration(i)*time.Millisecond))
+			}
+		}(pair)
+	}
+
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				for _, pair := range pairs {
+					samples := history.Samples(pair, time.Time{})
+					if len(samples) > size {
+						t.Errorf("Expected at most %d samples, got %d", size, len(samples))
+						return
+					}
+					for j, sample := range samples {
+						if !sample.Time.Equal(base.Add(time.Duration(sample.Price) * time.Millisecond)) {
+							t.Errorf("Corrupted sample %+v", sample)
+							return
+						}
+						if j > 0 && sample.Price != samples[j-1].Price+1 {
+							t.Errorf("Expected consecutive samples, got %v after %v", sample.Price, samples[j-1].Price)
+							return
+						}
+					}
+					history.Range(pair, base)
+				}
+				history.Pairs()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for _, pair := range pairs {
+		samples := history.Samples(pair, time.Time{})
+		if len(samples) != size || samples[size-1].Price != writes-1 {
+			t.Errorf("%s: expected the last %d samples, got %d ending at %v", pair, size, len(samples), samples[len(samples)-1].Price)
+		}
+	}
+}
+
+func TestHandleHistoryExport(t *testing.T) {
+	service := NewService()
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	service.history.Record("BTC/USD", 45000, base)
+	service.history.Record("BTC/USD", 45100, base.Add(time.Minute))
+	service.history.Record("BTC/EUR", 42000, base)
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp/history/export", nil)
+	rec := httptest.NewRecorder()
+	service.handleHistoryExport(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var export HistoryExport
+	if err := json.NewDecoder(rec.Body).Decode(&export); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for _, pairHistory := range export.History {
+		counts[pairHistory.Pair] = len(pairHistory.Samples)
+	}
+	if counts["BTC/USD"] != 2 || counts["BTC/EUR"] != 1 {
+		t.Errorf("Expected both pairs' histories, got %v", counts)
+	}
+
+	// ?pair= and ?since= filter the export
+	req = httptest.NewRequest("GET", "/api/v1/ltp/history/export?pair=btc/usd&since=2024-03-01T12:00:30Z", nil)
+	rec = httptest.NewRecorder()
+	service.handleHistoryExport(rec, req)
+
+	export = HistoryExport{}
+	if err := json.NewDecoder(rec.Body).Decode(&export); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(export.History) != 1 || export.History[0].Pair != "BTC/USD" || len(export.History[0].Samples) != 1 {
+		t.Fatalf("Expected one filtered BTC/USD sample, got %+v", export.History)
+	}
+	if export.History[0].Samples[0].Amount.Value != 45100 {
+		t.Errorf("Expected the sample after since, got %v", export.History[0].Samples[0].Amount)
+	}
+}
+
+func TestHandleHistoryExport_CSV(t *testing.T) {
+	service := NewService()
+	service.history.Record("BTC/USD", 45000.5, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp/history/export", nil)
+	req.Header.Set("Accept", "text/csv")
+	rec := httptest.NewRecorder()
+	service.handleHistoryExport(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("Expected text/csv, got %s", ct)
+	}
+
+	expected := "pair,amount,time\nBTC/USD,45000.5,2024-03-01T12:00:00Z\n"
+	if rec.Body.String() != expected {
+		t.Errorf("Expected CSV %q, got %q", expected, rec.Body.String())
+	}
+
+	if strings.Contains(rec.Body.String(), "{") {
+		t.Error("Expected no JSON in CSV export")
+	}
+}
+
+func TestHistoryRange(t *testing.T) {
+	history := NewHistory(10, 0)
+	now := time.Now()
+
+	history.Record("BTC/USD", 44000, now.Add(-10*time.Minute))
+	history.Record("BTC/USD", 45500, now.Add(-4*time.Minute))
+	history.Record("BTC/USD", 44800, now.Add(-2*time.Minute))
+	history.Record("BTC/USD", 45100, now.Add(-time.Minute))
+
+	r := history.Range("BTC/USD", now.Add(-5*time.Minute))
+	if r.Low != 44800 || r.High != 45500 || r.Count != 3 || r.Partial {
+		t.Errorf("Unexpected 5m range: %+v", r)
+	}
+
+	// The buffer doesn't reach back an hour, so the range is flagged
+	r = history.Range("BTC/USD", now.Add(-time.Hour))
+	if r.Low != 44000 || r.High != 45500 || r.Count != 4 || !r.Partial {
+		t.Errorf("Unexpected 1h range: %+v", r)
+	}
+}
+
+func TestHandleLTP_IncludeRange(t *testing.T) {
+	service := NewService()
+	service.cache.ttl = time.Hour
+
+	// The window is measured on the service clock
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	service.cache.now = func() time.Time { return now }
+	service.cache.data["BTC/USD"] = CacheEntry{ticker: Ticker{Last: 45100}, timestamp: now}
+	service.history.Record("BTC/USD", 43000, now.Add(-10*time.Minute))
+	service.history.Record("BTC/USD", 45500, now.Add(-3*time.Minute))
+	service.history.Record("BTC/USD", 45100, now.Add(-time.Minute))
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&include=range&window=300s", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	ltp := response.LTP[0]
+	if ltp.Low == nil || ltp.Low.Value != 45100 || ltp.High == nil || ltp.High.Value != 45500 {
+		t.Errorf("Expected low 45100 and high 45500, got %v/%v", ltp.Low, ltp.High)
+	}
+	if ltp.RangePartial {
+		t.Error("Expected the window to be fully covered")
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&include=range&window=soon", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid window, got %d", rec.Code)
+	}
+}
+
+func TestHistory_GlobalCapEvictsOldestAcrossPairs(t *testing.T) {
+	history := NewHistory(10, 0)
+	history.SetMaxSamples(4)
+	base := time.Now()
+
+	history.Record("BTC/USD", 45000, base)
+	history.Record("BTC/EUR", 42000, base.Add(time.Second))
+	history.Record("BTC/USD", 45100, base.Add(2*time.Second))
+	history.Record("BTC/EUR", 42100, base.Add(3*time.Second))
+	history.Record("BTC/CHF", 41000, base.Add(4*time.Second))
+	history.Record("BTC/CHF", 41100, base.Add(5*time.Second))
+
+	usd := history.Samples("BTC/USD", time.Time{})
+	eur := history.Samples("BTC/EUR", time.Time{})
+	chf := history.Samples("BTC/CHF", time.Time{})
+
+	if total := len(usd) + len(eur) + len(chf); total != 4 {
+		t.Fatalf("Expected 4 samples in total, got %d", total)
+	}
+	if len(usd) != 1 || usd[0].Price != 45100 {
+		t.Errorf("Expected only the newer BTC/USD sample, got %+v", usd)
+	}
+	if len(eur) != 1 || eur[0].Price != 42100 {
+		t.Errorf("Expected only the newer BTC/EUR sample, got %+v", eur)
+	}
+	if len(chf) != 2 {
+		t.Errorf("Expected both BTC/CHF samples, got %+v", chf)
+	}
+
+	// A new sample for a pair can evict that same pair's oldest one
+	history.Record("BTC/USD", 45200, base.Add(6*time.Second))
+	usd = history.Samples("BTC/USD", time.Time{})
+	if len(usd) != 1 || usd[0].Price != 45200 {
+		t.Errorf("Expected only BTC/USD sample 45200, got %+v", usd)
+	}
+}
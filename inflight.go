@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// InFlightFetch is an upstream fetch that hasn't completed yet
+type InFlightFetch struct {
+	Pair           string  `json:"pair"`
+	RunningSeconds float64 `json:"running_seconds"`
+}
+
+type InFlightResponse struct {
+	Fetches []InFlightFetch `json:"fetches"`
+}
+
+// Run the fetcher, recording it as in flight for the pair until it returns.
+// Callers hold the pair's fetching lock, so there's at most one per pair.
+func (c *Cache) track(pair string, fetcher func() (Ticker, error)) (Ticker, error) {
+	c.mu.Lock()
+	if c.inFlight == nil {
+		c.inFlight = make(map[string]time.Time)
+	}
+	c.inFlight[pair] = c.Now()
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.inFlight, pair)
+		c.mu.Unlock()
+	}()
+
+	return fetcher()
+}
+
+// InFlight lists the fetches currently running, sorted by pair
+func (c *Cache) InFlight() []InFlightFetch {
+	now := c.Now()
+
+	c.mu.Lock()
+	fetches := make([]InFlightFetch, 0, len(c.inFlight))
+	for pair, started := range c.inFlight {
+		fetches = append(fetches, InFlightFetch{
+			Pair:           pair,
+			RunningSeconds: now.Sub(started).Seconds(),
+		})
+	}
+	c.mu.Unlock()
+
+	sort.Slice(fetches, func(i, j int) bool {
+		return fetches[i].Pair < fetches[j].Pair
+	})
+	return fetches
+}
+
+// HTTP handler for /debug/inflight on the admin listener, listing the pairs
+// being fetched from upstream right now and for how long
+func (s *Service) handleInFlight(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(InFlightResponse{Fetches: s.cache.InFlight()}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
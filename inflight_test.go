@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInFlight_ListsSlowFetch(t *testing.T) {
+	service := NewService()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go service.cache.GetOrFetch("BTC/USD", func() (float64, error) {
+		close(started)
+		<-release
+		return 45000, nil
+	})
+	<-started
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/inflight", nil)
+	w := httptest.NewRecorder()
+	service.adminRoutes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var response InFlightResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Fetches) != 1 || response.Fetches[0].Pair != "BTC/USD" {
+		t.Errorf("Expected BTC/USD in flight, got %+v", response.Fetches)
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for len(service.cache.InFlight()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected no fetches in flight after completion, got %+v", service.cache.InFlight())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestInFlight_RejectsNonGet(t *testing.T) {
+	service := NewService()
+
+	req := httptest.NewRequest(http.MethodPost, "/debug/inflight", nil)
+	w := httptest.NewRecorder()
+	service.adminRoutes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", w.Code)
+	}
+}
+
+func TestInFlight_NotOnPublicListener(t *testing.T) {
+	service := NewService()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/debug/inflight", nil)
+	w := httptest.NewRecorder()
+	service.routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 on the public listener, got %d", w.Code)
+	}
+}
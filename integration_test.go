@@ -53,8 +53,8 @@ func TestIntegrationLTPAllPairs(t *testing.T) {
 	for _, ltp := range response.LTP {
 		if _, exists := expectedPairs[ltp.Pair]; exists {
 			expectedPairs[ltp.Pair] = true
-			if ltp.Amount <= 0 {
-				t.Errorf("Invalid amount for %s: %f", ltp.Pair, ltp.Amount)
+			if ltp.Amount.Value <= 0 {
+				t.Errorf("Invalid amount for %s: %f", ltp.Pair, ltp.Amount.Value)
 			}
 		} else {
 			t.Errorf("Unexpected pair: %s", ltp.Pair)
@@ -102,8 +102,8 @@ func TestIntegrationLTPSinglePair(t *testing.T) {
 		t.Errorf("Expected BTC/USD, got %s", response.LTP[0].Pair)
 	}
 
-	if response.LTP[0].Amount <= 0 {
-		t.Errorf("Invalid amount: %f", response.LTP[0].Amount)
+	if response.LTP[0].Amount.Value <= 0 {
+		t.Errorf("Invalid amount: %f", response.LTP[0].Amount.Value)
 	}
 }
 
@@ -138,7 +138,7 @@ func TestIntegrationLTPMultiplePairs(t *testing.T) {
 
 	pairs := make(map[string]float64)
 	for _, ltp := range response.LTP {
-		pairs[ltp.Pair] = ltp.Amount
+		pairs[ltp.Pair] = ltp.Amount.Value
 	}
 
 	if _, exists := pairs["BTC/USD"]; !exists {
@@ -189,9 +189,9 @@ func TestIntegrationCaching(t *testing.T) {
 	resp2.Body.Close()
 
 	// Values should be the same (cached)
-	if response1.LTP[0].Amount != response2.LTP[0].Amount {
+	if response1.LTP[0].Amount.Value != response2.LTP[0].Amount.Value {
 		t.Errorf("Expected cached value, got different values: %f vs %f",
-			response1.LTP[0].Amount, response2.LTP[0].Amount)
+			response1.LTP[0].Amount.Value, response2.LTP[0].Amount.Value)
 	}
 
 	// Second request should be significantly faster (cached)
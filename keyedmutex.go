@@ -0,0 +1,44 @@
+package main
+
+import "sync"
+
+// keyedMutex hands out one mutex per key, so work on different keys runs in
+// parallel while work on the same key is serialized. Locks are reference
+// counted and dropped once no goroutine holds or waits on them.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// Lock the mutex for key, returning the function that unlocks it
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+	lock, exists := k.locks[key]
+	if !exists {
+		lock = &keyedLock{}
+		k.locks[key] = lock
+	}
+	lock.refs++
+	k.mu.Unlock()
+
+	lock.mu.Lock()
+
+	return func() {
+		lock.mu.Unlock()
+
+		k.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Default Kraken API base URL
+const defaultKrakenBaseURL = "https://api.kraken.com"
+
+// Kraken API response structures
+type KrakenResponse struct {
+	Error  []string                  `json:"error"`
+	Result map[string]KrakenTickData `json:"result"`
+}
+
+type KrakenTickData struct {
+	A []string `json:"a"` // Ask [price, whole lot volume, lot volume]
+	B []string `json:"b"` // Bid [price, whole lot volume, lot volume]
+	C []string `json:"c"` // Close price [price, lot volume]
+	P []string `json:"p"` // Volume weighted average price [today, last 24 hours]
+	V []string `json:"v"` // Volume [today, last 24 hours]
+}
+
+// RawTicker is Kraken's ticker data exactly as received, for debugging
+// discrepancies with the parsed values
+type RawTicker struct {
+	Close  []string `json:"close,omitempty"`
+	Bid    []string `json:"bid,omitempty"`
+	Ask    []string `json:"ask,omitempty"`
+	Volume []string `json:"volume,omitempty"`
+}
+
+// Kraken error messages reported during maintenance windows
+var krakenMaintenanceErrors = []string{
+	"EService:Unavailable",
+	"EService:Market in cancel_only mode",
+	"EService:Market in post_only mode",
+	"EService:Market in limit_only mode",
+}
+
+// Kraken error messages reported when we exceed its rate limits
+var krakenRateLimitErrors = []string{
+	"EAPI:Rate limit exceeded",
+	"EGeneral:Too many requests",
+	"EService:Throttled",
+}
+
+// Ticker holds the parsed ticker fields for a pair
+type Ticker struct {
+	Last      float64
+	Bid       float64
+	Ask       float64
+	VWAPToday float64
+	VWAP24h   float64
+
+	// Size of the last trade and volume over the last 24 hours; zero when
+	// upstream didn't report them
+	LastVolume float64
+	Volume24h  float64
+
+	// Set when the ticker combines several providers: how many returned a
+	// price and the spread between the highest and lowest of them
+	SampleCount int
+	Dispersion  float64
+
+	// Unparsed upstream data; only set by Kraken
+	Raw *RawTicker
+
+	// Fetched last price before EWMA smoothing; zero when not smoothed
+	Unsmoothed float64
+
+	// Name of the provider that supplied the ticker, or "aggregate" when it
+	// combines several
+	Provider string
+}
+
+// krakenAsset is how Kraken names one currency
+type krakenAsset struct {
+	code   string // Kraken's code, e.g. XBT for bitcoin
+	fiat   bool
+	legacy bool // Listed before Kraken dropped prefixes; has an X/Z-prefixed name
+}
+
+// Currencies the service can request from Kraken. Adding a pair means
+// adding its currencies here, with legacy set from the asset's name in
+// Kraken's /0/public/Assets (XXBT and ZUSD are legacy, CHF isn't).
+var krakenAssets = map[string]krakenAsset{
+	"BTC": {code: "XBT", legacy: true},
+	"USD": {code: "USD", fiat: true, legacy: true},
+	"EUR": {code: "EUR", fiat: true, legacy: true},
+	"CHF": {code: "CHF", fiat: true},
+}
+
+// Map internal pair names to Kraken pair names, or "" for pairs Kraken
+// can't be asked for
+func getKrakenPair(pair string) string {
+	base, quote, ok := splitPair(strings.ToUpper(pair))
+	if !ok {
+		return ""
+	}
+	baseAsset, baseKnown := krakenAssets[base]
+	quoteAsset, quoteKnown := krakenAssets[quote]
+	if !baseKnown || !quoteKnown || baseAsset.fiat || base == quote {
+		return ""
+	}
+	return krakenPairName(baseAsset, quoteAsset)
+}
+
+// Kraken's name for a pair. Pairs of two legacy assets join their prefixed
+// names, X for crypto and Z for fiat (XXBT + ZUSD = XXBTZUSD). Any pair with
+// a newer asset joins the plain codes instead (XBT + CHF = XBTCHF).
+func krakenPairName(base, quote krakenAsset) string {
+	if !base.legacy || !quote.legacy {
+		return base.code + quote.code
+	}
+	return krakenAssetPrefix(base) + base.code + krakenAssetPrefix(quote) + quote.code
+}
+
+func krakenAssetPrefix(asset krakenAsset) string {
+	if asset.fiat {
+		return "Z"
+	}
+	return "X"
+}
+
+// Fetch LTP from Kraken API
+func (s *Service) fetchLTPFromKraken(pair string) (float64, error) {
+	ticker, err := s.fetchTickerFromKraken(context.Background(), pair)
+	if err != nil {
+		return 0, err
+	}
+	return ticker.Last, nil
+}
+
+// Fetch the ticker for a pair from Kraken API
+func (s *Service) fetchTickerFromKraken(ctx context.Context, pair string) (Ticker, error) {
+	krakenPair := getKrakenPair(pair)
+	if krakenPair == "" {
+		return Ticker{}, fmt.Errorf("%w: %s", ErrUnsupportedPair, pair)
+	}
+
+	result, err := s.fetchKrakenTickData(ctx, []string{krakenPair})
+	if err != nil {
+		return Ticker{}, err
+	}
+
+	tickData, exists := result[krakenPair]
+	if !exists {
+		return Ticker{}, fmt.Errorf("no data for pair %s", pair)
+	}
+
+	return s.parseKrakenTicker(pair, tickData)
+}
+
+// Request the tick data of one or more Kraken pairs in a single call. With
+// RETRY_ON_PARSE_ERROR a response that isn't valid JSON, typically a
+// truncated one, is requested once more; valid JSON of the wrong shape
+// isn't retried, as asking again won't fix it.
+func (s *Service) fetchKrakenTickData(ctx context.Context, krakenPairs []string) (map[string]KrakenTickData, error) {
+	krakenResp, err := s.requestKrakenTicker(ctx, krakenPairs)
+	if err != nil && s.cfg().RetryOnParseError && isMalformedJSON(err) && ctx.Err() == nil {
+		log.Printf("Retrying Kraken request after a malformed response: %v", err)
+		krakenResp, err = s.requestKrakenTicker(ctx, krakenPairs)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if krakenErrs := krakenErrorsOnly(krakenResp.Error); len(krakenErrs) > 0 {
+		if matchesKrakenError(krakenErrs, krakenMaintenanceErrors) {
+			return nil, fmt.Errorf("Kraken API error %v: %w", krakenErrs, ErrUpstreamMaintenance)
+		}
+		if matchesKrakenError(krakenErrs, krakenRateLimitErrors) {
+			return nil, fmt.Errorf("Kraken API error %v: %w", krakenErrs, ErrUpstreamRateLimited)
+		}
+		return nil, fmt.Errorf("Kraken API error: %v", krakenErrs)
+	}
+
+	return krakenResp.Result, nil
+}
+
+// Whether decoding failed on the JSON syntax itself, e.g. a body cut short
+func isMalformedJSON(err error) bool {
+	var syntaxErr *json.SyntaxError
+	return errors.As(err, &syntaxErr)
+}
+
+// Make one Ticker request and decode the response
+func (s *Service) requestKrakenTicker(ctx context.Context, krakenPairs []string) (KrakenResponse, error) {
+	url := fmt.Sprintf("%s/0/public/Ticker?pair=%s", s.krakenURL(), strings.Join(krakenPairs, ","))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return KrakenResponse{}, err
+	}
+
+	// A fresh ID per call lets Kraken support find this exact request
+	if header := s.cfg().KrakenRequestIDHeader; header != "" {
+		requestID := newUUID()
+		req.Header.Set(header, requestID)
+		log.Printf("Kraken request %s=%s pairs=%s cid=%s", header, requestID, strings.Join(krakenPairs, ","), contextCorrelationID(ctx))
+	}
+
+	resp, err := s.krakenClient.Do(req)
+	if err != nil {
+		return KrakenResponse{}, fmt.Errorf("failed to fetch from Kraken: %w", upstreamTimeout(ctx, err))
+	}
+	defer resp.Body.Close()
+
+	// A deadline firing mid-body surfaces as a read error; report it as a timeout
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return KrakenResponse{}, fmt.Errorf("failed to read response: %w", upstreamTimeout(ctx, err))
+	}
+
+	var krakenResp KrakenResponse
+	if err := json.Unmarshal(body, &krakenResp); err != nil {
+		return KrakenResponse{}, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return krakenResp, nil
+}
+
+// Parse a pair's tick data, rejecting prices that can't be genuine
+func (s *Service) parseKrakenTicker(pair string, tickData KrakenTickData) (Ticker, error) {
+	ticker, err := parseTicker(pair, tickData)
+	if err != nil {
+		return Ticker{}, err
+	}
+
+	// A glitching upstream may report a zero price; only edge markets opt in
+	if ticker.Last < 0 || (ticker.Last == 0 && !s.cfg().AllowZeroPrice) {
+		return Ticker{}, fmt.Errorf("invalid price %v for pair %s", ticker.Last, pair)
+	}
+	return ticker, nil
+}
+
+// Kraken prefixes each entry of the error array with its severity: E for
+// errors, W for warnings that come with a usable result. Log the warnings
+// and return the errors.
+func krakenErrorsOnly(messages []string) []string {
+	var krakenErrs []string
+	for _, message := range messages {
+		if strings.HasPrefix(message, "W") {
+			log.Printf("Kraken API warning: %s", message)
+			continue
+		}
+		krakenErrs = append(krakenErrs, message)
+	}
+	return krakenErrs
+}
+
+// Check whether any of the Kraken errors starts with one of the known messages
+func matchesKrakenError(krakenErrors []string, known []string) bool {
+	for _, krakenErr := range krakenErrors {
+		for _, message := range known {
+			if strings.HasPrefix(krakenErr, message) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Parse the raw Kraken tick data into a Ticker. Every array is accessed
+// through tickerValue, so a malformed result yields an error, never a panic.
+func parseTicker(pair string, tickData KrakenTickData) (Ticker, error) {
+	price, ok, err := tickerValue(tickData.C, 0, "close price")
+	if err != nil {
+		return Ticker{}, fmt.Errorf("failed to parse price for pair %s: %w", pair, err)
+	}
+	if !ok {
+		return Ticker{}, fmt.Errorf("no close price for pair %s", pair)
+	}
+
+	ticker := Ticker{
+		Last: price,
+		Raw: &RawTicker{
+			Close:  tickData.C,
+			Bid:    tickData.B,
+			Ask:    tickData.A,
+			Volume: tickData.V,
+		},
+	}
+
+	// Bid and ask are optional; zero means Kraken didn't send them
+	if ticker.Bid, _, err = tickerValue(tickData.B, 0, "bid"); err != nil {
+		return Ticker{}, fmt.Errorf("failed to parse bid for pair %s: %w", pair, err)
+	}
+	if ticker.Ask, _, err = tickerValue(tickData.A, 0, "ask"); err != nil {
+		return Ticker{}, fmt.Errorf("failed to parse ask for pair %s: %w", pair, err)
+	}
+
+	// The close array is [price, lot volume]; older responses may omit the volume
+	if ticker.LastVolume, _, err = tickerValue(tickData.C, 1, "lot volume"); err != nil {
+		return Ticker{}, fmt.Errorf("failed to parse lot volume for pair %s: %w", pair, err)
+	}
+
+	// The volume array is [today, last 24 hours]
+	if ticker.Volume24h, _, err = tickerValue(tickData.V, 1, "volume 24h"); err != nil {
+		return Ticker{}, fmt.Errorf("failed to parse volume for pair %s: %w", pair, err)
+	}
+
+	// VWAP is optional; only use it when Kraken sent both values
+	today, hasToday, err := tickerValue(tickData.P, 0, "vwap today")
+	if err != nil {
+		return Ticker{}, fmt.Errorf("failed to parse vwap for pair %s: %w", pair, err)
+	}
+	last24h, has24h, err := tickerValue(tickData.P, 1, "vwap 24h")
+	if err != nil {
+		return Ticker{}, fmt.Errorf("failed to parse vwap for pair %s: %w", pair, err)
+	}
+	if hasToday && has24h {
+		ticker.VWAPToday, ticker.VWAP24h = today, last24h
+	}
+
+	return ticker, nil
+}
+
+// Parse the element at index of a Kraken ticker array. A missing or short
+// array reports ok=false; a present but unparsable element is an error.
+func tickerValue(values []string, index int, field string) (value float64, ok bool, err error) {
+	if index >= len(values) {
+		return 0, false, nil
+	}
+	raw := strings.TrimSpace(values[index])
+	if raw == "" {
+		return 0, false, fmt.Errorf("%s is empty", field)
+	}
+	value, err = strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s %q: %w", field, raw, err)
+	}
+	return value, true, nil
+}
+
+// Base URL for Kraken requests: the fastest probed host, if any
+func (s *Service) krakenURL() string {
+	if host := s.krakenHosts.Fastest(); host != "" {
+		return host
+	}
+	return s.krakenBaseURL
+}
+
+// Check that the Kraken public API responds
+func (s *Service) pingKraken(ctx context.Context) error {
+	return s.pingKrakenHost(ctx, s.krakenURL())
+}
+
+// Check that the Kraken public API responds on the given host
+func (s *Service) pingKrakenHost(ctx context.Context, host string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host+"/0/public/Time", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.krakenClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Kraken: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var krakenResp struct {
+		Error []string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&krakenResp); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if krakenErrs := krakenErrorsOnly(krakenResp.Error); len(krakenErrs) > 0 {
+		return fmt.Errorf("Kraken API error: %v", krakenErrs)
+	}
+
+	return nil
+}
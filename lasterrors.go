@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PairLastError is the most recent upstream error of a pair
+type PairLastError struct {
+	Pair      string    `json:"pair"`
+	LastError string    `json:"last_error"`
+	At        Timestamp `json:"at"`
+}
+
+type LastErrorsResponse struct {
+	Errors []PairLastError `json:"errors"`
+}
+
+// lastErrors keeps the most recent upstream error of each pair until the
+// pair's next successful fetch
+type lastErrors struct {
+	mu     sync.Mutex
+	errors map[string]PairLastError
+}
+
+// Record the outcome of fetching a pair: an error replaces the previous
+// one, a success clears it. Fetches abandoned by their caller say nothing
+// about upstream and are ignored.
+func (l *lastErrors) Record(pair string, err error, at time.Time) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err == nil {
+		delete(l.errors, pair)
+		return
+	}
+	if l.errors == nil {
+		l.errors = make(map[string]PairLastError)
+	}
+	l.errors[pair] = PairLastError{Pair: pair, LastError: err.Error(), At: Timestamp{Time: at}}
+}
+
+// List returns the recorded errors, sorted by pair
+func (l *lastErrors) List() []PairLastError {
+	l.mu.Lock()
+	list := make([]PairLastError, 0, len(l.errors))
+	for _, lastErr := range l.errors {
+		list = append(list, lastErr)
+	}
+	l.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Pair < list[j].Pair
+	})
+	return list
+}
+
+// HTTP handler for /debug/errors on the admin listener, listing the last
+// upstream error of every pair whose most recent fetch failed, even if a
+// cached price is still being served for it. The raw error text can name
+// upstream URLs, so it's never served publicly.
+func (s *Service) handleLastErrors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(LastErrorsResponse{Errors: s.lastErrors.List()}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleLastErrors(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"stub"}
+	provider := &stubProvider{name: "stub", price: 45000, err: errors.New("connection reset")}
+	service := serviceWithProviders(cfg, provider)
+
+	fetch := func() {
+		rec := httptest.NewRecorder()
+		service.handleLTP(rec, httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil))
+	}
+	lastErrors := func() []PairLastError {
+		rec := httptest.NewRecorder()
+		service.adminRoutes().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/errors", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+
+		var response LastErrorsResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response.Errors
+	}
+
+	fetch()
+	list := lastErrors()
+	if len(list) != 1 || list[0].Pair != "BTC/USD" {
+		t.Fatalf("Expected an error for BTC/USD, got %+v", list)
+	}
+	if !strings.Contains(list[0].LastError, "connection reset") {
+		t.Errorf("Expected the upstream error, got %q", list[0].LastError)
+	}
+	if list[0].At.IsZero() {
+		t.Error("Expected the time of the error")
+	}
+
+	// The next successful fetch clears it
+	provider.err = nil
+	fetch()
+	if list := lastErrors(); len(list) != 0 {
+		t.Errorf("Expected no errors after a success, got %+v", list)
+	}
+}
+
+func TestHandleLastErrors_NotOnPublicListener(t *testing.T) {
+	service := NewService()
+
+	rec := httptest.NewRecorder()
+	service.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/debug/errors", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 on the public listener, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// LTPRequestBody is the JSON body of POST /api/v1/ltp, for clients whose
+// pair lists don't fit comfortably in a query string
+type LTPRequestBody struct {
+	Pairs   []string `json:"pairs"`
+	Include []string `json:"include"`
+}
+
+// Explain a body decoding failure with where it happened, so clients can
+// find the mistake without guessing
+func describeJSONError(err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("malformed JSON at offset %d: %v", syntaxErr.Offset, syntaxErr)
+	case errors.As(err, &typeErr):
+		return fmt.Sprintf("field %q must be %s, got %s at offset %d", typeErr.Field, jsonTypeName(typeErr.Type.Kind()), typeErr.Value, typeErr.Offset)
+	case errors.Is(err, io.EOF):
+		return "body is empty"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "malformed JSON: body ends before the JSON object does"
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// DisallowUnknownFields has no error type of its own
+		return fmt.Sprintf("unknown field %s; expected pairs and include", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	default:
+		return err.Error()
+	}
+}
+
+// JSON name of the type a body field must have
+func jsonTypeName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.String:
+		return "a string"
+	default:
+		return kind.String()
+	}
+}
+
+// Turn a POST /api/v1/ltp request into the equivalent GET request. Other
+// query parameters (time_format, fields, ...) are kept. On failure the
+// error response has been written and ok is false.
+func (s *Service) ltpRequestFromBody(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return nil, false
+	}
+
+	maxBody := s.cfg().MaxBodySize
+	if r.ContentLength > maxBody {
+		http.Error(w, fmt.Sprintf("Request body too large: at most %d bytes allowed", maxBody), http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+
+	var body LTPRequestBody
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Request body too large: at most %d bytes allowed", maxBody), http.StatusRequestEntityTooLarge)
+			return nil, false
+		}
+		http.Error(w, "Invalid request body: "+describeJSONError(err), http.StatusBadRequest)
+		return nil, false
+	}
+	if decoder.More() {
+		http.Error(w, fmt.Sprintf("Invalid request body: unexpected data after the JSON object at offset %d", decoder.InputOffset()), http.StatusBadRequest)
+		return nil, false
+	}
+
+	query := r.URL.Query()
+	query.Del("pair")
+	query.Del("pairs")
+	query.Del("bases")
+	query.Del("quotes")
+	if len(body.Pairs) > 0 {
+		query.Set("pairs", strings.Join(body.Pairs, ","))
+	}
+	if body.Include != nil {
+		query.Set("include", strings.Join(body.Include, ","))
+	}
+
+	get := r.Clone(r.Context())
+	get.Method = http.MethodGet
+	get.URL.RawQuery = query.Encode()
+	get.Body = http.NoBody
+	return get, true
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleLTP_PostBody(t *testing.T) {
+	service := NewService()
+
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	body := `{"pairs": ["BTC/USD", "BTC/EUR"], "include": ["source"]}`
+	req := httptest.NewRequest("POST", "/api/v1/ltp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.LTP) != 2 {
+		t.Fatalf("Expected 2 pairs, got %d", len(response.LTP))
+	}
+	if response.LTP[0].Source != providerKraken {
+		t.Errorf("Expected source %s, got %q", providerKraken, response.LTP[0].Source)
+	}
+}
+
+func TestHandleLTP_PostWrongContentType(t *testing.T) {
+	service := NewService()
+
+	req := httptest.NewRequest("POST", "/api/v1/ltp", strings.NewReader("pairs=BTC/USD"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415, got %d", rec.Code)
+	}
+}
+
+func TestHandleLTP_PostBodyTooLarge(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxBodySize = 64
+	service := NewServiceWithConfig(cfg)
+
+	body := `{"pairs": ["` + strings.Repeat("BTC/USD", 20) + `"]}`
+	req := httptest.NewRequest("POST", "/api/v1/ltp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", rec.Code)
+	}
+
+	// Without a Content-Length the limit applies while reading
+	req = httptest.NewRequest("POST", "/api/v1/ltp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for a chunked body, got %d", rec.Code)
+	}
+}
+
+func TestHandleLTP_PostInvalidBody(t *testing.T) {
+	service := NewService()
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"malformed JSON", `{"pairs": ["BTC/USD",]}`, "malformed JSON at offset 22"},
+		{"unknown field", `{"pairs": ["BTC/USD"], "pair": "BTC/EUR"}`, `unknown field "pair"`},
+		{"wrong type", `{"pairs": "BTC/USD"}`, `field "pairs" must be an array, got string at offset 19`},
+		{"empty body", ``, "body is empty"},
+		{"trailing data", `{"pairs": ["BTC/USD"]} {}`, "unexpected data after the JSON object"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/api/v1/ltp", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		service.handleLTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: Expected status 400, got %d", tt.name, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%s: Expected the message to contain %q, got %q", tt.name, tt.want, rec.Body.String())
+		}
+	}
+}
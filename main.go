@@ -1,188 +1,695 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"unicode"
 )
 
 // Response structures
 type LTPResponse struct {
-	LTP []PairLTP `json:"ltp"`
+	LTP        []PairLTP   `json:"ltp"`
+	Errors     []PairError `json:"errors,omitempty"`
+	ServerTime *Timestamp  `json:"server_time,omitempty"` // Response time, for detecting clock skew
+	Digest     string      `json:"digest,omitempty"`      // Hash of the pairs and amounts, with ?include=digest
+	Cursor     string      `json:"cursor,omitempty"`      // Token for the next ?cursor= poll
+
+	fields []string // Restricts each pair to these JSON fields (?fields=)
+}
+
+// PairError reports why a requested pair couldn't be served
+type PairError struct {
+	Pair    string `json:"pair"`
+	Message string `json:"error"`
+
+	err error
 }
 
 type PairLTP struct {
-	Pair   string  `json:"pair"`
-	Amount float64 `json:"amount"`
+	Pair         string     `json:"pair"`
+	Base         string     `json:"base,omitempty"`
+	Quote        string     `json:"quote,omitempty"`
+	Amount       Price      `json:"amount"`
+	AsOf         Timestamp  `json:"as_of"`            // When the price was fetched from upstream
+	Source       string     `json:"source,omitempty"` // Set for non-live data, e.g. "snapshot", and with ?include=source
+	Stale        bool       `json:"stale,omitempty"`
+	VWAPToday    *Price     `json:"vwap_today,omitempty"`        // Only with ?include=vwap
+	VWAP24h      *Price     `json:"vwap_24h,omitempty"`          // Only with ?include=vwap
+	Bid          *Price     `json:"bid,omitempty"`               // Only with ?include=spread
+	Ask          *Price     `json:"ask,omitempty"`               // Only with ?include=spread
+	Spread       *Price     `json:"spread,omitempty"`            // Only with ?include=spread
+	SpreadBps    *float64   `json:"spread_bps,omitempty"`        // Only with ?include=spread
+	Low          *Price     `json:"low,omitempty"`               // Only with ?include=range
+	High         *Price     `json:"high,omitempty"`              // Only with ?include=range
+	RangePartial bool       `json:"range_partial,omitempty"`     // History doesn't cover the whole window
+	SampleCount  *int       `json:"sample_count,omitempty"`      // Only with ?include=confidence
+	Dispersion   *Price     `json:"dispersion,omitempty"`        // Only with ?include=confidence
+	Confidence   *float64   `json:"confidence_score,omitempty"`  // Only with ?include=confidence_score
+	Raw          *RawTicker `json:"raw,omitempty"`               // Only with ?include=raw
+	RawAmount    *Price     `json:"raw_amount,omitempty"`        // Only with ?include=raw and PRICE_SMOOTHING
+	TTLSeconds   *float64   `json:"ttl_seconds,omitempty"`       // Only with ?include=ttl
+	Deprecated   bool       `json:"deprecated,omitempty"`        // The pair is listed in DEPRECATED_PAIRS
+	Symbol       string     `json:"currency_symbol,omitempty"`   // Only with ?include=currency_symbol
+	LastVolume   *float64   `json:"last_trade_volume,omitempty"` // Only with ?include=last_volume
+
+	cacheStatus string // How the cache answered, for X-Cache-Status
 }
 
-// Kraken API response structures
-type KrakenResponse struct {
-	Error  []string                  `json:"error"`
-	Result map[string]KrakenTickData `json:"result"`
+// Price is a price that always serializes in plain decimal form, with at
+// most the number of significant digits it was created with (all of them
+// when zero). encoding/json switches to exponent notation for very small
+// or very large values, which some naive client parsers can't handle.
+type Price struct {
+	Value  float64
+	digits int
 }
 
-type KrakenTickData struct {
-	C []string `json:"c"` // Close price [price, lot volume]
+// Price of value encoded with PRICE_SIGNIFICANT_DIGITS
+func (s *Service) price(value float64) Price {
+	return Price{Value: value, digits: s.cfg().SignificantDigits}
 }
 
-// Service structure
-type Service struct {
-	krakenClient *http.Client
-	cache        *Cache
+// MarshalJSON encodes the price without scientific notation
+func (p Price) MarshalJSON() ([]byte, error) {
+	f := p.Value
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("unsupported price value: %v", f)
+	}
+	if p.digits > 0 {
+		f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', p.digits, 64), 64)
+	}
+	return []byte(strconv.FormatFloat(f, 'f', -1, 64)), nil
 }
 
-// Cache structure for rate limiting protection
-type Cache struct {
-	data map[string]CacheEntry
-	ttl  time.Duration
+// UnmarshalJSON accepts any JSON number
+func (p *Price) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &p.Value)
 }
 
-type CacheEntry struct {
-	value     float64
-	timestamp time.Time
+func (p Price) String() string {
+	return strconv.FormatFloat(p.Value, 'f', -1, 64)
 }
 
-// NewService creates a new service instance
-func NewService() *Service {
-	return &Service{
-		krakenClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		cache: &Cache{
-			data: make(map[string]CacheEntry),
-			ttl:  30 * time.Second, // Cache for 30 seconds
-		},
+// Another price of the entry, encoded like its amount
+func (ltp *PairLTP) price(value float64) *Price {
+	return &Price{Value: value, digits: ltp.Amount.digits}
+}
+
+// Supported timestamp serialization formats (?time_format=)
+const (
+	timeFormatRFC3339 = "rfc3339"
+	timeFormatUnixMs  = "unix_ms"
+)
+
+// Timestamp is a time that serializes either as an RFC3339 string (the
+// default) or as Unix epoch milliseconds, depending on its format.
+type Timestamp struct {
+	time.Time
+	format string
+}
+
+// MarshalJSON encodes the timestamp in its configured format
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.format == timeFormatUnixMs {
+		return []byte(strconv.FormatInt(t.UnixMilli(), 10)), nil
 	}
+	return json.Marshal(t.UTC().Format(time.RFC3339Nano))
 }
 
-// Get cached value or fetch new one
-func (c *Cache) GetOrFetch(pair string, fetcher func() (float64, error)) (float64, error) {
-	if entry, exists := c.data[pair]; exists {
-		if time.Since(entry.timestamp) < c.ttl {
-			return entry.value, nil
+// UnmarshalJSON accepts either an RFC3339 string or Unix epoch milliseconds
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var value string
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
 		}
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return err
+		}
+		*t = Timestamp{Time: parsed, format: timeFormatRFC3339}
+		return nil
 	}
 
-	value, err := fetcher()
+	ms, err := strconv.ParseInt(string(data), 10, 64)
 	if err != nil {
-		return 0, err
+		return fmt.Errorf("invalid timestamp %s", data)
 	}
+	*t = Timestamp{Time: time.UnixMilli(ms), format: timeFormatUnixMs}
+	return nil
+}
+
+// Pairs the service knows how to resolve, in default response order
+var supportedPairs = []string{"BTC/USD", "BTC/CHF", "BTC/EUR"}
+
+// Display symbols of quote currencies; currencies without one are shown by code
+var quoteSymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"CHF": "CHF",
+}
 
-	c.data[pair] = CacheEntry{
-		value:     value,
-		timestamp: time.Now(),
+// Display symbol for a quote currency
+func currencySymbol(quote string) string {
+	if symbol, ok := quoteSymbols[quote]; ok {
+		return symbol
 	}
+	return quote
+}
 
-	return value, nil
+// Supported pairs with the given quote currency, e.g. BTC/EUR for EUR
+func pairsQuotedIn(currency string) []string {
+	var pairs []string
+	for _, pair := range supportedPairs {
+		if _, quote, ok := splitPair(pair); ok && quote == currency {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
 }
 
-// Map internal pair names to Kraken pair names
-func getKrakenPair(pair string) string {
-	switch strings.ToUpper(pair) {
-	case "BTC/USD":
-		return "XXBTZUSD"
-	case "BTC/CHF":
-		return "XBTCHF"
-	case "BTC/EUR":
-		return "XXBTZEUR"
-	default:
-		return ""
+// Service structure
+type Service struct {
+	configMu       sync.RWMutex
+	config         Config
+	krakenClient   *http.Client
+	krakenBaseURL  string
+	krakenHosts    *latencyTracker
+	providers      map[string]Provider
+	providerHealth *providerHealth
+
+	// Duration of each provider's most recent call, for latency weighting
+	latencies *latencyTracker
+
+	// Semaphore bounding concurrent aggregate upstream calls; nil is unbounded
+	aggregateSlots chan struct{}
+	cache          *Cache
+	history        *History
+	metrics        Metrics
+
+	// Identical LTP requests in flight, when SHARE_RESPONSES is set
+	ltpResponses responseGroup
+
+	// Most recent upstream error per pair, for /debug/errors
+	lastErrors lastErrors
+
+	// Last canary outcome of /readiness?deep=true
+	deepCheck *deepCheck
+
+	// Smoothed upstream call latency per provider, for STALE_WHILE_SLOW
+	upstreamLatency upstreamLatencies
+
+	// Display decimals per pair learned from Kraken; nil disables rounding
+	decimalsMu   sync.RWMutex
+	pairDecimals map[string]int
+
+	shutdownCh   chan struct{}
+	shutdownOnce sync.Once
+}
+
+// NewService creates a new service instance with the default configuration
+func NewService() *Service {
+	return NewServiceWithConfig(DefaultConfig())
+}
+
+// NewServiceWithConfig creates a new service instance from the given configuration
+func NewServiceWithConfig(cfg Config) *Service {
+	if len(cfg.KrakenHosts) == 0 {
+		cfg.KrakenHosts = []string{defaultKrakenBaseURL}
 	}
+
+	s := &Service{
+		config: cfg,
+		krakenClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		krakenBaseURL:  cfg.KrakenHosts[0],
+		krakenHosts:    newLatencyTracker(cfg.KrakenHosts),
+		cache:          NewCache(cfg.CacheTTL),
+		history:        NewHistory(cfg.HistorySize, cfg.HistoryInterval),
+		metrics:        newMetrics(cfg.MetricsBackend),
+		providerHealth: newProviderHealth(cfg.ProviderFailureThreshold, cfg.ProviderCooldown),
+		latencies:      newLatencyTracker(nil),
+		deepCheck:      newDeepCheck(),
+		shutdownCh:     make(chan struct{}),
+	}
+
+	if cfg.AggregateConcurrency > 0 {
+		s.aggregateSlots = make(chan struct{}, cfg.AggregateConcurrency)
+	}
+
+	s.cache.SetStaleIfError(cfg.StaleIfError)
+	s.cache.SetTTLFunc(s.adaptiveTTL)
+	s.history.SetMaxSamples(cfg.HistoryMaxSamples)
+	s.cache.SetSoftTimeout(cfg.SoftTimeout)
+	s.cache.SetSyncRefreshAge(cfg.SyncRefreshAge)
+	s.cache.SetFallbackOrder(cfg.FallbackOrder)
+	s.cache.SetSmoothing(cfg.PriceSmoothing)
+	s.cache.SetPriceEpsilon(cfg.PriceEpsilon)
+	s.cache.SetClockSkewTolerance(cfg.ClockSkewTolerance)
+	s.cache.SetMaxClockSkew(cfg.ClockSkewMax)
+	s.cache.SetHitObserver(func(pair string, age time.Duration) {
+		s.metrics.ObserveHistogram("cache_hit_age_seconds", age.Seconds(), Labels{"pair": pair})
+	})
+
+	s.providers = map[string]Provider{
+		providerKraken: krakenProvider{s},
+		providerCoinbase: &coinbaseProvider{
+			client:  &http.Client{Timeout: 10 * time.Second},
+			baseURL: cfg.CoinbaseBaseURL,
+		},
+	}
+	if cfg.ScriptedPrices != nil {
+		s.providers[providerScripted] = NewScriptedProvider(providerScripted, cfg.ScriptedPrices, cfg.ScriptedLoop)
+	}
+
+	return s
 }
 
-// Fetch LTP from Kraken API
-func (s *Service) fetchLTPFromKraken(pair string) (float64, error) {
-	krakenPair := getKrakenPair(pair)
-	if krakenPair == "" {
-		return 0, fmt.Errorf("unsupported pair: %s", pair)
+// Normalize a client-supplied pair name. The query string is already
+// decoded once; clients that encode the slash twice (BTC%252FUSD) still
+// leave an escape behind, which is decoded here.
+func normalizePair(pair string) string {
+	if strings.Contains(pair, "%") {
+		if unescaped, err := url.PathUnescape(pair); err == nil {
+			pair = unescaped
+		}
 	}
+	return strings.ToUpper(strings.Map(dropInvisible, pair))
+}
 
-	url := fmt.Sprintf("https://api.kraken.com/0/public/Ticker?pair=%s", krakenPair)
+// Drop whitespace (including NBSP and line breaks), control characters and
+// invisible formatting characters such as zero-width spaces and BOMs, none of
+// which can be part of a pair name
+func dropInvisible(r rune) rune {
+	if unicode.IsSpace(r) || unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+		return -1
+	}
+	return r
+}
 
-	resp, err := s.krakenClient.Get(url)
-	if err != nil {
-		return 0, fmt.Errorf("failed to fetch from Kraken: %w", err)
+// Split a normalized pair into its base and quote currencies. Malformed
+// pairs (no separator, empty side, or extra separators) aren't split.
+func splitPair(pair string) (base, quote string, ok bool) {
+	base, quote, found := strings.Cut(pair, "/")
+	if !found || base == "" || quote == "" || strings.Contains(quote, "/") {
+		return "", "", false
 	}
-	defer resp.Body.Close()
+	return base, quote, true
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return 0, fmt.Errorf("failed to read response: %w", err)
+// Check whether the pair is allowed by the SERVE_PAIRS allowlist
+func (s *Service) isPairServed(pair string) bool {
+	servePairs := s.cfg().ServePairs
+	if len(servePairs) == 0 {
+		return true
+	}
+	for _, allowed := range servePairs {
+		if allowed == pair {
+			return true
+		}
 	}
+	return false
+}
+
+// Expand comma-separated bases and quotes into their cross product. Only
+// supported, served pairs are returned; the other combinations are reported
+// as errors.
+func (s *Service) expandPairs(bases, quotes string) ([]string, []PairError) {
+	var pairs []string
+	var pairErrs []PairError
+
+	for _, base := range strings.Split(bases, ",") {
+		base = normalizePair(base)
+		if base == "" {
+			continue
+		}
+		for _, quote := range strings.Split(quotes, ",") {
+			quote = normalizePair(quote)
+			if quote == "" {
+				continue
+			}
 
-	var krakenResp KrakenResponse
-	if err := json.Unmarshal(body, &krakenResp); err != nil {
-		return 0, fmt.Errorf("failed to parse response: %w", err)
+			pair := base + "/" + quote
+			if !slices.Contains(supportedPairs, pair) || !s.isPairServed(pair) {
+				err := fmt.Errorf("%w: %s", ErrUnsupportedPair, pair)
+				pairErrs = append(pairErrs, PairError{Pair: pair, Message: err.Error(), err: err})
+				continue
+			}
+			pairs = append(pairs, pair)
+		}
 	}
+	return pairs, pairErrs
+}
 
-	if len(krakenResp.Error) > 0 {
-		return 0, fmt.Errorf("Kraken API error: %v", krakenResp.Error)
+// Default pairs for a bare request, restricted to the allowlist
+func (s *Service) defaultPairs() []string {
+	candidates := s.cfg().DefaultPairs
+	if len(candidates) == 0 {
+		candidates = supportedPairs
 	}
 
-	tickData, exists := krakenResp.Result[krakenPair]
-	if !exists {
-		return 0, fmt.Errorf("no data for pair %s", pair)
+	pairs := make([]string, 0, len(candidates))
+	for _, pair := range candidates {
+		if s.isPairServed(pair) {
+			pairs = append(pairs, pair)
+		}
 	}
+	return pairs
+}
 
-	if len(tickData.C) == 0 {
-		return 0, fmt.Errorf("no close price for pair %s", pair)
+// Pairs the background refresher keeps warm
+func (s *Service) warmPairs() []string {
+	warmPairs := s.cfg().WarmPairs
+	if len(warmPairs) == 0 {
+		return s.defaultPairs()
 	}
+	return warmPairs
+}
 
-	price, err := strconv.ParseFloat(tickData.C[0], 64)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse price: %w", err)
+// Optional response fields requested via ?include=
+type IncludeOptions struct {
+	VWAP       bool
+	Spread     bool
+	Range      bool
+	Confidence bool
+	Raw        bool
+	ServerTime bool
+	Source     bool
+	TTL        bool
+	Digest     bool
+	Symbol     bool
+	LastVolume bool
+	Score      bool
+}
+
+// Include set of a request: its include parameter if it passes one, even an
+// empty one, and the configured default otherwise
+func requestInclude(query url.Values, defaults IncludeOptions) (IncludeOptions, error) {
+	values, given := query["include"]
+	if !given {
+		return defaults, nil
 	}
+	return parseInclude(values[0])
+}
 
-	return price, nil
+// Parse a comma-separated include parameter, rejecting unknown flags.
+// "none" stands for the empty set and can't be combined with other flags.
+func parseInclude(value string) (IncludeOptions, error) {
+	var include IncludeOptions
+	fields := strings.Split(value, ",")
+	for _, field := range fields {
+		switch field = strings.ToLower(strings.TrimSpace(field)); field {
+		case "":
+		case "none":
+			if len(fields) > 1 {
+				return IncludeOptions{}, fmt.Errorf("include flag %q can't be combined with others", field)
+			}
+		case "vwap":
+			include.VWAP = true
+		case "spread":
+			include.Spread = true
+		case "range":
+			include.Range = true
+		case "confidence":
+			include.Confidence = true
+		case "raw":
+			include.Raw = true
+		case "server_time":
+			include.ServerTime = true
+		case "source":
+			include.Source = true
+		case "ttl":
+			include.TTL = true
+		case "digest":
+			include.Digest = true
+		case "currency_symbol":
+			include.Symbol = true
+		case "last_volume":
+			include.LastVolume = true
+		case "confidence_score":
+			include.Score = true
+		default:
+			return IncludeOptions{}, fmt.Errorf("unknown include flag %q", field)
+		}
+	}
+	return include, nil
 }
 
 // Get LTP for a single pair or multiple pairs
-func (s *Service) getLTP(pairs []string) ([]PairLTP, error) {
+func (s *Service) getLTP(ctx context.Context, pairs []string, include IncludeOptions) ([]PairLTP, error) {
+	result, pairErrs := s.collectLTP(ctx, pairs, include)
+	if len(result) == 0 {
+		return nil, joinPairErrors(pairErrs)
+	}
+	return result, nil
+}
+
+// Get LTP for each pair, reporting the pairs that failed separately
+func (s *Service) collectLTP(ctx context.Context, pairs []string, include IncludeOptions) ([]PairLTP, []PairError) {
 	result := make([]PairLTP, 0, len(pairs))
+	var pairErrs []PairError
+
+	// With a soft timeout a fetch may outlive the request to warm the cache,
+	// so it can't be cancelled along with it
+	fetchCtx := ctx
+	if s.cfg().SoftTimeout > 0 {
+		fetchCtx = context.WithoutCancel(ctx)
+	}
 
 	for _, pair := range pairs {
-		pair = strings.ToUpper(strings.TrimSpace(pair))
+		pair = normalizePair(pair)
 
-		amount, err := s.cache.GetOrFetch(pair, func() (float64, error) {
-			return s.fetchLTPFromKraken(pair)
+		// A forced provider is asked directly, so neither its answer nor a
+		// cached price from another provider stands in for the other
+		if name := providerOverride(ctx); name != "" {
+			ticker, err := s.fetchFromOverride(ctx, name, pair)
+			if err != nil {
+				log.Printf("Error fetching LTP for %s from %s: %v", pair, name, err)
+				pairErrs = append(pairErrs, PairError{Pair: pair, Message: err.Error(), err: err})
+				continue
+			}
+			entry := CacheEntry{ticker: ticker, timestamp: s.cache.Now()}
+			result = append(result, s.pairLTP(pair, entry, cacheMiss, include))
+			continue
+		}
+
+		entry, cacheStatus, err := s.cache.GetOrFetchEntry(pair, func() (Ticker, error) {
+			// Misses are never fetched on demand in refresher-only mode
+			if s.cfg().FetchMode == fetchModeRefresherOnly {
+				return Ticker{}, fmt.Errorf("%w: %s", ErrPairNotWarm, pair)
+			}
+			if err := sleepContext(fetchCtx, s.cfg().FetchDelay); err != nil {
+				return Ticker{}, err
+			}
+			return s.fetchTicker(fetchCtx, pair)
 		})
 
 		if err != nil {
 			log.Printf("Error fetching LTP for %s: %v", pair, err)
+			pairErrs = append(pairErrs, PairError{Pair: pair, Message: err.Error(), err: err})
 			continue
 		}
 
-		result = append(result, PairLTP{
-			Pair:   pair,
-			Amount: amount,
-		})
+		result = append(result, s.pairLTP(pair, entry, cacheStatus, include))
 	}
 
-	if len(result) == 0 {
-		return nil, fmt.Errorf("failed to fetch any LTP data")
+	s.metrics.SetGauge("cache_entries", float64(s.cache.Len()), nil)
+	return result, pairErrs
+}
+
+// Build the response entry for a pair from its cache entry
+func (s *Service) pairLTP(pair string, entry CacheEntry, cacheStatus string, include IncludeOptions) PairLTP {
+	if decimals, ok := s.decimalsFor(pair); ok {
+		entry.ticker = entry.ticker.rounded(decimals)
 	}
 
-	return result, nil
+	base, quote, _ := splitPair(pair)
+	ltp := PairLTP{
+		Pair:   pair,
+		Base:   base,
+		Quote:  quote,
+		Amount: s.price(entry.ticker.Last),
+		AsOf:   Timestamp{Time: entry.asOf()},
+		Source: entry.source,
+		Stale:  cacheStatus == cacheStale,
+
+		Deprecated: slices.Contains(s.cfg().DeprecatedPairs, pair),
+
+		cacheStatus: cacheStatus,
+	}
+
+	if include.VWAP && entry.ticker.VWAP24h > 0 {
+		ltp.VWAPToday = ltp.price(entry.ticker.VWAPToday)
+		ltp.VWAP24h = ltp.price(entry.ticker.VWAP24h)
+	}
+
+	if include.Spread && entry.ticker.Bid > 0 && entry.ticker.Ask > 0 {
+		ltp.setSpread(entry.ticker.Bid, entry.ticker.Ask)
+	}
+
+	if include.Confidence {
+		ltp.setConfidence(entry.ticker)
+	}
+
+	if include.Score {
+		cfg := s.cfg()
+		age := s.cache.Now().Sub(entry.timestamp)
+		score := confidenceScore(cfg.ConfidenceWeights, cfg.ConfidenceMaxAge, age, entry.ticker, ltp.Stale)
+		ltp.Confidence = &score
+	}
+
+	if include.Source && ltp.Source == "" {
+		ltp.Source = entry.ticker.Provider
+	}
+
+	if include.LastVolume && entry.ticker.LastVolume > 0 {
+		lastVolume := entry.ticker.LastVolume
+		ltp.LastVolume = &lastVolume
+	}
+
+	if include.Symbol {
+		ltp.Symbol = currencySymbol(quote)
+	}
+
+	if include.TTL {
+		ttlSeconds := s.cache.TTLOf(entry).Seconds()
+		ltp.TTLSeconds = &ttlSeconds
+	}
+
+	if include.Raw {
+		ltp.Raw = entry.ticker.Raw
+		if entry.ticker.Unsmoothed > 0 {
+			ltp.RawAmount = ltp.price(entry.ticker.Unsmoothed)
+		}
+	}
+
+	return ltp
 }
 
-// HTTP handler for /api/v1/ltp
+// Wait for d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Combine per-pair failures into the error reported when nothing succeeded
+func joinPairErrors(pairErrs []PairError) error {
+	errs := make([]error, len(pairErrs))
+	for i, pairErr := range pairErrs {
+		errs[i] = pairErr.err
+	}
+	return fmt.Errorf("failed to fetch any LTP data: %w", errors.Join(errs...))
+}
+
+// Fill in how many providers the price is based on and how far apart they
+// were. A price from a single provider counts as one sample with no dispersion.
+func (ltp *PairLTP) setConfidence(ticker Ticker) {
+	count, dispersion := ticker.SampleCount, ticker.Dispersion
+	if count == 0 {
+		count, dispersion = 1, 0
+	}
+	ltp.SampleCount = &count
+	ltp.Dispersion = ltp.price(dispersion)
+}
+
+// Fill in bid, ask and the spread, both absolute and in basis points of the mid price
+func (ltp *PairLTP) setSpread(bid, ask float64) {
+	ltp.Bid = ltp.price(bid)
+	ltp.Ask = ltp.price(ask)
+	ltp.Spread = ltp.price(ask - bid)
+
+	mid := (ask + bid) / 2
+	if mid <= 0 {
+		return
+	}
+	bps := (ask - bid) / mid * 10000
+	ltp.SpreadBps = &bps
+}
+
+// Default window for ?include=range
+const defaultRangeWindow = 5 * time.Minute
+
+// Fill in the low and high observed since the start of the window from the
+// price history
+func (ltp *PairLTP) setRange(history *History, since time.Time) {
+	r := history.Range(ltp.Pair, since)
+	if r.Count == 0 {
+		return
+	}
+
+	ltp.Low = ltp.price(r.Low)
+	ltp.High = ltp.price(r.High)
+	ltp.RangePartial = r.Partial
+}
+
+// HTTP handler for /api/v1/ltp. POST takes the pairs and include flags as
+// a JSON body and is otherwise served like GET.
 func (s *Service) handleLTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		get, ok := s.ltpRequestFromBody(w, r)
+		if !ok {
+			return
+		}
+		r = get
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	if s.cfg().ShareResponses {
+		s.serveSharedLTP(w, r)
+		return
+	}
+	s.serveLTP(w, r)
+}
+
+// Compute and write the response to an LTP request
+func (s *Service) serveLTP(w http.ResponseWriter, r *http.Request) {
 	// Parse query parameters
 	pairParam := r.URL.Query().Get("pair")
 	pairsParam := r.URL.Query().Get("pairs")
+	basesParam := r.URL.Query().Get("bases")
+	quotesParam := r.URL.Query().Get("quotes")
 
 	var pairs []string
+	var pairErrs []PairError
 
 	if pairParam != "" {
 		// Single pair
@@ -190,31 +697,371 @@ func (s *Service) handleLTP(w http.ResponseWriter, r *http.Request) {
 	} else if pairsParam != "" {
 		// Multiple pairs (comma-separated)
 		pairs = strings.Split(pairsParam, ",")
+	} else if basesParam != "" || quotesParam != "" {
+		// Cross product of bases and quotes
+		if basesParam == "" || quotesParam == "" {
+			http.Error(w, "bases and quotes must be used together", http.StatusBadRequest)
+			return
+		}
+		pairs, pairErrs = s.expandPairs(basesParam, quotesParam)
+		if len(pairs) == 0 {
+			http.Error(w, "No supported pairs for the requested bases and quotes", http.StatusBadRequest)
+			return
+		}
+	} else if s.cfg().RequireExplicitPairs {
+		http.Error(w, "No pairs requested: pass pair, pairs, or bases and quotes", http.StatusBadRequest)
+		return
 	} else {
-		// Default to all supported pairs
-		pairs = []string{"BTC/USD", "BTC/CHF", "BTC/EUR"}
+		// Default to all served pairs
+		pairs = s.defaultPairs()
 	}
 
-	// Get LTP data
-	ltpData, err := s.getLTP(pairs)
+	if maxPairs := s.cfg().MaxPairs; maxPairs > 0 && len(pairs) > maxPairs {
+		http.Error(w, fmt.Sprintf("Too many pairs: %d requested, at most %d allowed", len(pairs), maxPairs), http.StatusBadRequest)
+		return
+	}
+
+	// Reject pairs outside the allowlist, even if they're resolvable
+	for _, pair := range pairs {
+		if normalizePair(pair) == "" {
+			http.Error(w, fmt.Sprintf("Empty pair in request: %q", pair), http.StatusBadRequest)
+			return
+		}
+		if !s.isPairServed(normalizePair(pair)) {
+			http.Error(w, fmt.Sprintf("Pair not served: %s", normalizePair(pair)), http.StatusBadRequest)
+			return
+		}
+	}
+
+	timeFormat := strings.ToLower(r.URL.Query().Get("time_format"))
+	if timeFormat == "" {
+		timeFormat = timeFormatRFC3339
+	}
+	if timeFormat != timeFormatRFC3339 && timeFormat != timeFormatUnixMs {
+		http.Error(w, fmt.Sprintf("Invalid time_format: %s", timeFormat), http.StatusBadRequest)
+		return
+	}
+
+	var since time.Time
+	if sinceParam := r.URL.Query().Get("since"); sinceParam != "" {
+		parsed, err := time.Parse(time.RFC3339, sinceParam)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid since: %s", sinceParam), http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	// A cursor, even an empty one, asks for the pairs changed since it
+	var cursor pollCursor
+	if cursorParams, given := r.URL.Query()["cursor"]; given {
+		parsed, err := parseCursor(cursorParams[0])
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid cursor: %v", err), http.StatusBadRequest)
+			return
+		}
+		cursor = parsed
+	}
+
+	include, err := requestInclude(r.URL.Query(), s.cfg().DefaultInclude)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid include: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	fields, err := parseFields(r.URL.Query().Get("fields"))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error fetching LTP: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Invalid fields: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	window := defaultRangeWindow
+	if windowParam := r.URL.Query().Get("window"); windowParam != "" {
+		parsed, err := time.ParseDuration(windowParam)
+		if err != nil || parsed <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid window: %s", windowParam), http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+
+	emptyOK := s.cfg().EmptyOK
+	if emptyParam := r.URL.Query().Get("empty_ok"); emptyParam != "" {
+		parsed, err := strconv.ParseBool(emptyParam)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid empty_ok: %s", emptyParam), http.StatusBadRequest)
+			return
+		}
+		emptyOK = parsed
+	}
+
+	var includeErrors bool
+	if errorsParam := r.URL.Query().Get("include_errors"); errorsParam != "" {
+		parsed, err := strconv.ParseBool(errorsParam)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid include_errors: %s", errorsParam), http.StatusBadRequest)
+			return
+		}
+		includeErrors = parsed
+	}
+
+	var multiStatus bool
+	if multiParam := r.URL.Query().Get("multistatus"); multiParam != "" {
+		parsed, err := strconv.ParseBool(multiParam)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid multistatus: %s", multiParam), http.StatusBadRequest)
+			return
+		}
+		multiStatus = parsed
+	}
+
+	ctx := r.Context()
+	if providerParam := r.URL.Query().Get("provider"); providerParam != "" {
+		name := strings.ToLower(strings.TrimSpace(providerParam))
+		if _, err := s.provider(name); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid provider: %s", providerParam), http.StatusBadRequest)
+			return
+		}
+		ctx = withProviderOverride(ctx, name)
+	}
+
+	// Get LTP data
+	var ltpData []PairLTP
+	var fetchErrs []PairError
+	if stale, ok := s.serveStaleWhileSlow(ctx, pairs, include); ok {
+		ltpData = stale
+	} else if budget := s.cfg().ResponseBudget; budget > 0 {
+		ltpData, fetchErrs = s.collectWithinBudget(ctx, pairs, include, budget)
+	} else {
+		ltpData, fetchErrs = s.collectLTP(ctx, pairs, include)
+	}
+	pairErrs = append(pairErrs, fetchErrs...)
+	if len(ltpData) == 0 && !emptyOK {
+		err := joinPairErrors(fetchErrs)
+		status := s.statusForError(err)
+		if errorCategory(err) == categoryMaintenance {
+			http.Error(w, "Kraken is undergoing maintenance, please retry later", status)
+			return
+		}
+		if len(pairs) == 1 && len(fetchErrs) == 1 && s.cfg().SinglePairErrors {
+			pairErr := fetchErrs[0]
+			http.Error(w, fmt.Sprintf("Error fetching %s: %v", pairErr.Pair, pairErr.err), s.statusForPairError(pairErr.err))
+			return
+		}
+		http.Error(w, fmt.Sprintf("Error fetching LTP: %v", err), status)
 		return
 	}
 
+	// Only return pairs that changed since the client's last poll
+	if !since.IsZero() && len(ltpData) > 0 {
+		newer := ltpData[:0]
+		for _, ltp := range ltpData {
+			if ltp.AsOf.After(since) {
+				newer = append(newer, ltp)
+			}
+		}
+		if len(newer) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		ltpData = newer
+	}
+
+	var nextCursor pollCursor
+	if cursor != nil {
+		ltpData, nextCursor = cursor.delta(ltpData)
+	}
+
+	for i := range ltpData {
+		ltpData[i].AsOf.format = timeFormat
+		if include.Range {
+			ltpData[i].setRange(s.history, s.cache.Now().Add(-window))
+		}
+	}
+
 	// Create response
 	response := LTPResponse{
-		LTP: ltpData,
+		LTP:    ltpData,
+		fields: fields,
+	}
+	if len(ltpData) == 0 || includeErrors {
+		response.Errors = pairErrs
+	}
+	if nextCursor != nil {
+		response.Cursor = nextCursor.String()
+	}
+
+	// A mixed outcome is reported as 207 with both sections on request
+	status := http.StatusOK
+	if multiStatus && len(ltpData) > 0 && len(pairErrs) > 0 {
+		status = http.StatusMultiStatus
+		response.Errors = pairErrs
+	}
+	if include.ServerTime {
+		response.ServerTime = &Timestamp{Time: s.cache.Now(), format: timeFormat}
+	}
+	if include.Digest {
+		response.Digest = priceDigest(ltpData)
+	}
+
+	// Pick the serializer for the negotiated version
+	serializer := ltpSerializers[defaultAPIVersion]
+	contentType := "application/json"
+	if version := apiVersion(r); version != "" {
+		serializer = ltpSerializers[version]
+		contentType = vendorMediaPrefix + version + vendorMediaSuffix
 	}
 
 	// Set headers
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Data-Age-Seconds", strconv.FormatInt(int64(s.dataAge(ltpData).Seconds()), 10))
+	if len(ltpData) > 0 {
+		w.Header().Set("X-Cache-Status", responseCacheStatus(ltpData))
+	}
+	for _, ltp := range ltpData {
+		if ltp.Deprecated {
+			w.Header().Add("Warning", fmt.Sprintf(`299 - "Pair %s is deprecated and will be removed"`, ltp.Pair))
+		}
+	}
+	w.WriteHeader(status)
 
 	// Encode and send response
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Error encoding response: %v", err)
+	if err := serializer(w, response); err != nil {
+		log.Printf("Error encoding response: %v cid=%s", err, correlationID(r))
+	}
+}
+
+// Encodes an LTP response in the shape of one API version
+type responseSerializer func(w io.Writer, response LTPResponse) error
+
+// Version served when the client doesn't ask for one
+const defaultAPIVersion = "v1"
+
+// Serializers per API version, selected via Accept: application/vnd.ltp.<version>+json
+var ltpSerializers = map[string]responseSerializer{
+	"v1": func(w io.Writer, response LTPResponse) error {
+		if len(response.fields) == 0 {
+			return json.NewEncoder(w).Encode(response)
+		}
+
+		pairs := make([]json.RawMessage, len(response.LTP))
+		for i, ltp := range response.LTP {
+			selected, err := selectFields(ltp, response.fields)
+			if err != nil {
+				return err
+			}
+			pairs[i] = selected
+		}
+		return json.NewEncoder(w).Encode(struct {
+			LTP        []json.RawMessage `json:"ltp"`
+			Errors     []PairError       `json:"errors,omitempty"`
+			ServerTime *Timestamp        `json:"server_time,omitempty"`
+			Digest     string            `json:"digest,omitempty"`
+			Cursor     string            `json:"cursor,omitempty"`
+		}{pairs, response.Errors, response.ServerTime, response.Digest, response.Cursor})
+	},
+}
+
+// JSON field names of PairLTP, in declaration order
+var pairLTPFields = jsonFieldNames(reflect.TypeOf(PairLTP{}))
+
+// Names of the exported JSON fields of a struct type
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Parse a comma-separated fields parameter against the known PairLTP fields
+func parseFields(value string) ([]string, error) {
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+		if !slices.Contains(pairLTPFields, field) {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// Encode only the given fields of a pair, in the order they're declared.
+// Fields left out by omitempty stay out.
+func selectFields(ltp PairLTP, fields []string) (json.RawMessage, error) {
+	encoded, err := json.Marshal(ltp)
+	if err != nil {
+		return nil, err
 	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &all); err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for _, name := range pairLTPFields {
+		value, present := all[name]
+		if !present || !slices.Contains(fields, name) {
+			continue
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%q:%s", name, value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// Hash over the pairs and their amounts, independent of their order, so
+// clients can tell whether any price changed between polls
+func priceDigest(ltpData []PairLTP) string {
+	lines := make([]string, len(ltpData))
+	for i, ltp := range ltpData {
+		lines[i] = ltp.Pair + "=" + strconv.FormatFloat(ltp.Amount.Value, 'f', -1, 64)
+	}
+	sort.Strings(lines)
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Cache status of a whole response: stale if any pair is stale, otherwise
+// miss if any pair was fetched, otherwise hit
+func responseCacheStatus(ltpData []PairLTP) string {
+	status := cacheHit
+	for _, ltp := range ltpData {
+		switch ltp.cacheStatus {
+		case cacheStale:
+			return cacheStale
+		case cacheMiss:
+			status = cacheMiss
+		}
+	}
+	return status
+}
+
+// Age of the oldest served entry
+func (s *Service) dataAge(ltpData []PairLTP) time.Duration {
+	now := s.cache.Now()
+
+	var age time.Duration
+	for _, ltp := range ltpData {
+		if entryAge := now.Sub(ltp.AsOf.Time); entryAge > age {
+			age = entryAge
+		}
+	}
+	return age
 }
 
 // Health check endpoint
@@ -223,23 +1070,183 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
+// Build the HTTP handler with all routes and middleware
+func (s *Service) routes() http.Handler {
+	api, ops := s.cfg().RoutePrefix, s.cfg().OpsRoutePrefix
+
+	mux := http.NewServeMux()
+	mux.Handle(api+"/api/v1/ltp", apiVersionMiddleware(ltpSerializers)(http.HandlerFunc(s.handleLTP)))
+	mux.HandleFunc(api+"/api/v1/ltp/refresh", s.handleRefresh)
+	mux.HandleFunc(api+"/api/v1/ltp/history/export", s.handleHistoryExport)
+	mux.HandleFunc(api+"/api/v1/ltp/stats", s.handleStats)
+	mux.HandleFunc(ops+"/health", handleHealth)
+	mux.HandleFunc(ops+"/readiness", s.handleReadiness)
+
+	handler := metricsMiddleware(s.metrics, mux)
+	handler = trailingSlashMiddleware(s.cfg().TrailingSlash, handler)
+	if s.cfg().RejectDuringShutdown {
+		handler = rejectDuringShutdownMiddleware(s.ShuttingDown(), handler)
+	}
+	if s.cfg().SecurityHeaders {
+		handler = securityHeadersMiddleware(handler)
+	}
+	if level := s.cfg().GzipLevel; level > 0 {
+		handler = gzipMiddleware(level, s.cfg().GzipMinSize)(handler)
+	}
+	handler = responseSizeMiddleware(s.metrics, handler)
+	handler = traceContextMiddleware(handler)
+	handler = loggingMiddleware(handler)
+	handler = realIPMiddleware(s.cfg().TrustedProxies)(handler)
+	return handler
+}
+
+// Build the handler of the dedicated health listener: /health and
+// /readiness only, at the same paths as on the public listener
+func (s *Service) healthRoutes() http.Handler {
+	ops := s.cfg().OpsRoutePrefix
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(ops+"/health", handleHealth)
+	mux.HandleFunc(ops+"/readiness", s.handleReadiness)
+
+	return loggingMiddleware(mux)
+}
+
+// Readiness endpoint: the service is ready when Kraken is reachable. The
+// check runs on its own short timeout so a hanging upstream yields a clean
+// 503 instead of the orchestrator's probe timing out.
+func (s *Service) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	var deep bool
+	if deepParam := r.URL.Query().Get("deep"); deepParam != "" {
+		parsed, err := strconv.ParseBool(deepParam)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid deep: %s", deepParam), http.StatusBadRequest)
+			return
+		}
+		deep = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg().ReadinessTimeout)
+	defer cancel()
+
+	if err := s.pingKraken(ctx); err != nil {
+		log.Printf("Readiness check failed: %v", err)
+		http.Error(w, "Not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	if deep {
+		if err := s.checkCanary(ctx); err != nil {
+			log.Printf("Deep readiness check failed: %v", err)
+			http.Error(w, "Not ready", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("READY"))
+}
+
 func main() {
-	service := NewService()
+	cfg, err := LoadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
-	// Setup routes
-	http.HandleFunc("/api/v1/ltp", service.handleLTP)
-	http.HandleFunc("/health", handleHealth)
+	service := NewServiceWithConfig(cfg)
+
+	if cfg.PairDecimals {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		service.loadPairDecimals(ctx)
+		cancel()
+	}
+
+	// Restore last-known-good prices from the previous run
+	if cfg.SnapshotPath != "" {
+		count, err := service.cache.LoadSnapshot(cfg.SnapshotPath)
+		if err != nil {
+			log.Printf("Could not load snapshot %s: %v", cfg.SnapshotPath, err)
+		} else {
+			log.Printf("Loaded %d entries from snapshot %s", count, cfg.SnapshotPath)
+		}
+	}
+
+	if cfg.WarmupTimeout > 0 {
+		service.warmUp(context.Background(), cfg.WarmupTimeout)
+	}
 
 	// Start server
-	port := "8080"
+	port := cfg.Port
 	log.Printf("Starting server on port %s", port)
 	log.Printf("Endpoints:")
-	log.Printf("  GET /api/v1/ltp - Get all pairs")
-	log.Printf("  GET /api/v1/ltp?pair=BTC/USD - Get single pair")
-	log.Printf("  GET /api/v1/ltp?pairs=BTC/USD,BTC/EUR - Get multiple pairs")
-	log.Printf("  GET /health - Health check")
+	log.Printf("  GET %s/api/v1/ltp - Get all pairs", cfg.RoutePrefix)
+	log.Printf("  GET %s/api/v1/ltp?pair=BTC/USD - Get single pair", cfg.RoutePrefix)
+	log.Printf("  GET %s/api/v1/ltp?pairs=BTC/USD,BTC/EUR - Get multiple pairs", cfg.RoutePrefix)
+	log.Printf("  POST %s/api/v1/ltp/refresh?pair=BTC/USD - Force-refresh pairs from upstream", cfg.RoutePrefix)
+	log.Printf("  GET %s/api/v1/ltp/history/export - Export recorded price history", cfg.RoutePrefix)
+	log.Printf("  GET %s/api/v1/ltp/stats?pair=BTC/USD&window=300s - Price statistics over a window", cfg.RoutePrefix)
+	log.Printf("  GET %s/health - Health check", cfg.OpsRoutePrefix)
+	log.Printf("  GET %s/readiness - Readiness check", cfg.OpsRoutePrefix)
 
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
+	listeners := []boundListener{{name: "public", ln: ln, handler: service.routes()}}
+
+	if cfg.AdminAddr != "" {
+		adminLn, err := net.Listen("tcp", cfg.AdminAddr)
+		if err != nil {
+			log.Fatalf("Admin server failed to start: %v", err)
+		}
+		log.Printf("Admin endpoints (/admin/cache, /debug/inflight, /debug/errors, /debug/pprof/) on %s", cfg.AdminAddr)
+		listeners = append(listeners, boundListener{name: "admin", ln: adminLn, handler: service.adminRoutes()})
+	}
+
+	if cfg.HealthAddr != "" {
+		healthLn, err := net.Listen("tcp", cfg.HealthAddr)
+		if err != nil {
+			log.Fatalf("Health server failed to start: %v", err)
+		}
+		log.Printf("Health endpoints (%s/health, %s/readiness) also on %s", cfg.OpsRoutePrefix, cfg.OpsRoutePrefix, cfg.HealthAddr)
+		listeners = append(listeners, boundListener{name: "health", ln: healthLn, handler: service.healthRoutes()})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.RefreshInterval > 0 {
+		go service.runRefresher(ctx, cfg.RefreshInterval)
+	}
+
+	if cfg.CacheStatsInterval > 0 {
+		go service.runCacheStatsLogger(ctx, cfg.CacheStatsInterval)
+	}
+
+	go service.reloadOnSIGHUP(ctx)
+
+	snapshotWriterDone := make(chan struct{})
+	if cfg.SnapshotPath != "" {
+		go func() {
+			defer close(snapshotWriterDone)
+			service.runSnapshotWriter(ctx, cfg.SnapshotPath, cfg.SnapshotInterval)
+		}()
+	} else {
+		close(snapshotWriterDone)
+	}
+
+	if err := service.serve(ctx, listeners...); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+
+	// Persist the latest prices for the next start, once the periodic
+	// writer can no longer replace them with an older copy
+	<-snapshotWriterDone
+	if cfg.SnapshotPath != "" {
+		if err := service.cache.SaveSnapshot(cfg.SnapshotPath); err != nil {
+			log.Printf("Error saving snapshot: %v", err)
+		}
+	}
+
+	log.Printf("Server stopped")
 }
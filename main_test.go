@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 )
@@ -21,7 +26,11 @@ func mockKrakenServer() *httptest.Server {
 		switch pair {
 		case "XXBTZUSD":
 			response.Result["XXBTZUSD"] = KrakenTickData{
+				A: []string{"45010.00", "1", "1.000"},
+				B: []string{"44990.00", "2", "2.000"},
 				C: []string{"45000.00", "0.5"},
+				P: []string{"44800.50", "44650.25"},
+				V: []string{"1200.50000000", "3400.25000000"},
 			}
 		case "XBTCHF":
 			response.Result["XBTCHF"] = KrakenTickData{
@@ -40,6 +49,16 @@ func mockKrakenServer() *httptest.Server {
 	}))
 }
 
+// Mock Kraken server that fails every request with an API error
+func failingKrakenServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(KrakenResponse{
+			Error: []string{"EService:Unavailable"},
+		})
+	}))
+}
+
 func TestGetKrakenPair(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -50,6 +69,9 @@ func TestGetKrakenPair(t *testing.T) {
 		{"BTC/CHF", "XBTCHF"},
 		{"BTC/EUR", "XXBTZEUR"},
 		{"INVALID", ""},
+		{"ETH/USD", ""},
+		{"USD/BTC", ""},
+		{"BTC/BTC", ""},
 	}
 
 	for _, test := range tests {
@@ -60,6 +82,30 @@ func TestGetKrakenPair(t *testing.T) {
 	}
 }
 
+func TestKrakenPairName(t *testing.T) {
+	xbt := krakenAsset{code: "XBT", legacy: true}
+	eth := krakenAsset{code: "ETH", legacy: true}
+	usd := krakenAsset{code: "USD", fiat: true, legacy: true}
+	chf := krakenAsset{code: "CHF", fiat: true}
+	sol := krakenAsset{code: "SOL"}
+
+	tests := []struct {
+		base, quote krakenAsset
+		expected    string
+	}{
+		{xbt, usd, "XXBTZUSD"}, // Both legacy: prefixed
+		{xbt, chf, "XBTCHF"},   // Newer fiat: plain codes
+		{eth, xbt, "XETHXXBT"}, // Crypto quote gets an X
+		{sol, usd, "SOLUSD"},   // Newer crypto: plain codes
+	}
+
+	for _, test := range tests {
+		if result := krakenPairName(test.base, test.quote); result != test.expected {
+			t.Errorf("krakenPairName(%s, %s) = %s; want %s", test.base.code, test.quote.code, result, test.expected)
+		}
+	}
+}
+
 func TestHandleLTP_AllPairs(t *testing.T) {
 	service := NewService()
 
@@ -72,9 +118,7 @@ func TestHandleLTP_AllPairs(t *testing.T) {
 
 	// Override the Kraken API URL for testing
 	service.krakenClient = mockServer.Client()
-
-	// Note: In production code, you'd want to make the base URL configurable
-	// For this test, we're using the mock server
+	service.krakenBaseURL = mockServer.URL
 
 	service.handleLTP(rec, req)
 
@@ -102,6 +146,7 @@ func TestHandleLTP_SinglePair(t *testing.T) {
 	defer mockServer.Close()
 
 	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
 
 	service.handleLTP(rec, req)
 
@@ -133,6 +178,7 @@ func TestHandleLTP_MultiplePairs(t *testing.T) {
 	defer mockServer.Close()
 
 	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
 
 	service.handleLTP(rec, req)
 
@@ -153,7 +199,7 @@ func TestHandleLTP_MultiplePairs(t *testing.T) {
 func TestHandleLTP_InvalidMethod(t *testing.T) {
 	service := NewService()
 
-	req := httptest.NewRequest("POST", "/api/v1/ltp", nil)
+	req := httptest.NewRequest("DELETE", "/api/v1/ltp", nil)
 	rec := httptest.NewRecorder()
 
 	service.handleLTP(rec, req)
@@ -211,3 +257,1509 @@ func TestHealthEndpoint(t *testing.T) {
 		t.Errorf("Expected body 'OK', got '%s'", rec.Body.String())
 	}
 }
+
+func TestPriceMarshalJSON(t *testing.T) {
+	tests := []struct {
+		input    Price
+		expected string
+	}{
+		{Price{Value: 45000.12}, "45000.12"},
+		{Price{Value: 0.0000000123}, "0.0000000123"},
+		{Price{Value: 1e21}, "1000000000000000000000"},
+		{Price{Value: 0}, "0"},
+		{Price{Value: 45123.456, digits: 4}, "45120"},
+		{Price{Value: 0.000012345678, digits: 4}, "0.00001235"},
+		{Price{Value: 1.5, digits: 4}, "1.5"},
+	}
+
+	for _, test := range tests {
+		data, err := json.Marshal(test.input)
+		if err != nil {
+			t.Fatalf("Failed to marshal %v: %v", test.input, err)
+		}
+		if string(data) != test.expected {
+			t.Errorf("json.Marshal(%v) = %s; want %s", test.input, data, test.expected)
+		}
+	}
+}
+
+func TestHandleLTP_SignificantDigitsPerService(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	amount := func(digits int) string {
+		cfg := DefaultConfig()
+		cfg.SignificantDigits = digits
+		service := NewServiceWithConfig(cfg)
+		service.krakenClient = mockServer.Client()
+		service.krakenBaseURL = mockServer.URL
+
+		rec := httptest.NewRecorder()
+		service.handleLTP(rec, httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&include=spread", nil))
+		return rec.Body.String()
+	}
+
+	// Services in one process keep their own setting
+	rounded := amount(2)
+	full := amount(0)
+	if !strings.Contains(rounded, `"amount":45000,`) || !strings.Contains(rounded, `"bid":45000,`) {
+		t.Errorf("Expected prices cut to 2 digits, got %s", rounded)
+	}
+	if !strings.Contains(full, `"bid":44990,`) {
+		t.Errorf("Expected every digit without a limit, got %s", full)
+	}
+}
+
+func TestSignificantDigits_AllOutputs(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SignificantDigits = 3
+	service := NewServiceWithConfig(cfg)
+
+	now := time.Now()
+	service.history.Record("BTC/USD", 45123.456, now.Add(-time.Second))
+	service.cache.data["BTC/USD"] = CacheEntry{ticker: Ticker{Last: 45123.456}, timestamp: now}
+
+	outputs := []struct {
+		name    string
+		handler http.HandlerFunc
+		url     string
+	}{
+		{"stats", service.handleStats, "/api/v1/ltp/stats?pair=BTC/USD&window=300s"},
+		{"history export", service.handleHistoryExport, "/api/v1/ltp/history/export"},
+		{"admin cache", service.handleCacheAdmin, "/admin/cache"},
+	}
+
+	for _, output := range outputs {
+		rec := httptest.NewRecorder()
+		output.handler(rec, httptest.NewRequest("GET", output.url, nil))
+		body := rec.Body.String()
+		if strings.Contains(body, "45123") || !strings.Contains(body, "45100") {
+			t.Errorf("%s: Expected prices cut to 3 digits, got %s", output.name, body)
+		}
+	}
+}
+
+func TestHandleLTP_PlainDecimalAmount(t *testing.T) {
+	service := NewService()
+
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	// Fetch directly so the test doesn't depend on which pairs are routable
+	amount, err := service.fetchLTPFromKraken("BTC/USD")
+	if err != nil {
+		t.Fatalf("Failed to fetch: %v", err)
+	}
+
+	data, err := json.Marshal(LTPResponse{LTP: []PairLTP{
+		{Pair: "BTC/USD", Amount: Price{Value: amount}},
+		{Pair: "BTC/JPY", Amount: Price{Value: 0.0000000123}},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to marshal response: %v", err)
+	}
+
+	body := string(data)
+	if strings.ContainsAny(body, "eE+") {
+		t.Errorf("Expected no exponent notation, got %s", body)
+	}
+	if !strings.Contains(body, `"amount":0.0000000123`) {
+		t.Errorf("Expected plain decimal amount, got %s", body)
+	}
+	if !strings.Contains(body, `"amount":45000`) {
+		t.Errorf("Expected mocked BTC/USD amount, got %s", body)
+	}
+}
+
+func TestHandleLTP_ServePairsAllowlist(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ServePairs = []string{"BTC/USD"}
+	service := NewServiceWithConfig(cfg)
+
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	// BTC/EUR is resolvable but not in the allowlist
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/EUR", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+
+	// A bare request only returns allowed pairs
+	req = httptest.NewRequest("GET", "/api/v1/ltp", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(response.LTP) != 1 || response.LTP[0].Pair != "BTC/USD" {
+		t.Errorf("Expected only BTC/USD, got %+v", response.LTP)
+	}
+}
+
+func TestReadinessEndpoint(t *testing.T) {
+	service := NewService()
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"error":[],"result":{"unixtime":1700000000}}`))
+	}))
+	defer mockServer.Close()
+
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/readiness", nil)
+	rec := httptest.NewRecorder()
+	service.handleReadiness(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+}
+
+func TestReadinessEndpoint_SlowUpstream(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ReadinessTimeout = 50 * time.Millisecond
+	service := NewServiceWithConfig(cfg)
+
+	// Kraken hangs far longer than the readiness timeout
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer mockServer.Close()
+
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/readiness", nil)
+	rec := httptest.NewRecorder()
+
+	start := time.Now()
+	service.handleReadiness(rec, req)
+	elapsed := time.Since(start)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rec.Code)
+	}
+
+	if elapsed > 500*time.Millisecond {
+		t.Errorf("Readiness took %v, expected to return within the readiness timeout", elapsed)
+	}
+}
+
+func TestParseTicker_VWAP(t *testing.T) {
+	ticker, err := parseTicker("BTC/USD", KrakenTickData{
+		C: []string{"45000.00", "0.5"},
+		P: []string{"44800.50", "44650.25"},
+	})
+	if err != nil {
+		t.Fatalf("parseTicker failed: %v", err)
+	}
+
+	if ticker.Last != 45000.00 || ticker.VWAPToday != 44800.50 || ticker.VWAP24h != 44650.25 {
+		t.Errorf("Unexpected ticker: %+v", ticker)
+	}
+
+	if _, err := parseTicker("BTC/USD", KrakenTickData{
+		C: []string{"45000.00", "0.5"},
+		P: []string{"bad", "44650.25"},
+	}); err == nil {
+		t.Error("Expected error for invalid vwap")
+	}
+}
+
+func TestParseTicker_MalformedArrays(t *testing.T) {
+	tests := []struct {
+		name     string
+		tickData KrakenTickData
+	}{
+		{"empty close", KrakenTickData{C: []string{}}},
+		{"missing close", KrakenTickData{A: []string{"45010.00"}}},
+		{"blank close", KrakenTickData{C: []string{""}}},
+		{"blank bid", KrakenTickData{C: []string{"45000.00"}, B: []string{" "}}},
+	}
+
+	for _, test := range tests {
+		if _, err := parseTicker("BTC/USD", test.tickData); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+
+	// Short optional arrays are skipped rather than indexed past
+	ticker, err := parseTicker("BTC/USD", KrakenTickData{
+		C: []string{"45000.00"},
+		A: []string{},
+		P: []string{"44800.50"},
+		V: []string{},
+	})
+	if err != nil {
+		t.Fatalf("parseTicker failed: %v", err)
+	}
+	if ticker.Last != 45000.00 || ticker.Ask != 0 || ticker.VWAPToday != 0 {
+		t.Errorf("Unexpected ticker: %+v", ticker)
+	}
+}
+
+func TestHandleLTP_IncludeLastVolume(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&include=last_volume", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.LTP) != 1 || response.LTP[0].LastVolume == nil || *response.LTP[0].LastVolume != 0.5 {
+		t.Errorf("Expected last_trade_volume 0.5 from the mock's close array, got %+v", response.LTP)
+	}
+
+	// A close array without the volume leaves it out
+	ticker, err := parseTicker("BTC/USD", KrakenTickData{C: []string{"45000.00"}})
+	if err != nil || ticker.LastVolume != 0 {
+		t.Errorf("Expected no lot volume without C[1], got %v (err %v)", ticker.LastVolume, err)
+	}
+	if _, err := parseTicker("BTC/USD", KrakenTickData{C: []string{"45000.00", "lots"}}); err == nil {
+		t.Error("Expected error for an invalid lot volume")
+	}
+}
+
+func TestFetchTickerFromKraken_RequestIDHeader(t *testing.T) {
+	var ids []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get("X-Kraken-Trace"))
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["45000.00","0.5"]}}}`))
+	}))
+	defer mockServer.Close()
+
+	cfg := DefaultConfig()
+	cfg.KrakenRequestIDHeader = "X-Kraken-Trace"
+	service := NewServiceWithConfig(cfg)
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	for i := 0; i < 2; i++ {
+		if _, err := service.fetchLTPFromKraken("BTC/USD"); err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+	}
+
+	if len(ids) != 2 || ids[0] == "" || ids[1] == "" {
+		t.Fatalf("Expected a request ID on both fetches, got %q", ids)
+	}
+	if ids[0] == ids[1] {
+		t.Errorf("Expected unique request IDs, got %s twice", ids[0])
+	}
+	if len(ids[0]) != 36 || ids[0][14] != '4' {
+		t.Errorf("Expected a version 4 UUID, got %s", ids[0])
+	}
+}
+
+func TestFetchTickerFromKraken_EmptyClose(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":[],"a":["45010.00"]}}}`))
+	}))
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	_, err := service.fetchTickerFromKraken(context.Background(), "BTC/USD")
+	if err == nil || !strings.Contains(err.Error(), "no close price for pair BTC/USD") {
+		t.Errorf("Expected a clean no-close-price error, got %v", err)
+	}
+}
+
+func TestHandleLTP_IncludeVWAP(t *testing.T) {
+	service := NewService()
+
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	// VWAP is omitted unless requested
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if strings.Contains(rec.Body.String(), "vwap") {
+		t.Errorf("Expected no vwap fields by default, got %s", rec.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&include=vwap", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	ltp := response.LTP[0]
+	if ltp.VWAPToday == nil || ltp.VWAPToday.Value != 44800.50 {
+		t.Errorf("Expected vwap_today 44800.50, got %v", ltp.VWAPToday)
+	}
+	if ltp.VWAP24h == nil || ltp.VWAP24h.Value != 44650.25 {
+		t.Errorf("Expected vwap_24h 44650.25, got %v", ltp.VWAP24h)
+	}
+}
+
+func TestTimestampMarshalJSON(t *testing.T) {
+	instant := time.Date(2024, 3, 1, 12, 30, 45, 123000000, time.UTC)
+
+	data, err := json.Marshal(Timestamp{Time: instant, format: timeFormatRFC3339})
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	if string(data) != `"2024-03-01T12:30:45.123Z"` {
+		t.Errorf("Expected RFC3339 timestamp, got %s", data)
+	}
+
+	data, err = json.Marshal(Timestamp{Time: instant, format: timeFormatUnixMs})
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	if string(data) != "1709296245123" {
+		t.Errorf("Expected unix ms timestamp, got %s", data)
+	}
+
+	// Both forms decode back to the same instant
+	for _, encoded := range []string{`"2024-03-01T12:30:45.123Z"`, "1709296245123"} {
+		var ts Timestamp
+		if err := json.Unmarshal([]byte(encoded), &ts); err != nil {
+			t.Fatalf("Failed to unmarshal %s: %v", encoded, err)
+		}
+		if !ts.Equal(instant) {
+			t.Errorf("Unmarshal(%s) = %v; want %v", encoded, ts.Time, instant)
+		}
+	}
+}
+
+func TestHandleLTP_TimeFormat(t *testing.T) {
+	service := NewService()
+	instant := time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+	service.cache.data["BTC/USD"] = CacheEntry{
+		ticker:    Ticker{Last: 45000.0},
+		timestamp: instant,
+	}
+	service.cache.ttl = 24 * time.Hour * 365 * 100
+
+	tests := []struct {
+		query    string
+		expected string
+		status   int
+	}{
+		{"", `"as_of":"2024-03-01T12:30:45Z"`, http.StatusOK},
+		{"&time_format=rfc3339", `"as_of":"2024-03-01T12:30:45Z"`, http.StatusOK},
+		{"&time_format=unix_ms", `"as_of":1709296245000`, http.StatusOK},
+		{"&time_format=julian", "", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD"+test.query, nil)
+		rec := httptest.NewRecorder()
+		service.handleLTP(rec, req)
+
+		if rec.Code != test.status {
+			t.Errorf("%q: expected status %d, got %d", test.query, test.status, rec.Code)
+			continue
+		}
+		if !strings.Contains(rec.Body.String(), test.expected) {
+			t.Errorf("%q: expected %s in body, got %s", test.query, test.expected, rec.Body.String())
+		}
+	}
+}
+
+func TestFetchLTPFromKraken_Maintenance(t *testing.T) {
+	service := NewService()
+
+	mockServer := failingKrakenServer()
+	defer mockServer.Close()
+
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	_, err := service.fetchLTPFromKraken("BTC/USD")
+	if !errors.Is(err, ErrUpstreamMaintenance) {
+		t.Errorf("Expected ErrUpstreamMaintenance, got %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rec.Code)
+	}
+
+	if !strings.Contains(rec.Body.String(), "maintenance") {
+		t.Errorf("Expected maintenance message, got %q", rec.Body.String())
+	}
+}
+
+func TestMatchesKrakenError(t *testing.T) {
+	if !matchesKrakenError([]string{"EService:Market in cancel_only mode"}, krakenMaintenanceErrors) {
+		t.Error("Expected cancel_only mode to be maintenance")
+	}
+	if matchesKrakenError([]string{"EQuery:Unknown asset pair"}, krakenMaintenanceErrors) {
+		t.Error("Expected unknown pair not to be maintenance")
+	}
+}
+
+func TestHandleLTP_IncludeSpread(t *testing.T) {
+	service := NewService()
+
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&include=spread", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	ltp := response.LTP[0]
+	if ltp.Bid == nil || ltp.Bid.Value != 44990.00 || ltp.Ask == nil || ltp.Ask.Value != 45010.00 {
+		t.Fatalf("Expected mocked bid/ask, got %+v", ltp)
+	}
+
+	if ltp.Spread == nil || ltp.Spread.Value != 20.00 {
+		t.Errorf("Expected spread 20, got %v", ltp.Spread)
+	}
+
+	// (45010 - 44990) / 45000 * 10000
+	expectedBps := 20.0 / 45000.0 * 10000
+	if ltp.SpreadBps == nil || math.Abs(*ltp.SpreadBps-expectedBps) > 1e-9 {
+		t.Errorf("Expected spread_bps %f, got %v", expectedBps, ltp.SpreadBps)
+	}
+}
+
+func TestSetSpread_ZeroMid(t *testing.T) {
+	var ltp PairLTP
+	ltp.setSpread(0, 0)
+
+	if ltp.SpreadBps != nil {
+		t.Errorf("Expected no spread_bps for a zero mid, got %v", *ltp.SpreadBps)
+	}
+}
+
+func TestSplitPair(t *testing.T) {
+	tests := []struct {
+		input string
+		base  string
+		quote string
+		ok    bool
+	}{
+		{"BTC/USD", "BTC", "USD", true},
+		{"BTC/CHF", "BTC", "CHF", true},
+		{"BTC/EUR", "BTC", "EUR", true},
+		{"BTCUSD", "", "", false},
+		{"BTC/", "", "", false},
+		{"/USD", "", "", false},
+		{"BTC/USD/EUR", "", "", false},
+		{"", "", "", false},
+	}
+
+	for _, test := range tests {
+		base, quote, ok := splitPair(test.input)
+		if base != test.base || quote != test.quote || ok != test.ok {
+			t.Errorf("splitPair(%q) = (%q, %q, %v); want (%q, %q, %v)",
+				test.input, base, quote, ok, test.base, test.quote, test.ok)
+		}
+	}
+}
+
+func TestHandleLTP_BaseQuote(t *testing.T) {
+	service := NewService()
+
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	for _, ltp := range response.LTP {
+		if ltp.Base != "BTC" || ltp.Base+"/"+ltp.Quote != ltp.Pair {
+			t.Errorf("Unexpected base/quote for %s: %q/%q", ltp.Pair, ltp.Base, ltp.Quote)
+		}
+	}
+}
+
+func TestHandleLTP_Since(t *testing.T) {
+	service := NewService()
+	service.cache.ttl = time.Hour
+
+	now := time.Now()
+	service.cache.data["BTC/USD"] = CacheEntry{ticker: Ticker{Last: 45000}, timestamp: now.Add(-10 * time.Second)}
+	service.cache.data["BTC/EUR"] = CacheEntry{ticker: Ticker{Last: 42000}, timestamp: now.Add(-5 * time.Minute)}
+
+	since := now.Add(-time.Minute).UTC().Format(time.RFC3339)
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pairs=BTC/USD,BTC/EUR&since="+since, nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(response.LTP) != 1 || response.LTP[0].Pair != "BTC/USD" {
+		t.Errorf("Expected only the newer BTC/USD, got %+v", response.LTP)
+	}
+
+	// Nothing newer than now
+	since = now.Add(time.Minute).UTC().Format(time.RFC3339)
+	req = httptest.NewRequest("GET", "/api/v1/ltp?pairs=BTC/USD,BTC/EUR&since="+since, nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/ltp?since=yesterday", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid since, got %d", rec.Code)
+	}
+}
+
+func TestHandleLTP_DataAgeHeader(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+	service.cache.ttl = time.Minute
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service.cache.now = func() time.Time { return now }
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if age := rec.Header().Get("X-Data-Age-Seconds"); age != "0" {
+		t.Errorf("Expected age 0 on a fresh fetch, got %q", age)
+	}
+
+	// Served from the cache 42s later
+	now = now.Add(42 * time.Second)
+
+	req = httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if age := rec.Header().Get("X-Data-Age-Seconds"); age != "42" {
+		t.Errorf("Expected age 42 on a cached response, got %q", age)
+	}
+}
+
+func TestHandleLTP_EmptyOK(t *testing.T) {
+	mockServer := failingKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pairs=BTC/USD,BTC/EUR&empty_ok=true", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.LTP == nil || len(response.LTP) != 0 {
+		t.Errorf("Expected an empty ltp array, got %+v", response.LTP)
+	}
+
+	if len(response.Errors) != 2 || response.Errors[0].Pair != "BTC/USD" || response.Errors[0].Message == "" {
+		t.Errorf("Expected an error per pair, got %+v", response.Errors)
+	}
+
+	// The default keeps the error status
+	req = httptest.NewRequest("GET", "/api/v1/ltp?pairs=BTC/USD,BTC/EUR", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without empty_ok, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/ltp?empty_ok=maybe", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid empty_ok, got %d", rec.Code)
+	}
+}
+
+func TestHandleLTP_BasesQuotes(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?bases=btc,ETH&quotes=USD,EUR&include_errors=true", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(response.LTP) != 2 || response.LTP[0].Pair != "BTC/USD" || response.LTP[1].Pair != "BTC/EUR" {
+		t.Errorf("Expected BTC/USD and BTC/EUR, got %+v", response.LTP)
+	}
+
+	if len(response.Errors) != 2 || response.Errors[0].Pair != "ETH/USD" || response.Errors[1].Pair != "ETH/EUR" {
+		t.Errorf("Expected errors for the ETH combinations, got %+v", response.Errors)
+	}
+
+	// Errors are left out unless requested
+	req = httptest.NewRequest("GET", "/api/v1/ltp?bases=BTC,ETH&quotes=USD", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	response = LTPResponse{}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.LTP) != 1 || len(response.Errors) != 0 {
+		t.Errorf("Expected only BTC/USD without errors, got %+v", response)
+	}
+}
+
+func TestHandleLTP_MaxPairs(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+	service.config.MaxPairs = 3
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?bases=BTC,ETH&quotes=USD,EUR", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	// Only two combinations are supported, so the expansion stays under the cap
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the expansion to fit the cap, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/ltp?pairs=BTC/USD,BTC/EUR,BTC/CHF,BTC/USD", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 over the cap, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/ltp?bases=BTC", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for bases without quotes, got %d", rec.Code)
+	}
+}
+
+func TestParseInclude(t *testing.T) {
+	include, err := parseInclude(" VWAP,spread,,range,confidence ")
+	if err != nil {
+		t.Fatalf("parseInclude failed: %v", err)
+	}
+
+	expected := IncludeOptions{VWAP: true, Spread: true, Range: true, Confidence: true}
+	if include != expected {
+		t.Errorf("Expected %+v, got %+v", expected, include)
+	}
+
+	if _, err := parseInclude("vwap,volume"); err == nil {
+		t.Error("Expected error for unknown include flag")
+	}
+}
+
+func TestHandleLTP_DefaultInclude(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	cfg := DefaultConfig()
+	cfg.DefaultInclude = IncludeOptions{Spread: true, Source: true}
+	service := NewServiceWithConfig(cfg)
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	get := func(url string) LTPResponse {
+		req := httptest.NewRequest("GET", url, nil)
+		rec := httptest.NewRecorder()
+		service.handleLTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", url, rec.Code)
+		}
+		var response LTPResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response
+	}
+
+	// Without include the default set applies
+	ltp := get("/api/v1/ltp?pair=BTC/USD").LTP[0]
+	if ltp.Spread == nil || ltp.Source != providerKraken {
+		t.Errorf("Expected default spread and source, got %+v", ltp)
+	}
+
+	// An explicit include replaces it
+	ltp = get("/api/v1/ltp?pair=BTC/USD&include=vwap").LTP[0]
+	if ltp.Spread != nil || ltp.VWAP24h == nil {
+		t.Errorf("Expected only vwap, got %+v", ltp)
+	}
+
+	// include=none strips it
+	ltp = get("/api/v1/ltp?pair=BTC/USD&include=none").LTP[0]
+	if ltp.Spread != nil || ltp.Source != "" {
+		t.Errorf("Expected bare form with include=none, got %+v", ltp)
+	}
+
+	if _, err := parseInclude("none,vwap"); err == nil {
+		t.Error("Expected error combining none with other flags")
+	}
+}
+
+func TestHandleLTP_IncludeCurrencySymbol(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pairs=BTC/USD,BTC/EUR&include=currency_symbol", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	expected := map[string]string{"BTC/USD": "$", "BTC/EUR": "€"}
+	for _, ltp := range response.LTP {
+		if ltp.Symbol != expected[ltp.Pair] {
+			t.Errorf("Expected symbol %q for %s, got %q", expected[ltp.Pair], ltp.Pair, ltp.Symbol)
+		}
+	}
+
+	if symbol := currencySymbol("JPY"); symbol != "¥" {
+		t.Errorf("Expected ¥ for JPY, got %q", symbol)
+	}
+	if symbol := currencySymbol("SGD"); symbol != "SGD" {
+		t.Errorf("Expected unknown currency to fall back to its code, got %q", symbol)
+	}
+
+	// Absent unless requested
+	req = httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if strings.Contains(rec.Body.String(), "currency_symbol") {
+		t.Errorf("Expected no currency_symbol without include, got %s", rec.Body.String())
+	}
+}
+
+func TestPriceDigest(t *testing.T) {
+	ltpData := []PairLTP{
+		{Pair: "BTC/USD", Amount: Price{Value: 45000}},
+		{Pair: "BTC/EUR", Amount: Price{Value: 42000}},
+	}
+	digest := priceDigest(ltpData)
+
+	// Identical data in another order, fetched at another time
+	same := []PairLTP{
+		{Pair: "BTC/EUR", Amount: Price{Value: 42000}, AsOf: Timestamp{Time: time.Now()}},
+		{Pair: "BTC/USD", Amount: Price{Value: 45000}},
+	}
+	if priceDigest(same) != digest {
+		t.Error("Expected identical prices to give the same digest")
+	}
+
+	changed := []PairLTP{
+		{Pair: "BTC/USD", Amount: Price{Value: 45000.5}},
+		{Pair: "BTC/EUR", Amount: Price{Value: 42000}},
+	}
+	if priceDigest(changed) == digest {
+		t.Error("Expected a changed amount to change the digest")
+	}
+}
+
+func TestHandleLTP_IncludeDigest(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	digest := func(url string) string {
+		req := httptest.NewRequest("GET", url, nil)
+		rec := httptest.NewRecorder()
+		service.handleLTP(rec, req)
+
+		var response map[string]any
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		value, _ := response["digest"].(string)
+		return value
+	}
+
+	first := digest("/api/v1/ltp?pairs=BTC/USD,BTC/EUR&include=digest")
+	if first == "" {
+		t.Fatal("Expected a digest")
+	}
+	if second := digest("/api/v1/ltp?pairs=BTC/USD,BTC/EUR&include=digest&fields=pair"); second != first {
+		t.Errorf("Expected the same digest across polls, got %s and %s", first, second)
+	}
+	if digest("/api/v1/ltp?pairs=BTC/USD,BTC/EUR") != "" {
+		t.Error("Expected no digest without include")
+	}
+}
+
+func TestHandleLTP_UnknownInclude(t *testing.T) {
+	service := NewService()
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&include=vwap,bogus", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "bogus") {
+		t.Errorf("Expected the unknown flag in the error, got %q", rec.Body.String())
+	}
+}
+
+func TestHandleLTP_Fields(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pairs=BTC/USD,BTC/EUR&fields=amount,pair", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var response struct {
+		LTP []map[string]any `json:"ltp"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(response.LTP) != 2 {
+		t.Fatalf("Expected 2 pairs, got %d", len(response.LTP))
+	}
+	for _, ltp := range response.LTP {
+		if len(ltp) != 2 || ltp["pair"] == nil || ltp["amount"] == nil {
+			t.Errorf("Expected only pair and amount, got %v", ltp)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&fields=pair,price", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown field, got %d", rec.Code)
+	}
+}
+
+func TestSelectFields_Order(t *testing.T) {
+	ltp := PairLTP{Pair: "BTC/USD", Amount: Price{Value: 45000}, Base: "BTC"}
+
+	selected, err := selectFields(ltp, []string{"amount", "pair", "stale"})
+	if err != nil {
+		t.Fatalf("selectFields failed: %v", err)
+	}
+
+	// Declaration order, and omitted empty fields stay omitted
+	if string(selected) != `{"pair":"BTC/USD","amount":45000}` {
+		t.Errorf("Unexpected selection: %s", selected)
+	}
+}
+
+func TestHandleLTP_IncludeRaw(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&include=raw", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	raw := response.LTP[0].Raw
+	if raw == nil {
+		t.Fatal("Expected a raw block")
+	}
+	expected := RawTicker{
+		Close:  []string{"45000.00", "0.5"},
+		Bid:    []string{"44990.00", "2", "2.000"},
+		Ask:    []string{"45010.00", "1", "1.000"},
+		Volume: []string{"1200.50000000", "3400.25000000"},
+	}
+	if strings.Join(raw.Close, ",") != strings.Join(expected.Close, ",") ||
+		strings.Join(raw.Bid, ",") != strings.Join(expected.Bid, ",") ||
+		strings.Join(raw.Ask, ",") != strings.Join(expected.Ask, ",") ||
+		strings.Join(raw.Volume, ",") != strings.Join(expected.Volume, ",") {
+		t.Errorf("Expected raw %+v, got %+v", expected, *raw)
+	}
+
+	// Not included by default
+	req = httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if strings.Contains(rec.Body.String(), `"raw"`) {
+		t.Errorf("Expected no raw block by default, got %s", rec.Body.String())
+	}
+}
+
+func TestHandleLTP_EncodedSlashes(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"pair=BTC%2FUSD", []string{"BTC/USD"}},
+		{"pair=btc%2fusd", []string{"BTC/USD"}},
+		{"pair=BTC%252FUSD", []string{"BTC/USD"}},
+		{"pairs=BTC%2FUSD%2CBTC%2FEUR", []string{"BTC/USD", "BTC/EUR"}},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/ltp?"+test.query, nil)
+		rec := httptest.NewRecorder()
+		service.routes().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d: %s", test.query, rec.Code, rec.Body.String())
+			continue
+		}
+
+		var response LTPResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+
+		if len(response.LTP) != len(test.expected) {
+			t.Errorf("%s: expected %v, got %+v", test.query, test.expected, response.LTP)
+			continue
+		}
+		for i, pair := range test.expected {
+			if response.LTP[i].Pair != pair {
+				t.Errorf("%s: expected %s, got %s", test.query, pair, response.LTP[i].Pair)
+			}
+		}
+	}
+}
+
+func TestHandleLTP_InvisibleCharacters(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	for _, pair := range []string{"BTC/USD\u00a0", "\u00a0BTC/USD\n", "\ufeffBTC\u200b/USD\r\n"} {
+		req := httptest.NewRequest("GET", "/api/v1/ltp?pair="+url.QueryEscape(pair), nil)
+		rec := httptest.NewRecorder()
+		service.handleLTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%q: expected status 200, got %d: %s", pair, rec.Code, rec.Body.String())
+			continue
+		}
+		var response LTPResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(response.LTP) != 1 || response.LTP[0].Pair != "BTC/USD" {
+			t.Errorf("%q: expected BTC/USD, got %+v", pair, response.LTP)
+		}
+	}
+
+	// A pair made only of invisible characters is rejected
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pairs="+url.QueryEscape("BTC/USD,\u00a0\t"), nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an empty pair, got %d", rec.Code)
+	}
+}
+
+func TestHandleLTP_IncludeServerTime(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service.cache.now = func() time.Time { return now }
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&include=server_time", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	var response map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response["server_time"] != "2024-01-01T12:00:00Z" {
+		t.Errorf("Expected server_time 2024-01-01T12:00:00Z, got %v", response["server_time"])
+	}
+
+	// Absent unless requested
+	req = httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if strings.Contains(rec.Body.String(), "server_time") {
+		t.Errorf("Expected no server_time without include, got %s", rec.Body.String())
+	}
+}
+
+func TestHandleLTP_IncludeTTL(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+	service.cache.SetTTL(30 * time.Second)
+	service.cache.SetTTLFunc(func(pair string) time.Duration {
+		if pair == "BTC/EUR" {
+			return 5 * time.Second
+		}
+		return 0
+	})
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pairs=BTC/USD,BTC/EUR&include=ttl", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.LTP) != 2 {
+		t.Fatalf("Expected 2 pairs, got %d", len(response.LTP))
+	}
+
+	for _, ltp := range response.LTP {
+		expected := 30.0
+		if ltp.Pair == "BTC/EUR" {
+			expected = 5.0
+		}
+		if ltp.TTLSeconds == nil || *ltp.TTLSeconds != expected {
+			t.Errorf("Expected %s ttl_seconds %v, got %v", ltp.Pair, expected, ltp.TTLSeconds)
+		}
+	}
+
+	// Absent unless requested
+	req = httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if strings.Contains(rec.Body.String(), "ttl_seconds") {
+		t.Errorf("Expected no ttl_seconds without include, got %s", rec.Body.String())
+	}
+}
+
+func TestHandleLTP_MultiStatus(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pairs=BTC/USD,ETH/USD&multistatus=true", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected status 207, got %d", rec.Code)
+	}
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.LTP) != 1 || response.LTP[0].Pair != "BTC/USD" {
+		t.Errorf("Expected BTC/USD to succeed, got %+v", response.LTP)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].Pair != "ETH/USD" {
+		t.Errorf("Expected an error for ETH/USD, got %+v", response.Errors)
+	}
+
+	// Without the option, or when every pair succeeds, the status is 200
+	for _, query := range []string{"pairs=BTC/USD,ETH/USD", "pairs=BTC/USD,BTC/EUR&multistatus=true"} {
+		req = httptest.NewRequest("GET", "/api/v1/ltp?"+query, nil)
+		rec = httptest.NewRecorder()
+		service.handleLTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestHandleLTP_SmoothedRawAmount(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"stub"}
+	cfg.PriceSmoothing = 0.5
+	provider := &stubProvider{name: "stub", price: 100}
+	service := serviceWithProviders(cfg, provider)
+
+	service.getLTP(context.Background(), []string{"BTC/USD"}, IncludeOptions{})
+	service.cache.SetTTL(0)
+	provider.price = 200
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&include=raw", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.LTP) != 1 {
+		t.Fatalf("Expected 1 pair, got %+v", response.LTP)
+	}
+	ltp := response.LTP[0]
+	if ltp.Amount.Value != 150 {
+		t.Errorf("Expected smoothed amount 150, got %v", ltp.Amount)
+	}
+	if ltp.RawAmount == nil || ltp.RawAmount.Value != 200 {
+		t.Errorf("Expected raw_amount 200, got %v", ltp.RawAmount)
+	}
+}
+
+func TestFetchTickerFromKraken_ZeroPrice(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["0.0","0.5"]}}}`))
+	}))
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	if _, err := service.fetchLTPFromKraken("BTC/USD"); err == nil {
+		t.Error("Expected a zero price to be rejected by default")
+	}
+
+	cfg := DefaultConfig()
+	cfg.AllowZeroPrice = true
+	if err := service.applyConfig(cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	price, err := service.fetchLTPFromKraken("BTC/USD")
+	if err != nil || price != 0 {
+		t.Errorf("Expected zero price with ALLOW_ZERO_PRICE, got %v, %v", price, err)
+	}
+}
+
+func TestHandleLTP_RequireExplicitPairs(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	for _, require := range []bool{true, false} {
+		cfg := DefaultConfig()
+		cfg.RequireExplicitPairs = require
+		service := NewServiceWithConfig(cfg)
+		service.krakenClient = mockServer.Client()
+		service.krakenBaseURL = mockServer.URL
+
+		req := httptest.NewRequest("GET", "/api/v1/ltp", nil)
+		rec := httptest.NewRecorder()
+		service.handleLTP(rec, req)
+
+		if require {
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400 for a bare request, got %d", rec.Code)
+			}
+
+			// Explicit pairs are still served
+			req = httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+			rec = httptest.NewRecorder()
+			service.handleLTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Errorf("Expected status 200 for an explicit pair, got %d", rec.Code)
+			}
+			continue
+		}
+
+		var response LTPResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(response.LTP) != len(supportedPairs) {
+			t.Errorf("Expected all %d default pairs, got %+v", len(supportedPairs), response.LTP)
+		}
+	}
+}
+
+func TestHandleLTP_DeprecatedPairs(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	cfg := DefaultConfig()
+	cfg.DeprecatedPairs = []string{"BTC/CHF"}
+	service := NewServiceWithConfig(cfg)
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pairs=BTC/USD,BTC/CHF", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	for _, ltp := range response.LTP {
+		if ltp.Deprecated != (ltp.Pair == "BTC/CHF") {
+			t.Errorf("Unexpected deprecated flag %v for %s", ltp.Deprecated, ltp.Pair)
+		}
+	}
+
+	warnings := rec.Header().Values("Warning")
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "BTC/CHF") || !strings.HasPrefix(warnings[0], "299 ") {
+		t.Errorf("Expected one 299 warning for BTC/CHF, got %v", warnings)
+	}
+}
+
+func TestRoutes_Prefix(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	cfg := DefaultConfig()
+	cfg.RoutePrefix = "/ltp-service"
+	cfg.OpsRoutePrefix = "/ops"
+	service := NewServiceWithConfig(cfg)
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+	handler := service.routes()
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/ltp-service/api/v1/ltp?pair=BTC/USD", http.StatusOK},
+		{"/ltp-service/api/v1/ltp/history/export", http.StatusOK},
+		{"/ops/health", http.StatusOK},
+		{"/api/v1/ltp?pair=BTC/USD", http.StatusNotFound},
+		{"/health", http.StatusNotFound},
+		{"/ltp-service/health", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.status, rec.Code)
+		}
+	}
+}
+
+func TestFetchTickerFromKraken_RetryOnParseError(t *testing.T) {
+	valid := `{"error":[],"result":{"XXBTZUSD":{"c":["45000.00","0.5"]}}}`
+
+	tests := []struct {
+		name      string
+		first     string
+		retry     bool
+		wantCalls int
+		wantErr   bool
+	}{
+		{"truncated, retry enabled", valid[:30], true, 2, false},
+		{"truncated, retry disabled", valid[:30], false, 1, true},
+		{"wrong shape isn't retried", `{"error":[],"result":"none"}`, true, 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls int
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls == 1 {
+					w.Write([]byte(test.first))
+					return
+				}
+				w.Write([]byte(valid))
+			}))
+			defer mockServer.Close()
+
+			cfg := DefaultConfig()
+			cfg.RetryOnParseError = test.retry
+			service := NewServiceWithConfig(cfg)
+			service.krakenClient = mockServer.Client()
+			service.krakenBaseURL = mockServer.URL
+
+			ticker, err := service.fetchTickerFromKraken(context.Background(), "BTC/USD")
+			if calls != test.wantCalls {
+				t.Errorf("Expected %d calls, got %d", test.wantCalls, calls)
+			}
+			if test.wantErr {
+				if err == nil {
+					t.Error("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected the retry to recover, got %v", err)
+			}
+			if ticker.Last != 45000 {
+				t.Errorf("Expected price 45000, got %v", ticker.Last)
+			}
+		})
+	}
+}
+
+func TestFetchTickerFromKraken_Warnings(t *testing.T) {
+	tests := []struct {
+		name    string
+		errors  string
+		wantErr bool
+	}{
+		{"warning only", `["WGeneral:Deprecated endpoint"]`, false},
+		{"warning and error", `["WGeneral:Deprecated endpoint","EGeneral:Internal error"]`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"error":` + test.errors + `,"result":{"XXBTZUSD":{"c":["45000.00","0.5"]}}}`))
+			}))
+			defer mockServer.Close()
+
+			service := NewService()
+			service.krakenClient = mockServer.Client()
+			service.krakenBaseURL = mockServer.URL
+
+			ticker, err := service.fetchTickerFromKraken(context.Background(), "BTC/USD")
+			if test.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "EGeneral:Internal error") {
+					t.Errorf("Expected the Kraken error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected warnings to be ignored, got %v", err)
+			}
+			if ticker.Last != 45000 {
+				t.Errorf("Expected price 45000, got %v", ticker.Last)
+			}
+		})
+	}
+}
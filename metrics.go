@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Labels qualify a metric sample, e.g. {"provider": "kraken"}
+type Labels map[string]string
+
+// Metrics is the backend instrumentation reports to. Implementations must be
+// safe for concurrent use.
+type Metrics interface {
+	IncCounter(name string, labels Labels)
+	ObserveHistogram(name string, value float64, labels Labels)
+	SetGauge(name string, value float64, labels Labels)
+}
+
+// ExemplarMetrics is implemented by backends that can attach an exemplar,
+// such as the trace ID of the request, to a histogram observation
+type ExemplarMetrics interface {
+	ObserveHistogramWithExemplar(name string, value float64, labels, exemplar Labels)
+}
+
+// Observe a histogram value, linking it to the request's trace as an
+// exemplar when the request was traced and the backend supports exemplars
+func observeHistogram(ctx context.Context, metrics Metrics, name string, value float64, labels Labels) {
+	if id := traceID(ctx); id != "" {
+		if exemplars, ok := metrics.(ExemplarMetrics); ok {
+			exemplars.ObserveHistogramWithExemplar(name, value, labels, Labels{"trace_id": id})
+			return
+		}
+	}
+	metrics.ObserveHistogram(name, value, labels)
+}
+
+// Names of the supported metrics backends
+const (
+	metricsBackendNone       = "none"
+	metricsBackendPrometheus = "prometheus"
+)
+
+// Create the metrics backend selected by name
+func newMetrics(backend string) Metrics {
+	if backend == metricsBackendPrometheus {
+		return newPrometheusMetrics()
+	}
+	return noopMetrics{}
+}
+
+// noopMetrics discards everything; used when no backend is configured
+type noopMetrics struct{}
+
+func (noopMetrics) IncCounter(string, Labels)                {}
+func (noopMetrics) ObserveHistogram(string, float64, Labels) {}
+func (noopMetrics) SetGauge(string, float64, Labels)         {}
+
+// Upper bounds of the histogram buckets, in the metric's unit. The defaults
+// suit durations in seconds; histograms of other units list their own.
+var (
+	defaultHistogramBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	histogramBuckets = map[string][]float64{
+		"http_response_size_bytes": {100, 250, 500, 1000, 2500, 5000, 10000, 25000, 50000, 100000},
+		"cache_hit_age_seconds":    {1, 2.5, 5, 10, 15, 20, 30, 60, 120, 300},
+	}
+)
+
+// Bucket bounds used for the named histogram
+func bucketsFor(name string) []float64 {
+	if buckets, ok := histogramBuckets[name]; ok {
+		return buckets
+	}
+	return defaultHistogramBuckets
+}
+
+// prometheusMetrics keeps metrics in memory and serves them in the
+// Prometheus text exposition format
+type prometheusMetrics struct {
+	mu         sync.Mutex
+	counters   map[string]map[string]float64
+	gauges     map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+}
+
+type histogram struct {
+	bounds    []float64
+	buckets   []uint64 // Cumulative counts per bound
+	count     uint64
+	sum       float64
+	exemplars []*exemplar // Latest exemplar per bucket, the last one being +Inf
+}
+
+// An observation linked to its trace, exposed in the OpenMetrics format
+type exemplar struct {
+	labels string
+	value  float64
+	at     time.Time
+}
+
+func newPrometheusMetrics() *prometheusMetrics {
+	return &prometheusMetrics{
+		counters:   make(map[string]map[string]float64),
+		gauges:     make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*histogram),
+	}
+}
+
+func (m *prometheusMetrics) IncCounter(name string, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series := m.counters[name]
+	if series == nil {
+		series = make(map[string]float64)
+		m.counters[name] = series
+	}
+	series[formatLabels(labels)]++
+}
+
+func (m *prometheusMetrics) SetGauge(name string, value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series := m.gauges[name]
+	if series == nil {
+		series = make(map[string]float64)
+		m.gauges[name] = series
+	}
+	series[formatLabels(labels)] = value
+}
+
+func (m *prometheusMetrics) ObserveHistogram(name string, value float64, labels Labels) {
+	m.ObserveHistogramWithExemplar(name, value, labels, nil)
+}
+
+func (m *prometheusMetrics) ObserveHistogramWithExemplar(name string, value float64, labels, exemplarLabels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series := m.histograms[name]
+	if series == nil {
+		series = make(map[string]*histogram)
+		m.histograms[name] = series
+	}
+
+	key := formatLabels(labels)
+	h := series[key]
+	if h == nil {
+		bounds := bucketsFor(name)
+		h = &histogram{
+			bounds:    bounds,
+			buckets:   make([]uint64, len(bounds)),
+			exemplars: make([]*exemplar, len(bounds)+1),
+		}
+		series[key] = h
+	}
+
+	// The exemplar belongs to the first bucket the value falls into
+	bucket := len(h.bounds)
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.buckets[i]++
+			bucket = min(bucket, i)
+		}
+	}
+	h.count++
+	h.sum += value
+
+	if len(exemplarLabels) > 0 {
+		h.exemplars[bucket] = &exemplar{labels: formatLabels(exemplarLabels), value: value, at: time.Now()}
+	}
+}
+
+// Content type of the OpenMetrics format, which unlike the Prometheus text
+// format can carry exemplars
+const openMetricsContentType = "application/openmetrics-text"
+
+// Serve the metrics for scraping, in the OpenMetrics format when the
+// scraper accepts it
+func (m *prometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), openMetricsContentType)
+	if openMetrics {
+		w.Header().Set("Content-Type", openMetricsContentType+"; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	}
+	if err := m.render(w, openMetrics); err != nil {
+		log.Printf("Error writing metrics: %v", err)
+	}
+}
+
+// Render every metric, sorted by name and labels. The OpenMetrics format
+// names counter families without their _total suffix, adds exemplars to
+// histogram buckets and ends with # EOF.
+func (m *prometheusMetrics) render(w io.Writer, openMetrics bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	for _, name := range sortedKeys(m.counters) {
+		family := name
+		if openMetrics {
+			family = strings.TrimSuffix(name, "_total")
+		}
+		fmt.Fprintf(&b, "# TYPE %s counter\n", family)
+		for _, labels := range sortedKeys(m.counters[name]) {
+			fmt.Fprintf(&b, "%s%s %s\n", name, labels, formatValue(m.counters[name][labels]))
+		}
+	}
+	for _, name := range sortedKeys(m.gauges) {
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		for _, labels := range sortedKeys(m.gauges[name]) {
+			fmt.Fprintf(&b, "%s%s %s\n", name, labels, formatValue(m.gauges[name][labels]))
+		}
+	}
+	for _, name := range sortedKeys(m.histograms) {
+		fmt.Fprintf(&b, "# TYPE %s histogram\n", name)
+		for _, labels := range sortedKeys(m.histograms[name]) {
+			h := m.histograms[name][labels]
+			for i, bound := range h.bounds {
+				fmt.Fprintf(&b, "%s_bucket%s %d%s\n", name, withLabel(labels, "le", formatValue(bound)), h.buckets[i], h.exemplars[i].format(openMetrics))
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d%s\n", name, withLabel(labels, "le", "+Inf"), h.count, h.exemplars[len(h.bounds)].format(openMetrics))
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, labels, formatValue(h.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, labels, h.count)
+		}
+	}
+
+	if openMetrics {
+		b.WriteString("# EOF\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Render the exemplar as a bucket suffix; only OpenMetrics has them
+func (e *exemplar) format(openMetrics bool) string {
+	if e == nil || !openMetrics {
+		return ""
+	}
+	at := strconv.FormatFloat(float64(e.at.UnixMilli())/1000, 'f', 3, 64)
+	return fmt.Sprintf(" # %s %s %s", e.labels, formatValue(e.value), at)
+}
+
+// Render labels as {a="1",b="2"}, sorted by name; empty for no labels
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(labels))
+	for _, name := range sortedKeys(labels) {
+		parts = append(parts, fmt.Sprintf("%s=%s", name, strconv.Quote(labels[name])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// Add one more label to an already formatted label set
+func withLabel(formatted, name, value string) string {
+	label := fmt.Sprintf("%s=%s", name, strconv.Quote(value))
+	if formatted == "" {
+		return "{" + label + "}"
+	}
+	return strings.TrimSuffix(formatted, "}") + "," + label + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Context key of the slot metricsMiddleware reports the matched route in
+type routeSlotKey struct{}
+
+// Count requests and observe their duration per route. It wraps the mux
+// directly so the matched route pattern is known once it returns.
+func metricsMiddleware(metrics Metrics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		if slot, ok := r.Context().Value(routeSlotKey{}).(*string); ok {
+			*slot = route
+		}
+		metrics.IncCounter("http_requests_total", Labels{"route": route, "status": strconv.Itoa(rec.status)})
+		metrics.ObserveHistogram("http_request_duration_seconds", time.Since(start).Seconds(), Labels{"route": route})
+	})
+}
+
+// Observe the size of response bodies as sent, after compression. It wraps
+// the compression middleware, so it learns the route from metricsMiddleware
+// further in.
+func responseSizeMiddleware(metrics Metrics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		route := "unmatched"
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), routeSlotKey{}, &route)))
+
+		metrics.ObserveHistogram("http_response_size_bytes", float64(rec.bytes), Labels{"route": route})
+	})
+}
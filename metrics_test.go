@@ -0,0 +1,290 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Fake metrics backend recording every call
+type recordingMetrics struct {
+	mu       sync.Mutex
+	counters []string
+	observed []string
+	gauges   []string
+	values   map[string]float64 // Last value observed per histogram series
+}
+
+func (m *recordingMetrics) IncCounter(name string, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters = append(m.counters, name+formatLabels(labels))
+}
+
+func (m *recordingMetrics) ObserveHistogram(name string, value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observed = append(m.observed, name+formatLabels(labels))
+	if m.values == nil {
+		m.values = make(map[string]float64)
+	}
+	m.values[name+formatLabels(labels)] = value
+}
+
+func (m *recordingMetrics) SetGauge(name string, value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges = append(m.gauges, name+formatLabels(labels))
+}
+
+func TestMetrics_RequestInstrumentation(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	metrics := &recordingMetrics{}
+	service.metrics = metrics
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	rec := httptest.NewRecorder()
+	service.routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	expectedCounters := []string{
+		`upstream_requests_total{provider="kraken",result="ok"}`,
+		`http_requests_total{route="/api/v1/ltp",status="200"}`,
+	}
+	for _, want := range expectedCounters {
+		if !slices.Contains(metrics.counters, want) {
+			t.Errorf("Expected counter %s, got %v", want, metrics.counters)
+		}
+	}
+
+	expectedHistograms := []string{
+		`upstream_request_duration_seconds{provider="kraken"}`,
+		`http_request_duration_seconds{route="/api/v1/ltp"}`,
+	}
+	for _, want := range expectedHistograms {
+		if !slices.Contains(metrics.observed, want) {
+			t.Errorf("Expected histogram %s, got %v", want, metrics.observed)
+		}
+	}
+
+	if !slices.Contains(metrics.gauges, "cache_entries") {
+		t.Errorf("Expected cache_entries gauge, got %v", metrics.gauges)
+	}
+}
+
+func TestMetrics_ResponseSize(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	metrics := &recordingMetrics{}
+	service.metrics = metrics
+
+	for _, target := range []string{"/api/v1/ltp?pairs=BTC/USD,BTC/EUR&include=spread", "/health"} {
+		req := httptest.NewRequest("GET", target, nil)
+		rec := httptest.NewRecorder()
+		service.routes().ServeHTTP(rec, req)
+
+		route, _, _ := strings.Cut(target, "?")
+		series := `http_response_size_bytes{route="` + route + `"}`
+		if got := metrics.values[series]; got != float64(rec.Body.Len()) {
+			t.Errorf("%s: expected recorded size %d, got %v", route, rec.Body.Len(), got)
+		}
+	}
+}
+
+func TestMetrics_ResponseSizeCompressed(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	cfg := DefaultConfig()
+	cfg.GzipLevel = gzip.BestCompression
+	cfg.GzipMinSize = 0
+	service := NewServiceWithConfig(cfg)
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	metrics := &recordingMetrics{}
+	service.metrics = metrics
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pairs=BTC/USD,BTC/EUR&include=spread,vwap", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	service.routes().ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a gzip response, got %q", rec.Header().Get("Content-Encoding"))
+	}
+	series := `http_response_size_bytes{route="/api/v1/ltp"}`
+	if got := metrics.values[series]; got != float64(rec.Body.Len()) {
+		t.Errorf("Expected the compressed size %d, got %v", rec.Body.Len(), got)
+	}
+}
+
+func TestPrometheusMetrics_Exposition(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MetricsBackend = metricsBackendPrometheus
+	service := NewServiceWithConfig(cfg)
+
+	service.metrics.IncCounter("upstream_requests_total", Labels{"provider": "kraken", "result": "ok"})
+	service.metrics.IncCounter("upstream_requests_total", Labels{"provider": "kraken", "result": "ok"})
+	service.metrics.SetGauge("cache_entries", 3, nil)
+	service.metrics.ObserveHistogram("upstream_request_duration_seconds", 0.2, Labels{"provider": "kraken"})
+	service.metrics.ObserveHistogram("http_response_size_bytes", 300, Labels{"route": "/health"})
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	rec := httptest.NewRecorder()
+	service.adminRoutes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	expected := []string{
+		"# TYPE upstream_requests_total counter",
+		`upstream_requests_total{provider="kraken",result="ok"} 2`,
+		"cache_entries 3",
+		`upstream_request_duration_seconds_bucket{provider="kraken",le="0.1"} 0`,
+		`upstream_request_duration_seconds_bucket{provider="kraken",le="0.25"} 1`,
+		`upstream_request_duration_seconds_bucket{provider="kraken",le="+Inf"} 1`,
+		`upstream_request_duration_seconds_count{provider="kraken"} 1`,
+		`http_response_size_bytes_bucket{route="/health",le="250"} 0`,
+		`http_response_size_bytes_bucket{route="/health",le="500"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected line %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestMetrics_NoEndpointByDefault(t *testing.T) {
+	service := NewService()
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	rec := httptest.NewRecorder()
+	service.adminRoutes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without a metrics backend, got %d", rec.Code)
+	}
+}
+
+func TestMetrics_NotOnPublicListener(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MetricsBackend = metricsBackendPrometheus
+	service := NewServiceWithConfig(cfg)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	rec := httptest.NewRecorder()
+	service.routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 on the public listener, got %d", rec.Code)
+	}
+}
+
+func TestMetrics_TraceExemplars(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	cfg := DefaultConfig()
+	cfg.MetricsBackend = metricsBackendPrometheus
+	service := NewServiceWithConfig(cfg)
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+	handler := service.routes()
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec := httptest.NewRecorder()
+	service.adminRoutes().ServeHTTP(rec, req)
+
+	body := rec.Body.String()
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/openmetrics-text") {
+		t.Errorf("Expected OpenMetrics content type, got %s", rec.Header().Get("Content-Type"))
+	}
+
+	var exemplarLine string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "upstream_request_duration_seconds_bucket") && strings.Contains(line, " # ") {
+			exemplarLine = line
+		}
+	}
+	if !strings.Contains(exemplarLine, `# {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"}`) {
+		t.Errorf("Expected an exemplar with the trace ID, got:\n%s", body)
+	}
+	if !strings.Contains(body, "# TYPE upstream_requests counter") || !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("Expected OpenMetrics counter family names and # EOF, got:\n%s", body)
+	}
+
+	// The Prometheus text format has no exemplars
+	rec = httptest.NewRecorder()
+	service.adminRoutes().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if strings.Contains(rec.Body.String(), "trace_id") {
+		t.Errorf("Expected no exemplars in the Prometheus text format, got:\n%s", rec.Body.String())
+	}
+}
+
+func TestMetrics_CacheHitAge(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MetricsBackend = metricsBackendPrometheus
+	service := NewServiceWithConfig(cfg)
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	service.cache.now = func() time.Time { return now }
+
+	fetch := func() {
+		if _, err := service.cache.GetOrFetch("BTC/USD", func() (float64, error) { return 45000, nil }); err != nil {
+			t.Fatalf("GetOrFetch failed: %v", err)
+		}
+	}
+
+	fetch() // Miss: not observed
+	now = start.Add(3 * time.Second)
+	fetch()
+	now = start.Add(12 * time.Second)
+	fetch()
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	rec := httptest.NewRecorder()
+	service.adminRoutes().ServeHTTP(rec, req)
+
+	body := rec.Body.String()
+	expected := []string{
+		`cache_hit_age_seconds_bucket{pair="BTC/USD",le="2.5"} 0`,
+		`cache_hit_age_seconds_bucket{pair="BTC/USD",le="5"} 1`,
+		`cache_hit_age_seconds_bucket{pair="BTC/USD",le="10"} 1`,
+		`cache_hit_age_seconds_bucket{pair="BTC/USD",le="15"} 2`,
+		`cache_hit_age_seconds_sum{pair="BTC/USD"} 15`,
+		`cache_hit_age_seconds_count{pair="BTC/USD"} 2`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected line %q in:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+type contextKey int
+
+const (
+	clientIPKey contextKey = iota
+	apiVersionKey
+	correlationIDKey
+	traceIDKey
+	providerOverrideKey
+)
+
+// Vendor media type prefix and suffix used to request a response version,
+// e.g. application/vnd.ltp.v1+json
+const (
+	vendorMediaPrefix = "application/vnd.ltp."
+	vendorMediaSuffix = "+json"
+)
+
+// statusRecorder captures the status code and body size written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Header carrying the correlation ID of a request
+const correlationIDHeader = "X-Correlation-ID"
+
+// Log each request with the client's real IP, status, duration and
+// correlation ID. A correlation ID sent by the client is reused, otherwise
+// one is generated; either way it's echoed in the response.
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(correlationIDHeader)
+		if !validCorrelationID(id) {
+			id = newCorrelationID()
+		}
+		w.Header().Set(correlationIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), correlationIDKey, id))
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		log.Printf("%s %s %s %d %v cid=%s", clientIP(r), r.Method, r.URL.RequestURI(), rec.status, time.Since(start), id)
+	})
+}
+
+// Accept client correlation IDs that are short and plain enough to log
+// safely
+func validCorrelationID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Generate a random correlation ID
+func newCorrelationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Generate a random (version 4) UUID
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Get the correlation ID assigned by loggingMiddleware, if any
+func correlationID(r *http.Request) string {
+	return contextCorrelationID(r.Context())
+}
+
+// Correlation ID of the request the context belongs to, if any
+func contextCorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey).(string)
+	return id
+}
+
+// Set standard hardening headers on every response. The CSP only matters for
+// HTML responses (such as debug pages) but is harmless on JSON.
+func securityHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Turn away requests that arrive once shutdown has begun with 503 and
+// Connection: close, so clients retry elsewhere instead of being cut off
+// mid-response. Requests already in flight aren't affected.
+func rejectDuringShutdownMiddleware(shuttingDown <-chan struct{}, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-shuttingDown:
+			w.Header().Set("Connection", "close")
+			http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+			return
+		default:
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// How a request path with a trailing slash is handled
+const (
+	trailingSlashRedirect = "redirect" // 308 to the path without the slash
+	trailingSlashServe    = "serve"    // Serve it as if the slash were absent
+)
+
+// Treat /path/ like /path, either by redirecting or by serving it directly.
+// Only the final slash is affected, so nested routes under a path still match.
+func trailingSlashMiddleware(mode string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if path == "/" || !strings.HasSuffix(path, "/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		trimmed := strings.TrimRight(path, "/")
+		if trimmed == "" {
+			trimmed = "/"
+		}
+
+		if mode == trailingSlashRedirect {
+			target := *r.URL
+			target.Path = trimmed
+			target.RawPath = ""
+			http.Redirect(w, r, target.RequestURI(), http.StatusPermanentRedirect)
+			return
+		}
+
+		rewritten := r.Clone(r.Context())
+		rewritten.URL.Path = trimmed
+		rewritten.URL.RawPath = ""
+		next.ServeHTTP(w, rewritten)
+	})
+}
+
+// Negotiate the response version from the Accept header. Clients that don't
+// ask for a vendor media type get the default version; a request naming only
+// unknown versions is rejected with 406.
+func apiVersionMiddleware(versions map[string]responseSerializer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested := requestedVersions(r)
+			if len(requested) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, version := range requested {
+				if _, ok := versions[version]; ok {
+					next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey, version)))
+					return
+				}
+			}
+			http.Error(w, fmt.Sprintf("Unsupported API version: %s", strings.Join(requested, ", ")), http.StatusNotAcceptable)
+		})
+	}
+}
+
+// Versions requested through vendor media types in the Accept header, in order
+func requestedVersions(r *http.Request) []string {
+	var versions []string
+	for _, header := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(header, ",") {
+			mediaType, _, _ := strings.Cut(mediaRange, ";")
+			mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+			if !strings.HasPrefix(mediaType, vendorMediaPrefix) || !strings.HasSuffix(mediaType, vendorMediaSuffix) {
+				continue
+			}
+			versions = append(versions, strings.TrimSuffix(strings.TrimPrefix(mediaType, vendorMediaPrefix), vendorMediaSuffix))
+		}
+	}
+	return versions
+}
+
+// Get the API version negotiated by apiVersionMiddleware, if any
+func apiVersion(r *http.Request) string {
+	version, _ := r.Context().Value(apiVersionKey).(string)
+	return version
+}
+
+// Derive the real client IP and stash it in the request context. Forwarding
+// headers are only honored when the direct peer is a trusted proxy, otherwise
+// any client could spoof its address.
+func realIPMiddleware(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolveClientIP(r, trusted)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey, ip)))
+		})
+	}
+}
+
+// Get the client IP stored by realIPMiddleware, falling back to the peer address
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+// Work out the originating client IP for a request
+func resolveClientIP(r *http.Request, trusted []netip.Prefix) string {
+	peer := remoteIP(r)
+	if !isTrustedProxy(peer, trusted) {
+		return peer
+	}
+
+	// Walk X-Forwarded-For right to left; the first untrusted hop is the client
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				break
+			}
+			if !isTrustedProxy(hop, trusted) || i == 0 {
+				return hop
+			}
+		}
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		if _, err := netip.ParseAddr(realIP); err == nil {
+			return realIP
+		}
+	}
+
+	return peer
+}
+
+// Strip the port from the request's remote address
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func isTrustedProxy(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
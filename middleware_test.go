@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRealIPMiddleware(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		realIP     string
+		expected   string
+	}{
+		{"trusted proxy with XFF", "10.0.0.1:1234", "203.0.113.7, 10.0.0.2", "", "203.0.113.7"},
+		{"trusted proxy with X-Real-IP", "10.0.0.1:1234", "", "198.51.100.4", "198.51.100.4"},
+		{"untrusted peer spoofing XFF", "192.0.2.9:1234", "203.0.113.7", "", "192.0.2.9"},
+		{"no forwarding headers", "10.0.0.1:1234", "", "", "10.0.0.1"},
+		{"spoofed hop before client", "10.0.0.1:1234", "1.1.1.1, 203.0.113.7", "", "203.0.113.7"},
+	}
+
+	for _, test := range tests {
+		var got string
+		handler := realIPMiddleware(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = clientIP(r)
+		}))
+
+		req := httptest.NewRequest("GET", "/api/v1/ltp", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.xff != "" {
+			req.Header.Set("X-Forwarded-For", test.xff)
+		}
+		if test.realIP != "" {
+			req.Header.Set("X-Real-IP", test.realIP)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got != test.expected {
+			t.Errorf("%s: clientIP = %s; want %s", test.name, got, test.expected)
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	service := NewService()
+
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	rec := httptest.NewRecorder()
+	service.routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	expected := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Content-Security-Policy": "default-src 'none'; frame-ancestors 'none'",
+	}
+	for header, value := range expected {
+		if got := rec.Header().Get(header); got != value {
+			t.Errorf("Expected %s %q, got %q", header, value, got)
+		}
+	}
+
+	// Disabled for pure-API setups
+	service.config.SecurityHeaders = false
+	rec = httptest.NewRecorder()
+	service.routes().ServeHTTP(rec, req)
+
+	if rec.Header().Get("X-Frame-Options") != "" {
+		t.Error("Expected no security headers when disabled")
+	}
+}
+
+func TestRejectDuringShutdown(t *testing.T) {
+	service := NewService()
+	handler := service.routes()
+
+	get := func(handler http.Handler) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+		return rec
+	}
+
+	if rec := get(handler); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 before shutdown, got %d", rec.Code)
+	}
+
+	service.beginShutdown()
+
+	rec := get(handler)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 during shutdown, got %d", rec.Code)
+	}
+	if rec.Header().Get("Connection") != "close" {
+		t.Errorf("Expected Connection: close, got %q", rec.Header().Get("Connection"))
+	}
+
+	// Disabled, requests keep being served until the server closes
+	service.config.RejectDuringShutdown = false
+	if rec := get(service.routes()); rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 when disabled, got %d", rec.Code)
+	}
+}
+
+func TestAPIVersionNegotiation(t *testing.T) {
+	service := NewService()
+
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	tests := []struct {
+		name        string
+		accept      string
+		status      int
+		contentType string
+	}{
+		{"no accept header", "", http.StatusOK, "application/json"},
+		{"generic json", "application/json", http.StatusOK, "application/json"},
+		{"v1", "application/vnd.ltp.v1+json", http.StatusOK, "application/vnd.ltp.v1+json"},
+		{"v1 among others", "application/vnd.ltp.v9+json, application/vnd.ltp.v1+json;q=0.5", http.StatusOK, "application/vnd.ltp.v1+json"},
+		{"unknown version", "application/vnd.ltp.v2+json", http.StatusNotAcceptable, ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		rec := httptest.NewRecorder()
+		service.routes().ServeHTTP(rec, req)
+
+		if rec.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.status, rec.Code)
+			continue
+		}
+		if test.contentType != "" && rec.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("%s: expected Content-Type %q, got %q", test.name, test.contentType, rec.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestTrailingSlash(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service := NewService()
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		rec := httptest.NewRecorder()
+		service.routes().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Redirect mode, the default
+	rec := serve("/api/v1/ltp/?pair=BTC/USD")
+	if rec.Code != http.StatusPermanentRedirect {
+		t.Fatalf("Expected status 308, got %d", rec.Code)
+	}
+	if location := rec.Header().Get("Location"); location != "/api/v1/ltp?pair=BTC/USD" {
+		t.Errorf("Expected redirect to /api/v1/ltp?pair=BTC/USD, got %q", location)
+	}
+
+	// Serve mode answers both forms the same way
+	service.config.TrailingSlash = trailingSlashServe
+	withSlash := serve("/api/v1/ltp/?pair=BTC/USD")
+	without := serve("/api/v1/ltp?pair=BTC/USD")
+
+	if withSlash.Code != http.StatusOK || without.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for both forms, got %d and %d", withSlash.Code, without.Code)
+	}
+	if withSlash.Body.String() != without.Body.String() {
+		t.Errorf("Expected identical bodies, got %q and %q", withSlash.Body.String(), without.Body.String())
+	}
+
+	// Nested routes are unaffected
+	if rec := serve("/api/v1/ltp/history/export/"); rec.Code != http.StatusOK {
+		t.Errorf("Expected nested route with slash to be served, got %d", rec.Code)
+	}
+}
+
+func TestLoggingMiddleware_CorrelationID(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	var seen string
+	handler := loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = correlationID(r)
+	}))
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	req.Header.Set("X-Correlation-ID", "client-abc-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("X-Correlation-ID"); got != "client-abc-123" {
+		t.Errorf("Expected correlation ID to be echoed, got %q", got)
+	}
+	if seen != "client-abc-123" {
+		t.Errorf("Expected handler to see the correlation ID, got %q", seen)
+	}
+	if !strings.Contains(logs.String(), "cid=client-abc-123") {
+		t.Errorf("Expected correlation ID in the log, got %q", logs.String())
+	}
+
+	// Generated when absent, or when the client's can't be logged safely
+	for _, sent := range []string{"", "bad id\nwith newline"} {
+		req = httptest.NewRequest("GET", "/health", nil)
+		if sent != "" {
+			req.Header.Set("X-Correlation-ID", sent)
+		}
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		got := rec.Header().Get("X-Correlation-ID")
+		if got == "" || got == sent {
+			t.Errorf("Expected a generated correlation ID for %q, got %q", sent, got)
+		}
+	}
+}
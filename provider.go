@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Provider fetches tickers from an upstream exchange
+type Provider interface {
+	Name() string
+	FetchTicker(ctx context.Context, pair string) (Ticker, error)
+}
+
+// Names of the built-in providers
+const (
+	providerKraken   = "kraken"
+	providerCoinbase = "coinbase"
+	providerScripted = "scripted"
+)
+
+// Ways of combining the configured providers
+const (
+	providerModeFallback  = "fallback"
+	providerModeAggregate = "aggregate"
+)
+
+// Attribution of a ticker combined from several providers
+const providerAggregate = "aggregate"
+
+// Providers that can be referenced from configuration
+var knownProviders = []string{providerKraken, providerCoinbase, providerScripted}
+
+// krakenProvider adapts the service's Kraken client to the Provider interface
+type krakenProvider struct {
+	s *Service
+}
+
+func (p krakenProvider) Name() string {
+	return providerKraken
+}
+
+func (p krakenProvider) FetchTicker(ctx context.Context, pair string) (Ticker, error) {
+	return p.s.fetchTickerFromKraken(ctx, pair)
+}
+
+// Fetch the ticker for a pair from upstream and record it in the history
+func (s *Service) fetchTicker(ctx context.Context, pair string) (Ticker, error) {
+	ticker, err := s.routeFetch(ctx, pair)
+	return s.recordFetch(pair, ticker, err)
+}
+
+// Record the outcome of fetching a pair: the error for /debug/errors, or
+// the price in the history
+func (s *Service) recordFetch(pair string, ticker Ticker, err error) (Ticker, error) {
+	s.lastErrors.Record(pair, err, s.cache.Now())
+	if err != nil {
+		return Ticker{}, err
+	}
+
+	s.history.Record(pair, ticker.Last, s.cache.Now())
+	return ticker, nil
+}
+
+// Fetch the ticker for a pair, routing to the provider pinned for the pair if
+// any, and otherwise combining the configured providers per the provider mode
+func (s *Service) routeFetch(ctx context.Context, pair string) (Ticker, error) {
+	cfg := s.cfg()
+	if name, pinned := cfg.ProviderPins[pair]; pinned {
+		provider, err := s.provider(name)
+		if err != nil {
+			return Ticker{}, err
+		}
+		return s.callProvider(ctx, provider, pair)
+	}
+
+	if cfg.ProviderMode == providerModeAggregate {
+		return s.aggregateFetch(ctx, pair, cfg.Providers)
+	}
+
+	var errs []error
+	for _, name := range cfg.Providers {
+		provider, err := s.provider(name)
+		if err != nil {
+			return Ticker{}, err
+		}
+
+		ticker, err := s.callProvider(ctx, provider, pair)
+		if err == nil {
+			return s.confirmAnomaly(ctx, pair, ticker), nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if len(errs) == 0 {
+		return Ticker{}, fmt.Errorf("no providers configured")
+	}
+	return Ticker{}, errors.Join(errs...)
+}
+
+// Fetch the ticker for a pair from the provider forced on the request
+func (s *Service) fetchFromOverride(ctx context.Context, name, pair string) (Ticker, error) {
+	provider, err := s.provider(name)
+	if err != nil {
+		return Ticker{}, err
+	}
+	return s.callProvider(ctx, provider, pair)
+}
+
+// Invoke a provider within its own configured timeout, so a slow provider
+// only spends its own budget before the caller moves on. Providers cooling
+// down after repeated failures aren't called at all.
+func (s *Service) callProvider(ctx context.Context, provider Provider, pair string) (Ticker, error) {
+	var ticker Ticker
+	err := s.instrumentProvider(ctx, provider.Name(), func(ctx context.Context) error {
+		var err error
+		ticker, err = provider.FetchTicker(ctx, pair)
+		return err
+	})
+	if err != nil {
+		return Ticker{}, err
+	}
+	ticker.Provider = provider.Name()
+	return ticker, nil
+}
+
+// Run one upstream call to the named provider the way every call is made:
+// skipped while the provider cools down, bounded by its timeout, and
+// counted towards its health, latency and request metrics
+func (s *Service) instrumentProvider(ctx context.Context, name string, call func(ctx context.Context) error) error {
+	if !s.providerHealth.Available(name) {
+		return ErrProviderCoolingDown
+	}
+
+	parent := ctx
+	if timeout, ok := s.cfg().ProviderTimeouts[name]; ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := call(ctx)
+	if err == nil || countsAsProviderFailure(parent, err) {
+		s.providerHealth.Record(name, err)
+	} else {
+		s.providerHealth.Abandon(name)
+	}
+
+	result := "ok"
+	if err != nil {
+		result = errorCategory(err)
+	}
+	elapsed := time.Since(start)
+	s.upstreamLatency.Record(name, elapsed)
+	s.latencies.Record(name, elapsed)
+	s.metrics.IncCounter("upstream_requests_total", Labels{"provider": name, "result": result})
+	observeHistogram(ctx, s.metrics, "upstream_request_duration_seconds", elapsed.Seconds(), Labels{"provider": name})
+
+	return err
+}
+
+// Force every fetch made with the returned context to go to the named
+// provider, bypassing pins, the fallback order and the cache
+func withProviderOverride(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, providerOverrideKey, name)
+}
+
+// Provider forced for the request the context belongs to, if any
+func providerOverride(ctx context.Context) string {
+	name, _ := ctx.Value(providerOverrideKey).(string)
+	return name
+}
+
+// Look up a registered provider by name
+func (s *Service) provider(name string) (Provider, error) {
+	provider, exists := s.providers[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown provider: %s", name)
+	}
+	return provider, nil
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Fake provider returning a fixed price and recording which pairs it served
+type stubProvider struct {
+	name  string
+	price float64
+	err   error
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (p *stubProvider) Name() string {
+	return p.name
+}
+
+func (p *stubProvider) FetchTicker(ctx context.Context, pair string) (Ticker, error) {
+	p.mu.Lock()
+	p.calls = append(p.calls, pair)
+	p.mu.Unlock()
+
+	if p.err != nil {
+		return Ticker{}, p.err
+	}
+	return Ticker{Last: p.price}, nil
+}
+
+func (p *stubProvider) callCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.calls)
+}
+
+// Build a service whose providers are replaced by the given stubs
+func serviceWithProviders(cfg Config, providers ...*stubProvider) *Service {
+	service := NewServiceWithConfig(cfg)
+	service.providers = make(map[string]Provider)
+	for _, p := range providers {
+		service.providers[p.name] = p
+	}
+	return service
+}
+
+func TestFetchTicker_FallbackOrder(t *testing.T) {
+	primary := &stubProvider{name: "primary", err: errors.New("down")}
+	secondary := &stubProvider{name: "secondary", price: 101}
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"primary", "secondary"}
+	service := serviceWithProviders(cfg, primary, secondary)
+
+	ticker, err := service.fetchTicker(context.Background(), "BTC/USD")
+	if err != nil {
+		t.Fatalf("fetchTicker failed: %v", err)
+	}
+
+	if ticker.Last != 101 || primary.callCount() != 1 {
+		t.Errorf("Expected fallback to secondary after primary failed, got %v", ticker.Last)
+	}
+}
+
+func TestFetchTicker_RecordsOnServiceClock(t *testing.T) {
+	provider := &stubProvider{name: "stub", price: 100, err: errors.New("down")}
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"stub"}
+	service := serviceWithProviders(cfg, provider)
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	service.cache.now = func() time.Time { return now }
+
+	service.fetchTicker(context.Background(), "BTC/USD")
+	if list := service.lastErrors.List(); len(list) != 1 || !list[0].At.Equal(now) {
+		t.Errorf("Expected the error recorded at %v, got %+v", now, list)
+	}
+
+	provider.err = nil
+	now = now.Add(time.Minute)
+	if _, err := service.fetchTicker(context.Background(), "BTC/USD"); err != nil {
+		t.Fatalf("fetchTicker failed: %v", err)
+	}
+	if samples := service.history.Samples("BTC/USD", time.Time{}); len(samples) != 1 || !samples[0].Time.Equal(now) {
+		t.Errorf("Expected one sample recorded at %v, got %+v", now, samples)
+	}
+}
+
+func TestFetchTicker_PinnedProvider(t *testing.T) {
+	primary := &stubProvider{name: "primary", price: 100}
+	pinned := &stubProvider{name: "pinned", price: 200}
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"primary", "pinned"}
+	cfg.ProviderPins = map[string]string{"BTC/CHF": "pinned"}
+	service := serviceWithProviders(cfg, primary, pinned)
+
+	ltpData, err := service.getLTP(context.Background(), []string{"BTC/CHF", "BTC/USD"}, IncludeOptions{})
+	if err != nil {
+		t.Fatalf("getLTP failed: %v", err)
+	}
+
+	// The pinned pair always uses its provider, even though primary would succeed
+	if ltpData[0].Amount.Value != 200 || ltpData[1].Amount.Value != 100 {
+		t.Errorf("Unexpected amounts: %+v", ltpData)
+	}
+
+	if len(primary.calls) != 1 || primary.calls[0] != "BTC/USD" {
+		t.Errorf("Expected primary to serve only BTC/USD, got %v", primary.calls)
+	}
+
+	// A failing pinned provider doesn't fall back
+	pinned.err = errors.New("down")
+	if _, err := service.fetchTicker(context.Background(), "BTC/CHF"); err == nil {
+		t.Error("Expected pinned provider failure not to fall back")
+	}
+}
+
+func TestCoinbaseProvider(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/products/BTC-USD/ticker" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"price":"45100.50","bid":"45100.00","ask":"45101.00","volume":"1234.5"}`))
+	}))
+	defer mockServer.Close()
+
+	provider := &coinbaseProvider{client: mockServer.Client(), baseURL: mockServer.URL}
+
+	ticker, err := provider.FetchTicker(context.Background(), "BTC/USD")
+	if err != nil {
+		t.Fatalf("FetchTicker failed: %v", err)
+	}
+
+	if ticker.Last != 45100.50 || ticker.Bid != 45100.00 || ticker.Ask != 45101.00 {
+		t.Errorf("Unexpected ticker: %+v", ticker)
+	}
+
+	if _, err := provider.FetchTicker(context.Background(), "BTC/CHF"); err == nil {
+		t.Error("Expected error for pair Coinbase doesn't list")
+	}
+}
+
+// Fake provider that hangs until its context ends, recording how long it waited
+type hangingProvider struct {
+	name string
+
+	mu      sync.Mutex
+	waited  time.Duration
+	ctxErrs []error
+}
+
+func (p *hangingProvider) Name() string {
+	return p.name
+}
+
+func (p *hangingProvider) FetchTicker(ctx context.Context, pair string) (Ticker, error) {
+	start := time.Now()
+	<-ctx.Done()
+
+	p.mu.Lock()
+	p.waited = time.Since(start)
+	p.ctxErrs = append(p.ctxErrs, ctx.Err())
+	p.mu.Unlock()
+
+	return Ticker{}, ctx.Err()
+}
+
+func TestFetchTicker_PerProviderTimeouts(t *testing.T) {
+	fast := &hangingProvider{name: "fast"}
+	slow := &hangingProvider{name: "slow"}
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"fast", "slow"}
+	cfg.ProviderTimeouts = map[string]time.Duration{
+		"fast": 30 * time.Millisecond,
+		"slow": 120 * time.Millisecond,
+	}
+	service := NewServiceWithConfig(cfg)
+	service.providers = map[string]Provider{"fast": fast, "slow": slow}
+
+	start := time.Now()
+	_, err := service.fetchTicker(context.Background(), "BTC/USD")
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("Expected both providers to time out")
+	}
+
+	// Each provider timed out on its own budget, and the first one's timeout
+	// didn't consume the second one's
+	if fast.waited < 30*time.Millisecond || fast.waited > 100*time.Millisecond {
+		t.Errorf("Expected fast provider to time out after ~30ms, waited %v", fast.waited)
+	}
+	if slow.waited < 120*time.Millisecond || slow.waited > 250*time.Millisecond {
+		t.Errorf("Expected slow provider to time out after ~120ms, waited %v", slow.waited)
+	}
+	if !errors.Is(fast.ctxErrs[0], context.DeadlineExceeded) || !errors.Is(slow.ctxErrs[0], context.DeadlineExceeded) {
+		t.Errorf("Expected deadline errors, got %v and %v", fast.ctxErrs, slow.ctxErrs)
+	}
+	if elapsed > 400*time.Millisecond {
+		t.Errorf("Expected fallback to complete within both budgets, took %v", elapsed)
+	}
+}
+
+func TestHandleLTP_IncludeSource(t *testing.T) {
+	krakenServer := failingKrakenServer()
+	defer krakenServer.Close()
+
+	coinbaseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"price":"45100.50","bid":"45100.00","ask":"45101.00","volume":"1234.5"}`))
+	}))
+	defer coinbaseServer.Close()
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{providerKraken, providerCoinbase}
+	cfg.CoinbaseBaseURL = coinbaseServer.URL
+	service := NewServiceWithConfig(cfg)
+	service.krakenClient = krakenServer.Client()
+	service.krakenBaseURL = krakenServer.URL
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&include=source", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.LTP) != 1 || response.LTP[0].Source != providerCoinbase {
+		t.Errorf("Expected source coinbase, got %+v", response.LTP)
+	}
+
+	// Without the flag live prices carry no source
+	req = httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if strings.Contains(rec.Body.String(), `"source"`) {
+		t.Errorf("Expected no source without include, got %s", rec.Body.String())
+	}
+}
+
+func TestCombineTickers_Attribution(t *testing.T) {
+	combined := combineTickers([]Ticker{{Last: 100, Provider: "kraken"}, {Last: 102, Provider: "coinbase"}})
+	if combined.Provider != providerAggregate {
+		t.Errorf("Expected provider aggregate, got %s", combined.Provider)
+	}
+
+	single := combineTickers([]Ticker{{Last: 100, Provider: "kraken"}})
+	if single.Provider != "kraken" {
+		t.Errorf("Expected provider kraken for a single sample, got %s", single.Provider)
+	}
+}
+
+func TestHandleLTP_ProviderOverride(t *testing.T) {
+	primary := &stubProvider{name: "primary", price: 100}
+	secondary := &stubProvider{name: "secondary", price: 200}
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"primary", "secondary"}
+	service := serviceWithProviders(cfg, primary, secondary)
+
+	// Warm the cache through the normal routing first
+	if _, err := service.getLTP(context.Background(), []string{"BTC/USD"}, IncludeOptions{}); err != nil {
+		t.Fatalf("getLTP failed: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&provider=secondary", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.LTP) != 1 || response.LTP[0].Amount.Value != 200 {
+		t.Errorf("Expected forced provider's price 200, got %+v", response.LTP)
+	}
+	if secondary.callCount() != 1 || primary.callCount() != 1 {
+		t.Errorf("Expected secondary to be asked despite the cached price, got primary=%d secondary=%d", primary.callCount(), secondary.callCount())
+	}
+
+	// The forced answer doesn't replace the routed one in the cache
+	if entry, ok := service.cache.Peek("BTC/USD"); !ok || entry.ticker.Last != 100 {
+		t.Errorf("Expected cached price to stay 100, got %v", entry.ticker.Last)
+	}
+}
+
+func TestHandleLTP_ProviderOverrideErrors(t *testing.T) {
+	primary := &stubProvider{name: "primary", price: 100}
+	unsupported := &stubProvider{name: "secondary", err: ErrUnsupportedPair}
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"primary", "secondary"}
+	service := serviceWithProviders(cfg, primary, unsupported)
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&provider=bitstamp", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown provider, got %d", rec.Code)
+	}
+
+	// A provider that can't serve the pair doesn't fall back to another
+	req = httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD&provider=secondary", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+	if rec.Code == http.StatusOK {
+		t.Errorf("Expected an error from the forced provider, got 200: %s", rec.Body.String())
+	}
+	if primary.callCount() != 0 {
+		t.Errorf("Expected primary not to be asked, got %d calls", primary.callCount())
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrProviderCoolingDown is returned instead of calling a provider that's
+// temporarily skipped after repeated failures
+var ErrProviderCoolingDown = errors.New("provider skipped after repeated failures")
+
+// providerHealth counts consecutive failures per provider and skips a
+// provider for a cooldown once it reaches the threshold. After the cooldown
+// one call is let through as a probe while the others keep being skipped:
+// success resets the count, failure restarts the cooldown.
+type providerHealth struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  map[string]int
+	until     map[string]time.Time
+	probing   map[string]bool // A probe after the cooldown is in progress
+
+	// Clock used for cooldowns; nil means time.Now
+	now func() time.Time
+}
+
+func newProviderHealth(threshold int, cooldown time.Duration) *providerHealth {
+	return &providerHealth{
+		threshold: threshold,
+		cooldown:  cooldown,
+		failures:  make(map[string]int),
+		until:     make(map[string]time.Time),
+		probing:   make(map[string]bool),
+	}
+}
+
+func (h *providerHealth) clock() time.Time {
+	if h.now == nil {
+		return time.Now()
+	}
+	return h.now()
+}
+
+// Available reports whether the provider may be called. Once its cooldown
+// is over, only the first caller is admitted, as the probe, until its
+// outcome is recorded or the probe is abandoned.
+func (h *providerHealth) Available(name string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.threshold <= 0 {
+		return true
+	}
+	until, coolingDown := h.until[name]
+	if !coolingDown {
+		return true
+	}
+	if h.clock().Before(until) || h.probing[name] {
+		return false
+	}
+	h.probing[name] = true
+	return true
+}
+
+// CoolingDown reports whether the provider is being skipped, without
+// admitting a probe
+func (h *providerHealth) CoolingDown(name string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	until, coolingDown := h.until[name]
+	return h.threshold > 0 && coolingDown && h.clock().Before(until)
+}
+
+// Abandon a call whose outcome says nothing about the provider's health,
+// letting the next caller probe it instead
+func (h *providerHealth) Abandon(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.probing, name)
+}
+
+// Record the outcome of a call to the provider
+func (h *providerHealth) Record(name string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.probing, name)
+	if err == nil {
+		h.failures[name] = 0
+		delete(h.until, name)
+		return
+	}
+
+	h.failures[name]++
+	if h.threshold > 0 && h.failures[name] >= h.threshold {
+		h.until[name] = h.clock().Add(h.cooldown)
+		log.Printf("Provider %s failed %d times in a row, skipping it for %v", name, h.failures[name], h.cooldown)
+	}
+}
+
+// Whether an error says something about the provider's health. Requests
+// cancelled by the client and pairs the provider doesn't list don't.
+func countsAsProviderFailure(parent context.Context, err error) bool {
+	return parent.Err() == nil && !errors.Is(err, ErrUnsupportedPair)
+}
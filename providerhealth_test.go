@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProviderHealth_SkipsDuringCooldown(t *testing.T) {
+	primary := &stubProvider{name: "primary", err: errors.New("down")}
+	secondary := &stubProvider{name: "secondary", price: 101}
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"primary", "secondary"}
+	cfg.ProviderFailureThreshold = 2
+	cfg.ProviderCooldown = time.Minute
+	service := serviceWithProviders(cfg, primary, secondary)
+
+	now := time.Now()
+	service.providerHealth.now = func() time.Time { return now }
+
+	fetch := func() {
+		t.Helper()
+		ticker, err := service.fetchTicker(context.Background(), "BTC/USD")
+		if err != nil || ticker.Last != 101 {
+			t.Fatalf("Expected fallback to secondary, got %v, %v", ticker.Last, err)
+		}
+	}
+
+	// Two failures trip the threshold
+	fetch()
+	fetch()
+	if primary.callCount() != 2 {
+		t.Fatalf("Expected 2 calls to primary, got %d", primary.callCount())
+	}
+
+	// Skipped during the cooldown
+	fetch()
+	fetch()
+	if primary.callCount() != 2 {
+		t.Errorf("Expected primary to be skipped during cooldown, got %d calls", primary.callCount())
+	}
+
+	// Retried after the cooldown, and recovers on success
+	now = now.Add(time.Minute)
+	primary.err = nil
+	primary.price = 100
+
+	ticker, err := service.fetchTicker(context.Background(), "BTC/USD")
+	if err != nil || ticker.Last != 100 {
+		t.Errorf("Expected primary to be retried after cooldown, got %v, %v", ticker.Last, err)
+	}
+	if primary.callCount() != 3 {
+		t.Errorf("Expected 3 calls to primary, got %d", primary.callCount())
+	}
+}
+
+func TestProviderHealth_IgnoresClientCancellation(t *testing.T) {
+	health := newProviderHealth(1, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if countsAsProviderFailure(ctx, context.Canceled) {
+		t.Error("Expected client cancellation not to count as a provider failure")
+	}
+	if countsAsProviderFailure(context.Background(), ErrUnsupportedPair) {
+		t.Error("Expected unsupported pairs not to count as a provider failure")
+	}
+
+	health.Record("kraken", ErrUpstreamMaintenance)
+	if health.Available("kraken") {
+		t.Error("Expected provider to be skipped after reaching the threshold")
+	}
+}
+
+func TestProviderHealth_HalfOpenAdmitsOneProbe(t *testing.T) {
+	provider := &gatedProvider{release: make(chan struct{}), calls: make(map[string]int)}
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"gated"}
+	cfg.ProviderFailureThreshold = 1
+	cfg.ProviderCooldown = time.Minute
+	service := NewServiceWithConfig(cfg)
+	service.providers = map[string]Provider{"gated": provider}
+
+	now := time.Now()
+	service.providerHealth.now = func() time.Time { return now }
+	service.providerHealth.Record("gated", errors.New("down"))
+	now = now.Add(time.Minute)
+
+	calls := func() int {
+		provider.mu.Lock()
+		defer provider.mu.Unlock()
+		return provider.calls["BTC/USD"]
+	}
+
+	// The probe blocks in the provider while the others arrive
+	probeDone := make(chan error, 1)
+	go func() {
+		_, err := service.callProvider(context.Background(), provider, "BTC/USD")
+		probeDone <- err
+	}()
+	deadline := time.Now().Add(time.Second)
+	for calls() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the probe to reach the provider")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = service.callProvider(context.Background(), provider, "BTC/USD")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if !errors.Is(err, ErrProviderCoolingDown) {
+			t.Errorf("Caller %d: expected ErrProviderCoolingDown during the probe, got %v", i, err)
+		}
+	}
+	if calls := calls(); calls != 1 {
+		t.Errorf("Expected only the probe to reach the provider, got %d calls", calls)
+	}
+
+	close(provider.release)
+	if err := <-probeDone; err != nil {
+		t.Fatalf("Expected the probe to succeed, got %v", err)
+	}
+	if !service.providerHealth.Available("gated") {
+		t.Error("Expected the provider to be available after a successful probe")
+	}
+}
+
+func TestProviderHealth_AbandonedProbe(t *testing.T) {
+	health := newProviderHealth(1, time.Minute)
+	now := time.Now()
+	health.now = func() time.Time { return now }
+
+	health.Record("kraken", errors.New("down"))
+	now = now.Add(time.Minute)
+
+	if !health.Available("kraken") || health.Available("kraken") {
+		t.Fatal("Expected exactly one probe to be admitted after the cooldown")
+	}
+	health.Abandon("kraken")
+	if !health.Available("kraken") {
+		t.Error("Expected a new probe after the previous one was abandoned")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Re-fetch the requested pairs from upstream regardless of their cache age
+// and return the fresh prices. Concurrent refreshes of a pair share one
+// upstream call. With RefreshMinInterval set, a pair fetched within it is
+// returned from the cache, so repeated refreshes can't burn the upstream
+// rate limit.
+func (s *Service) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var pairs []string
+	if pairParam := r.URL.Query().Get("pair"); pairParam != "" {
+		pairs = []string{pairParam}
+	} else if pairsParam := r.URL.Query().Get("pairs"); pairsParam != "" {
+		pairs = strings.Split(pairsParam, ",")
+	} else {
+		http.Error(w, "No pairs requested: pass pair or pairs", http.StatusBadRequest)
+		return
+	}
+
+	if maxPairs := s.cfg().MaxPairs; maxPairs > 0 && len(pairs) > maxPairs {
+		http.Error(w, fmt.Sprintf("Too many pairs: %d requested, at most %d allowed", len(pairs), maxPairs), http.StatusBadRequest)
+		return
+	}
+
+	for i, pair := range pairs {
+		pairs[i] = normalizePair(pair)
+		if pairs[i] == "" {
+			http.Error(w, fmt.Sprintf("Empty pair in request: %q", pair), http.StatusBadRequest)
+			return
+		}
+		if !s.isPairServed(pairs[i]) {
+			http.Error(w, fmt.Sprintf("Pair not served: %s", pairs[i]), http.StatusBadRequest)
+			return
+		}
+	}
+
+	response := LTPResponse{LTP: make([]PairLTP, 0, len(pairs))}
+	for _, pair := range pairs {
+		if entry, ok := s.cache.Peek(pair); ok && entry.source == "" && s.cache.age(entry) < s.cfg().RefreshMinInterval {
+			response.LTP = append(response.LTP, s.pairLTP(pair, entry, cacheHit, IncludeOptions{}))
+			continue
+		}
+
+		entry, err := s.cache.RefreshShared(pair, func() (Ticker, error) {
+			return s.fetchTicker(r.Context(), pair)
+		})
+		if err != nil {
+			log.Printf("Error refreshing %s: %v", pair, err)
+			response.Errors = append(response.Errors, PairError{Pair: pair, Message: err.Error(), err: err})
+			continue
+		}
+		response.LTP = append(response.LTP, s.pairLTP(pair, entry, cacheMiss, IncludeOptions{}))
+	}
+
+	status := http.StatusOK
+	if len(response.LTP) == 0 {
+		status = s.statusForError(joinPairErrors(response.Errors))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
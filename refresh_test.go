@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandleRefresh_ConcurrentRefreshesShareOneFetch(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["45000.00","0.5"]}}}`))
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.KrakenHosts = []string{server.URL}
+	service := NewServiceWithConfig(cfg)
+	handler := service.routes()
+
+	const clients = 20
+	var wg sync.WaitGroup
+	codes := make([]int, clients)
+	amounts := make([]Price, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", "/api/v1/ltp/refresh?pair=BTC/USD", nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			codes[i] = rec.Code
+			var response LTPResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err == nil && len(response.LTP) == 1 {
+				amounts[i] = response.LTP[0].Amount
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 upstream fetch, got %d", calls.Load())
+	}
+	for i := range codes {
+		if codes[i] != http.StatusOK || amounts[i].Value != 45000.00 {
+			t.Errorf("Client %d: expected 200 with 45000.00, got %d with %v", i, codes[i], amounts[i])
+		}
+	}
+
+	// A later refresh fetches again
+	req := httptest.NewRequest("POST", "/api/v1/ltp/refresh?pair=BTC/USD", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if calls.Load() != 2 {
+		t.Errorf("Expected a new fetch for a later refresh, got %d fetches", calls.Load())
+	}
+}
+
+func TestHandleRefresh_RejectsBadRequests(t *testing.T) {
+	service := NewService()
+
+	tests := []struct {
+		method string
+		url    string
+		status int
+	}{
+		{"GET", "/api/v1/ltp/refresh?pair=BTC/USD", http.StatusMethodNotAllowed},
+		{"POST", "/api/v1/ltp/refresh", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.url, nil)
+		rec := httptest.NewRecorder()
+		service.handleRefresh(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.url, tt.status, rec.Code)
+		}
+	}
+}
+
+func TestHandleRefresh_MinInterval(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["45000.00","0.5"]}}}`))
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.KrakenHosts = []string{server.URL}
+	cfg.RefreshMinInterval = time.Minute
+	service := NewServiceWithConfig(cfg)
+	handler := service.routes()
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/ltp/refresh?pair=BTC/USD", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("Refresh %d: expected status 200, got %d", i+1, rec.Code)
+		}
+	}
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected the second refresh not to reach upstream, got %d fetches", calls.Load())
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// How request-driven cache misses are handled
+const (
+	fetchModeOnDemand      = "on_demand"
+	fetchModeRefresherOnly = "refresher_only"
+)
+
+// Keep the cache warm and the Kraken host latencies current until ctx is done
+func (s *Service) runRefresher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.refreshOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run a single refresh cycle: probe the hosts, then re-fetch the pairs
+func (s *Service) refreshOnce(ctx context.Context) {
+	s.probeKrakenHosts(ctx)
+
+	// Batching only applies when Kraken is the first provider asked
+	cfg := s.cfg()
+	if cfg.RefreshBatch && cfg.ProviderMode == providerModeFallback && len(cfg.Providers) > 0 && cfg.Providers[0] == providerKraken {
+		s.refreshBatch(ctx, s.warmPairs())
+		return
+	}
+
+	for _, pair := range s.warmPairs() {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.refreshPair(ctx, pair); err != nil {
+			log.Printf("Error refreshing %s: %v", pair, err)
+		}
+	}
+}
+
+// Measure the latency to every configured Kraken host
+func (s *Service) probeKrakenHosts(ctx context.Context) {
+	hosts := s.krakenHosts.Hosts()
+	if len(hosts) < 2 {
+		return // Nothing to choose between
+	}
+
+	for _, host := range hosts {
+		probeCtx, cancel := context.WithTimeout(ctx, s.cfg().ReadinessTimeout)
+		start := time.Now()
+		err := s.pingKrakenHost(probeCtx, host)
+		cancel()
+
+		if err != nil {
+			log.Printf("Kraken host %s failed probe: %v", host, err)
+			s.krakenHosts.MarkFailed(host)
+			continue
+		}
+		s.krakenHosts.Record(host, time.Since(start))
+	}
+}
+
+// latencyTracker keeps the most recent latency of each Kraken host or provider
+type latencyTracker struct {
+	mu        sync.Mutex
+	hosts     []string
+	latencies map[string]time.Duration
+}
+
+// Hosts that failed their last probe sort after every healthy host
+const failedLatency = time.Duration(math.MaxInt64)
+
+func newLatencyTracker(hosts []string) *latencyTracker {
+	return &latencyTracker{
+		hosts:     hosts,
+		latencies: make(map[string]time.Duration),
+	}
+}
+
+func (t *latencyTracker) Hosts() []string {
+	return t.hosts
+}
+
+func (t *latencyTracker) Record(host string, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.latencies[host] = latency
+}
+
+// Latency returns the last latency recorded for host, if any
+func (t *latencyTracker) Latency(host string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	latency, ok := t.latencies[host]
+	return latency, ok
+}
+
+func (t *latencyTracker) MarkFailed(host string) {
+	t.Record(host, failedLatency)
+}
+
+// Fastest returns the healthy host with the lowest measured latency, or ""
+// if no host has been measured successfully yet
+func (t *latencyTracker) Fastest() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	measured := make([]string, 0, len(t.latencies))
+	for host, latency := range t.latencies {
+		if latency != failedLatency {
+			measured = append(measured, host)
+		}
+	}
+	if len(measured) == 0 {
+		return ""
+	}
+
+	sort.Slice(measured, func(i, j int) bool {
+		return t.latencies[measured[i]] < t.latencies[measured[j]]
+	})
+	return measured[0]
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Mock Kraken host that answers every request after the given delay
+func delayedKrakenServer(delay time.Duration, tickerHits *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		if r.URL.Path == "/0/public/Ticker" {
+			tickerHits.Add(1)
+			w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["45000.00","0.5"]}}}`))
+			return
+		}
+		w.Write([]byte(`{"error":[],"result":{"unixtime":1700000000}}`))
+	}))
+}
+
+func TestProbeKrakenHosts_PrefersFastest(t *testing.T) {
+	var slowHits, fastHits atomic.Int32
+	slow := delayedKrakenServer(100*time.Millisecond, &slowHits)
+	defer slow.Close()
+	fast := delayedKrakenServer(0, &fastHits)
+	defer fast.Close()
+
+	cfg := DefaultConfig()
+	cfg.KrakenHosts = []string{slow.URL, fast.URL}
+	service := NewServiceWithConfig(cfg)
+
+	// Before probing, the first configured host is used
+	if got := service.krakenURL(); got != slow.URL {
+		t.Errorf("Expected first host before probing, got %s", got)
+	}
+
+	service.probeKrakenHosts(context.Background())
+
+	if got := service.krakenURL(); got != fast.URL {
+		t.Errorf("Expected fastest host %s, got %s", fast.URL, got)
+	}
+
+	if _, err := service.fetchLTPFromKraken("BTC/USD"); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	if fastHits.Load() != 1 || slowHits.Load() != 0 {
+		t.Errorf("Expected fetch on fast host only, got fast=%d slow=%d", fastHits.Load(), slowHits.Load())
+	}
+}
+
+func TestLatencyTracker_SkipsFailedHosts(t *testing.T) {
+	tracker := newLatencyTracker([]string{"a", "b"})
+
+	if tracker.Fastest() != "" {
+		t.Error("Expected no fastest host before any measurement")
+	}
+
+	tracker.Record("a", 10*time.Millisecond)
+	tracker.Record("b", 50*time.Millisecond)
+	tracker.MarkFailed("a")
+
+	if got := tracker.Fastest(); got != "b" {
+		t.Errorf("Expected healthy host b, got %s", got)
+	}
+}
+
+func TestRefreshOnce_KeepsWarmPairsFresh(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DefaultPairs = []string{"BTC/USD"}
+	cfg.WarmPairs = []string{"BTC/USD", "BTC/EUR"}
+	cfg.CacheTTL = 50 * time.Millisecond
+	service := NewServiceWithConfig(cfg)
+
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	service.refreshOnce(context.Background())
+
+	// BTC/EUR isn't a default pair, but the refresher warmed it
+	entry, ok := service.cache.fresh("BTC/EUR")
+	if !ok || entry.ticker.Last != 42000.0 {
+		t.Errorf("Expected fresh BTC/EUR entry, got %+v (fresh=%v)", entry, ok)
+	}
+
+	// Once expired, the next cycle refreshes it again
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := service.cache.fresh("BTC/EUR"); ok {
+		t.Fatal("Expected BTC/EUR entry to have expired")
+	}
+	service.refreshOnce(context.Background())
+	if _, ok := service.cache.fresh("BTC/EUR"); !ok {
+		t.Error("Expected BTC/EUR to be refreshed")
+	}
+
+	if pairs := service.defaultPairs(); len(pairs) != 1 || pairs[0] != "BTC/USD" {
+		t.Errorf("Expected default pairs [BTC/USD], got %v", pairs)
+	}
+}
+
+func TestRefresherOnlyMode(t *testing.T) {
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	cfg := DefaultConfig()
+	cfg.FetchMode = fetchModeRefresherOnly
+	cfg.WarmPairs = []string{"BTC/USD"}
+	cfg.CacheTTL = time.Minute
+	service := NewServiceWithConfig(cfg)
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	service.refreshOnce(context.Background())
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for a warmed pair, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/EUR", nil)
+	rec = httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 for an unwarmed pair, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "not kept warm") {
+		t.Errorf("Expected not-available error, got %q", rec.Body.String())
+	}
+
+	if entries := service.cache.Entries(); len(entries) != 1 {
+		t.Errorf("Expected no on-demand fetch, got %d cached pairs", len(entries))
+	}
+}
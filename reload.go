@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+)
+
+// Config fields that can change at runtime. Everything else is bound at
+// startup (listeners, middleware, background loops, buffers) and needs a
+// restart to take effect.
+var reloadableConfigFields = map[string]bool{
+	"CacheTTL":              true,
+	"CacheTTLMin":           true,
+	"CacheTTLMax":           true,
+	"AdaptiveTTLVolatility": true,
+	"FetchDelay":            true,
+	"StaleIfError":          true,
+	"ResponseBudget":        true,
+	"StaleWhileSlow":        true,
+	"SyncRefreshAge":        true,
+	"AllowZeroPrice":        true,
+	"ClockSkewTolerance":    true,
+	"ClockSkewMax":          true,
+	"PriceSmoothing":        true,
+	"PriceEpsilon":          true,
+	"SignificantDigits":     true,
+	"ConfidenceWeights":     true,
+	"ConfidenceMaxAge":      true,
+	"AggregateWeighting":    true,
+	"AnomalyThreshold":      true,
+	"ValidatePairs":         true,
+	"SoftTimeout":           true,
+	"FallbackOrder":         true,
+	"ServePairs":            true,
+	"RequireExplicitPairs":  true,
+	"RefreshBatch":          true,
+	"BatchBackfill":         true,
+	"PrimaryCurrency":       true,
+	"DefaultPairs":          true,
+	"DefaultInclude":        true,
+	"DeprecatedPairs":       true,
+	"WarmPairs":             true,
+	"MaxPairs":              true,
+	"MaxBodySize":           true,
+	"Providers":             true,
+	"ProviderMode":          true,
+	"ProviderPins":          true,
+	"ProviderTimeouts":      true,
+	"ErrorStatuses":         true,
+	"EmptyOK":               true,
+	"SinglePairErrors":      true,
+	"ShareResponses":        true,
+	"RetryOnParseError":     true,
+	"DeepCheckPair":         true,
+	"DeepCheckInterval":     true,
+	"ReadinessTimeout":      true,
+	"ShutdownTimeout":       true,
+	"ShutdownDelay":         true,
+	"RefreshMinInterval":    true,
+}
+
+// Get a consistent copy of the current configuration
+func (s *Service) cfg() Config {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config
+}
+
+// Reload the configuration from the environment and CONFIG_FILE each time
+// SIGHUP arrives
+func (s *Service) reloadOnSIGHUP(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Printf("SIGHUP received, reloading configuration")
+			s.reloadFromEnv()
+		}
+	}
+}
+
+// Re-read the environment and CONFIG_FILE and apply them; an invalid configuration is
+// rejected as a whole and the current one stays in effect
+func (s *Service) reloadFromEnv() {
+	next, err := LoadConfig()
+	if err == nil {
+		err = s.applyConfig(next)
+	}
+	if err != nil {
+		log.Printf("Config reload failed, keeping current configuration: %v", err)
+	}
+}
+
+// Apply the reloadable fields of next and log every change. Changes to
+// fields that require a restart are ignored with a warning. The result is
+// checked like a configuration at startup and rejected as a whole if
+// invalid. In-flight requests keep the configuration they started with.
+func (s *Service) applyConfig(next Config) error {
+	s.configMu.Lock()
+
+	merged := s.config
+	target := reflect.ValueOf(&merged).Elem()
+	incoming := reflect.ValueOf(next)
+	configType := target.Type()
+
+	var changes []string
+	for i := 0; i < configType.NumField(); i++ {
+		name := configType.Field(i).Name
+		oldValue, newValue := target.Field(i), incoming.Field(i)
+		if reflect.DeepEqual(oldValue.Interface(), newValue.Interface()) {
+			continue
+		}
+
+		if !reloadableConfigFields[name] {
+			changes = append(changes, fmt.Sprintf("Config %s changed but requires a restart; ignoring", name))
+			continue
+		}
+
+		changes = append(changes, fmt.Sprintf("Config %s changed: %v -> %v", name, oldValue.Interface(), newValue.Interface()))
+		oldValue.Set(newValue)
+	}
+
+	if merged.ValidatePairs {
+		if err := validatePairs(merged); err != nil {
+			s.configMu.Unlock()
+			return err
+		}
+	}
+	for _, change := range changes {
+		log.Print(change)
+	}
+	s.config = merged
+
+	ttl, staleIfError, softTimeout := s.config.CacheTTL, s.config.StaleIfError, s.config.SoftTimeout
+	syncRefreshAge := s.config.SyncRefreshAge
+	smoothing, epsilon, skewTolerance := s.config.PriceSmoothing, s.config.PriceEpsilon, s.config.ClockSkewTolerance
+	fallbackOrder, maxSkew := s.config.FallbackOrder, s.config.ClockSkewMax
+	s.configMu.Unlock()
+
+	s.cache.SetTTL(ttl)
+	s.cache.SetStaleIfError(staleIfError)
+	s.cache.SetSoftTimeout(softTimeout)
+	s.cache.SetSyncRefreshAge(syncRefreshAge)
+	s.cache.SetFallbackOrder(fallbackOrder)
+	s.cache.SetSmoothing(smoothing)
+	s.cache.SetPriceEpsilon(epsilon)
+	s.cache.SetClockSkewTolerance(skewTolerance)
+	s.cache.SetMaxClockSkew(maxSkew)
+	return nil
+}
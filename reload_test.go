@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReloadFromEnv(t *testing.T) {
+	service := NewService()
+	service.config.Port = "8080"
+	service.config.CacheTTL = 10 * time.Second
+	service.cache.SetTTL(10 * time.Second)
+
+	t.Setenv("PORT", "9000")
+	t.Setenv("CACHE_TTL", "1ms")
+	t.Setenv("DEFAULT_PAIRS", "BTC/EUR")
+
+	service.reloadFromEnv()
+
+	cfg := service.cfg()
+	if cfg.CacheTTL != time.Millisecond {
+		t.Errorf("Expected TTL 1ms, got %v", cfg.CacheTTL)
+	}
+
+	if cfg.Port != "8080" {
+		t.Errorf("Expected port change to be ignored, got %s", cfg.Port)
+	}
+
+	if pairs := service.defaultPairs(); len(pairs) != 1 || pairs[0] != "BTC/EUR" {
+		t.Errorf("Expected default pairs [BTC/EUR], got %v", pairs)
+	}
+
+	// The cache picks up the new TTL for existing entries
+	service.cache.GetOrFetch("BTC/USD", func() (float64, error) { return 1, nil })
+	time.Sleep(5 * time.Millisecond)
+
+	calls := 0
+	service.cache.GetOrFetch("BTC/USD", func() (float64, error) {
+		calls++
+		return 2, nil
+	})
+	if calls != 1 {
+		t.Errorf("Expected entry to expire under the reloaded TTL, got %d fetches", calls)
+	}
+}
+
+func TestReloadFromEnv_InvalidKeepsCurrent(t *testing.T) {
+	service := NewService()
+	service.config.CacheTTL = 10 * time.Second
+
+	t.Setenv("CACHE_TTL", "soon")
+
+	service.reloadFromEnv()
+
+	if ttl := service.cfg().CacheTTL; ttl != 10*time.Second {
+		t.Errorf("Expected TTL to stay 10s, got %v", ttl)
+	}
+}
+
+func TestApplyConfig_ValidatesPairs(t *testing.T) {
+	service := NewService()
+	service.config.DefaultPairs = []string{"BTC/USD"}
+
+	next := service.cfg()
+	next.DefaultPairs = []string{"BTC/USX"}
+	next.CacheTTL = time.Second
+	if err := service.applyConfig(next); !errors.Is(err, ErrUnsupportedPair) {
+		t.Errorf("Expected ErrUnsupportedPair, got %v", err)
+	}
+
+	// The whole reload is rejected, not just the bad pair list
+	cfg := service.cfg()
+	if len(cfg.DefaultPairs) != 1 || cfg.DefaultPairs[0] != "BTC/USD" {
+		t.Errorf("Expected default pairs to stay [BTC/USD], got %v", cfg.DefaultPairs)
+	}
+	if cfg.CacheTTL == time.Second {
+		t.Error("Expected the TTL change to be rejected along with the pairs")
+	}
+
+	next.ValidatePairs = false
+	if err := service.applyConfig(next); err != nil {
+		t.Errorf("Expected no error with VALIDATE_PAIRS=false, got %v", err)
+	}
+	if pairs := service.cfg().DefaultPairs; len(pairs) != 1 || pairs[0] != "BTC/USX" {
+		t.Errorf("Expected default pairs [BTC/USX], got %v", pairs)
+	}
+}
+
+func TestReloadOnSIGHUP_ConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ltp.env")
+	writeConfig := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("# initial settings\nCACHE_TTL=10s\n")
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("CACHE_TTL", "1m")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.CacheTTL != 10*time.Second {
+		t.Fatalf("Expected CONFIG_FILE to override the environment with 10s, got %v", cfg.CacheTTL)
+	}
+
+	// Keep SIGHUP from terminating the test binary while the service's
+	// handler is still being registered
+	ignored := make(chan os.Signal, 1)
+	signal.Notify(ignored, syscall.SIGHUP)
+	defer signal.Stop(ignored)
+
+	service := NewServiceWithConfig(cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.reloadOnSIGHUP(ctx)
+
+	// Signal until the reload shows up; the first signals may arrive before
+	// the handler is registered
+	sighupUntil := func(done func(Config) bool) bool {
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); {
+			syscall.Kill(os.Getpid(), syscall.SIGHUP)
+			time.Sleep(10 * time.Millisecond)
+			if done(service.cfg()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	writeConfig("CACHE_TTL=20s\nDEFAULT_PAIRS=\"BTC/EUR\"\n")
+	if !sighupUntil(func(cfg Config) bool { return cfg.CacheTTL == 20*time.Second }) {
+		t.Fatalf("Expected the first SIGHUP to apply TTL 20s, got %v", service.cfg().CacheTTL)
+	}
+	if pairs := service.cfg().DefaultPairs; len(pairs) != 1 || pairs[0] != "BTC/EUR" {
+		t.Errorf("Expected default pairs [BTC/EUR], got %v", pairs)
+	}
+
+	writeConfig("CACHE_TTL=30s\n")
+	if !sighupUntil(func(cfg Config) bool { return cfg.CacheTTL == 30*time.Second }) {
+		t.Fatalf("Expected the second SIGHUP to apply TTL 30s, got %v", service.cfg().CacheTTL)
+	}
+	if ttl := service.cache.TTLOf(CacheEntry{}); ttl != 30*time.Second {
+		t.Errorf("Expected the cache to use TTL 30s, got %v", ttl)
+	}
+
+	// A malformed file is rejected and the current configuration stays
+	writeConfig("CACHE_TTL\n")
+	service.reloadFromEnv()
+	if ttl := service.cfg().CacheTTL; ttl != 30*time.Second {
+		t.Errorf("Expected TTL to stay 30s, got %v", ttl)
+	}
+}
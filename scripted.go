@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrScriptExhausted is returned by a ScriptedProvider once a non-looping
+// script has no prices left for a pair
+var ErrScriptExhausted = errors.New("scripted prices exhausted")
+
+// ScriptedProvider returns a predefined sequence of prices per pair, one per
+// fetch, for driving features that depend on price movement (smoothing,
+// history, ranges) deterministically. With loop set it starts over at the
+// end of a pair's sequence; otherwise further fetches fail.
+type ScriptedProvider struct {
+	name   string
+	script map[string][]float64
+	loop   bool
+
+	mu   sync.Mutex
+	next map[string]int
+}
+
+// NewScriptedProvider creates a provider that registers under name and
+// answers each pair from its sequence in script
+func NewScriptedProvider(name string, script map[string][]float64, loop bool) *ScriptedProvider {
+	return &ScriptedProvider{
+		name:   name,
+		script: script,
+		loop:   loop,
+		next:   make(map[string]int),
+	}
+}
+
+// Read the prices for the scripted provider from a JSON file mapping each
+// pair to its sequence, e.g. {"BTC/USD": [45000, 45100, 44900]}
+func loadScriptedPrices(path string) (map[string][]float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string][]float64
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string][]float64, len(raw))
+	for pair, sequence := range raw {
+		if len(sequence) == 0 {
+			return nil, fmt.Errorf("no prices for pair %s", pair)
+		}
+		prices[normalizePair(pair)] = sequence
+	}
+	if len(prices) == 0 {
+		return nil, fmt.Errorf("no pairs in %s", path)
+	}
+	return prices, nil
+}
+
+func (p *ScriptedProvider) Name() string {
+	return p.name
+}
+
+func (p *ScriptedProvider) FetchTicker(ctx context.Context, pair string) (Ticker, error) {
+	prices, exists := p.script[pair]
+	if !exists || len(prices) == 0 {
+		return Ticker{}, fmt.Errorf("%w: %s", ErrUnsupportedPair, pair)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	i := p.next[pair]
+	if i >= len(prices) {
+		if !p.loop {
+			return Ticker{}, fmt.Errorf("%w for pair %s after %d prices", ErrScriptExhausted, pair, len(prices))
+		}
+		i = 0
+	}
+	p.next[pair] = i + 1
+
+	return Ticker{Last: prices[i]}, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScriptedProvider_Sequence(t *testing.T) {
+	provider := NewScriptedProvider("scripted", map[string][]float64{"BTC/USD": {1, 2}}, false)
+
+	for _, expected := range []float64{1, 2} {
+		ticker, err := provider.FetchTicker(context.Background(), "BTC/USD")
+		if err != nil || ticker.Last != expected {
+			t.Errorf("Expected %v, got %v (err %v)", expected, ticker.Last, err)
+		}
+	}
+
+	if _, err := provider.FetchTicker(context.Background(), "BTC/USD"); !errors.Is(err, ErrScriptExhausted) {
+		t.Errorf("Expected ErrScriptExhausted, got %v", err)
+	}
+	if _, err := provider.FetchTicker(context.Background(), "BTC/EUR"); !errors.Is(err, ErrUnsupportedPair) {
+		t.Errorf("Expected ErrUnsupportedPair for an unscripted pair, got %v", err)
+	}
+
+	looping := NewScriptedProvider("scripted", map[string][]float64{"BTC/USD": {1, 2}}, true)
+	var got []float64
+	for i := 0; i < 5; i++ {
+		ticker, _ := looping.FetchTicker(context.Background(), "BTC/USD")
+		got = append(got, ticker.Last)
+	}
+	if got[2] != 1 || got[4] != 1 {
+		t.Errorf("Expected the looping script to start over, got %v", got)
+	}
+}
+
+func TestScriptedProvider_DrivesHistory(t *testing.T) {
+	script := []float64{100, 101, 99, 103, 102}
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"scripted"}
+	cfg.HistorySize = 3
+	service := NewServiceWithConfig(cfg)
+	service.providers = map[string]Provider{
+		"scripted": NewScriptedProvider("scripted", map[string][]float64{"BTC/USD": script}, false),
+	}
+
+	for range script {
+		if _, err := service.fetchTicker(context.Background(), "BTC/USD"); err != nil {
+			t.Fatalf("fetchTicker failed: %v", err)
+		}
+	}
+
+	// The buffer keeps the last three prices of the sequence, oldest first
+	samples := service.history.Samples("BTC/USD", time.Time{})
+	expected := []float64{99, 103, 102}
+	if len(samples) != len(expected) {
+		t.Fatalf("Expected %d samples, got %d", len(expected), len(samples))
+	}
+	for i, sample := range samples {
+		if sample.Price != expected[i] {
+			t.Errorf("Sample %d: expected %v, got %v", i, expected[i], sample.Price)
+		}
+	}
+
+	priceRange := service.history.Range("BTC/USD", time.Time{})
+	if priceRange.Low != 99 || priceRange.High != 103 {
+		t.Errorf("Expected range 99-103, got %v-%v", priceRange.Low, priceRange.High)
+	}
+}
+
+func TestLoadConfig_ScriptedProvider(t *testing.T) {
+	t.Setenv("PROVIDERS", "scripted")
+
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected an error for the scripted provider without SCRIPTED_PRICES_FILE")
+	}
+
+	path := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(path, []byte(`{"btc/usd": [100, 101]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SCRIPTED_PRICES_FILE", path)
+	t.Setenv("SCRIPTED_LOOP", "true")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	service := NewServiceWithConfig(cfg)
+
+	var got []float64
+	for i := 0; i < 3; i++ {
+		ticker, err := service.fetchTicker(context.Background(), "BTC/USD")
+		if err != nil {
+			t.Fatalf("fetchTicker failed: %v", err)
+		}
+		got = append(got, ticker.Last)
+	}
+	if got[0] != 100 || got[1] != 101 || got[2] != 100 {
+		t.Errorf("Expected [100 101 100], got %v", got)
+	}
+
+	for _, content := range []string{`{"BTC/USD": []}`, `{}`, `not json`} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConfig(); err == nil {
+			t.Errorf("Expected an error for SCRIPTED_PRICES_FILE containing %s", content)
+		}
+	}
+}
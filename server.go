@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// boundListener pairs a listener with the handler served on it
+type boundListener struct {
+	name    string
+	ln      net.Listener
+	handler http.Handler
+}
+
+// Serve HTTP on the listeners until ctx is cancelled, then shut down
+// gracefully, giving in-flight requests up to the configured shutdown
+// timeout to drain. If any server fails, all of them are shut down.
+func (s *Service) serve(ctx context.Context, listeners ...boundListener) error {
+	servers := make([]*http.Server, len(listeners))
+	errCh := make(chan error, len(listeners))
+
+	for i, l := range listeners {
+		srv := &http.Server{Handler: l.handler}
+		servers[i] = srv
+		go func(name string, ln net.Listener) {
+			err := srv.Serve(ln)
+			if !errors.Is(err, http.ErrServerClosed) {
+				err = fmt.Errorf("%s listener: %w", name, err)
+			}
+			errCh <- err
+		}(l.name, l.ln)
+	}
+
+	var serveErr error
+	select {
+	case serveErr = <-errCh:
+		log.Printf("Server failed: %v", serveErr)
+	case <-ctx.Done():
+	}
+
+	// Signal shutdown before the servers stop accepting, so requests still
+	// arriving are turned away and long-lived connections (streams, long
+	// polls) close themselves instead of holding the drain for the full
+	// timeout
+	s.beginShutdown()
+	if delay := s.cfg().ShutdownDelay; delay > 0 && serveErr == nil {
+		log.Printf("Shutting down, rejecting new requests for %v before closing listeners", delay)
+		time.Sleep(delay)
+	}
+
+	timeout := s.cfg().ShutdownTimeout
+	log.Printf("Shutting down, draining in-flight requests for up to %v", timeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	shutdownErrs := make([]error, len(servers))
+	for i, srv := range servers {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			shutdownErrs[i] = srv.Shutdown(shutdownCtx)
+		}(i, srv)
+	}
+	wg.Wait()
+
+	if serveErr != nil {
+		return serveErr
+	}
+	if err := errors.Join(shutdownErrs...); err != nil {
+		return err
+	}
+
+	for range servers {
+		if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ShuttingDown returns a channel that is closed once shutdown begins
+func (s *Service) ShuttingDown() <-chan struct{} {
+	return s.shutdownCh
+}
+
+func (s *Service) beginShutdown() {
+	s.shutdownOnce.Do(func() {
+		close(s.shutdownCh)
+	})
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServe_DrainsInFlightRequest(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ShutdownTimeout = 2 * time.Second
+	service := NewServiceWithConfig(cfg)
+
+	// Slow Kraken keeps the LTP request in flight while shutdown starts
+	started := make(chan struct{})
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["45000.00","0.5"]}}}`))
+	}))
+	defer mockServer.Close()
+
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- service.serve(ctx, boundListener{name: "public", ln: ln, handler: service.routes()})
+	}()
+
+	respCh := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/api/v1/ltp?pair=BTC/USD")
+		if err != nil {
+			t.Errorf("In-flight request failed: %v", err)
+			respCh <- nil
+			return
+		}
+		respCh <- resp
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case <-service.ShuttingDown():
+	case <-time.After(time.Second):
+		t.Error("Expected shutdown signal to be broadcast")
+	}
+
+	resp := <-respCh
+	if resp != nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", resp.StatusCode)
+		}
+	}
+
+	if err := <-serveErr; err != nil {
+		t.Errorf("Expected clean shutdown, got %v", err)
+	}
+}
+
+func TestServe_RejectsRequestsAfterSignal(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ShutdownTimeout = 2 * time.Second
+	cfg.ShutdownDelay = 500 * time.Millisecond
+	service := NewServiceWithConfig(cfg)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- service.serve(ctx, boundListener{name: "public", ln: ln, handler: service.routes()})
+	}()
+
+	cancel()
+	select {
+	case <-service.ShuttingDown():
+	case <-time.After(time.Second):
+		t.Fatal("Expected shutdown signal to be broadcast")
+	}
+
+	// A request arriving after the signal, while the listener is still open
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET /health HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", resp.StatusCode)
+	}
+	if !resp.Close {
+		t.Errorf("Expected Connection: close, got %q", resp.Header.Get("Connection"))
+	}
+
+	if err := <-serveErr; err != nil {
+		t.Errorf("Expected clean shutdown, got %v", err)
+	}
+}
+
+func TestHealthListener_Dedicated(t *testing.T) {
+	service := NewService()
+
+	publicLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	healthLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- service.serve(ctx,
+			boundListener{name: "public", ln: publicLn, handler: service.routes()},
+			boundListener{name: "health", ln: healthLn, handler: service.healthRoutes()},
+		)
+	}()
+	defer func() {
+		cancel()
+		if err := <-serveErr; err != nil {
+			t.Errorf("Expected clean shutdown, got %v", err)
+		}
+	}()
+
+	get := func(ln net.Listener, path string) int {
+		resp, err := http.Get("http://" + ln.Addr().String() + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := get(healthLn, "/health"); status != http.StatusOK {
+		t.Errorf("Expected /health on the health listener to return 200, got %d", status)
+	}
+	if status := get(healthLn, "/api/v1/ltp"); status != http.StatusNotFound {
+		t.Errorf("Expected the API to be absent from the health listener, got %d", status)
+	}
+	if status := get(publicLn, "/health"); status != http.StatusOK {
+		t.Errorf("Expected /health to stay on the public listener, got %d", status)
+	}
+}
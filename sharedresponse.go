@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A fully rendered response that can be replayed to several clients
+type sharedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// responseRecorder buffers a response instead of sending it
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header)}
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(p)
+}
+
+func (r *responseRecorder) response() sharedResponse {
+	status := r.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return sharedResponse{status: status, header: r.header, body: r.body.Bytes()}
+}
+
+// responseGroup runs one computation per key at a time and hands its
+// response to every caller that asked for the same key meanwhile
+type responseGroup struct {
+	mu    sync.Mutex
+	calls map[string]*responseCall
+}
+
+type responseCall struct {
+	done     chan struct{}
+	response sharedResponse
+}
+
+// Run render for key unless a call for the same key is already running, in
+// which case wait for it and return its response. shared reports whether
+// the response came from another caller's computation. If render panics,
+// the callers waiting on it get a 500 and the panic carries on in the
+// caller that ran it.
+func (g *responseGroup) do(key string, render func() sharedResponse) (response sharedResponse, shared bool) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-call.done
+		return call.response, true
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*responseCall)
+	}
+	call := &responseCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			call.response = sharedResponse{
+				status: http.StatusInternalServerError,
+				header: http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+				body:   []byte(http.StatusText(http.StatusInternalServerError) + "\n"),
+			}
+		}
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+
+		if recovered != nil {
+			panic(recovered)
+		}
+	}()
+
+	call.response = render()
+	return call.response, false
+}
+
+// Key identifying requests that produce the same response: the API version
+// and the query, with pair lists and include flags normalized
+func sharedResponseKey(r *http.Request) string {
+	query := url.Values{}
+	for name, values := range r.URL.Query() {
+		query[name] = append([]string(nil), values...)
+	}
+
+	for _, name := range []string{"pair", "pairs", "bases", "quotes"} {
+		for i, value := range query[name] {
+			items := strings.Split(value, ",")
+			for j, item := range items {
+				items[j] = normalizePair(item)
+			}
+			query[name][i] = strings.Join(items, ",")
+		}
+	}
+	for i, value := range query["include"] {
+		flags := strings.Split(strings.ToLower(value), ",")
+		for j, flag := range flags {
+			flags[j] = strings.TrimSpace(flag)
+		}
+		sort.Strings(flags)
+		query["include"][i] = strings.Join(flags, ",")
+	}
+
+	return apiVersion(r) + "?" + query.Encode()
+}
+
+// Serve an LTP request, sharing one computation and its response bytes
+// among identical requests that arrive while it's running. The computation
+// serves every waiting client, so it doesn't stop when the client that
+// started it goes away; it's bounded by RESPONSE_BUDGET, if set, instead.
+func (s *Service) serveSharedLTP(w http.ResponseWriter, r *http.Request) {
+	response, _ := s.ltpResponses.do(sharedResponseKey(r), func() sharedResponse {
+		ctx := context.WithoutCancel(r.Context())
+		if budget := s.cfg().ResponseBudget; budget > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, budget)
+			defer cancel()
+		}
+
+		rec := newResponseRecorder()
+		s.serveLTP(rec, r.WithContext(ctx))
+		return rec.response()
+	})
+
+	for name, values := range response.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.WriteHeader(response.status)
+	w.Write(response.body)
+}
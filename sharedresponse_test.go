@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedProvider holds every fetch until released, counting calls per pair
+type gatedProvider struct {
+	release chan struct{}
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (p *gatedProvider) Name() string {
+	return "gated"
+}
+
+func (p *gatedProvider) FetchTicker(ctx context.Context, pair string) (Ticker, error) {
+	p.mu.Lock()
+	p.calls[pair]++
+	p.mu.Unlock()
+
+	select {
+	case <-p.release:
+		return Ticker{Last: 45000}, nil
+	case <-ctx.Done():
+		return Ticker{}, ctx.Err()
+	}
+}
+
+func TestHandleLTP_ShareResponses(t *testing.T) {
+	provider := &gatedProvider{release: make(chan struct{}), calls: make(map[string]int)}
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"gated"}
+	cfg.ShareResponses = true
+	service := NewServiceWithConfig(cfg)
+	service.providers = map[string]Provider{"gated": provider}
+
+	// The same request, spelled differently
+	urls := []string{
+		"/api/v1/ltp?pairs=BTC/USD,BTC/EUR&include=spread,source",
+		"/api/v1/ltp?pairs=btc/usd,btc/eur&include=source,spread",
+		"/api/v1/ltp?pairs=BTC/USD,BTC/EUR&include=spread,source",
+		"/api/v1/ltp?pairs=BTC/USD,%20BTC/EUR&include=SPREAD,source",
+	}
+
+	recs := make([]*httptest.ResponseRecorder, len(urls))
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			service.handleLTP(recs[i], httptest.NewRequest("GET", url, nil))
+		}()
+	}
+
+	// Let every request join the shared computation before upstream answers
+	time.Sleep(50 * time.Millisecond)
+	close(provider.release)
+	wg.Wait()
+
+	for _, pair := range []string{"BTC/USD", "BTC/EUR"} {
+		if calls := provider.calls[pair]; calls != 1 {
+			t.Errorf("Expected %s to be fetched once, got %d", pair, calls)
+		}
+	}
+	for i, rec := range recs {
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200 for request %d, got %d", i, rec.Code)
+		}
+		if rec.Body.String() != recs[0].Body.String() {
+			t.Errorf("Expected identical bodies, got %q and %q", recs[0].Body.String(), rec.Body.String())
+		}
+		if rec.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("Expected the shared Content-Type header, got %q", rec.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestSharedResponseKey(t *testing.T) {
+	key := func(target string) string {
+		return sharedResponseKey(httptest.NewRequest("GET", target, nil))
+	}
+
+	if key("/api/v1/ltp?pair=btc/usd&include=vwap,spread") != key("/api/v1/ltp?include=spread,vwap&pair=BTC/USD") {
+		t.Error("Expected equivalent requests to share a key")
+	}
+	if key("/api/v1/ltp?pair=BTC/USD") == key("/api/v1/ltp?pair=BTC/USD&include=vwap") {
+		t.Error("Expected different include options to get different keys")
+	}
+}
+
+func TestResponseGroup_RenderPanics(t *testing.T) {
+	var group responseGroup
+	release := make(chan struct{})
+
+	leaderPanic := make(chan any, 1)
+	go func() {
+		defer func() { leaderPanic <- recover() }()
+		group.do("key", func() sharedResponse {
+			<-release
+			panic("render failed")
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	waiter := make(chan sharedResponse, 1)
+	go func() {
+		response, _ := group.do("key", func() sharedResponse {
+			t.Error("Expected the waiter to share the running call")
+			return sharedResponse{}
+		})
+		waiter <- response
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if recovered := <-leaderPanic; recovered != "render failed" {
+		t.Errorf("Expected the panic to reach the leader, got %v", recovered)
+	}
+	if response := <-waiter; response.status != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 for the waiter, got %d", response.status)
+	}
+
+	// The failed call doesn't linger
+	response, shared := group.do("key", func() sharedResponse {
+		return sharedResponse{status: http.StatusOK}
+	})
+	if shared || response.status != http.StatusOK {
+		t.Errorf("Expected a fresh call after the panic, got status %d shared %v", response.status, shared)
+	}
+}
+
+func TestHandleLTP_ShareResponsesLeaderCancels(t *testing.T) {
+	provider := &gatedProvider{release: make(chan struct{}), calls: make(map[string]int)}
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"gated"}
+	cfg.ShareResponses = true
+	service := NewServiceWithConfig(cfg)
+	service.providers = map[string]Provider{"gated": provider}
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderDone := make(chan struct{})
+	go func() {
+		defer close(leaderDone)
+		req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil).WithContext(leaderCtx)
+		service.handleLTP(httptest.NewRecorder(), req)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	follower := httptest.NewRecorder()
+	followerDone := make(chan struct{})
+	go func() {
+		defer close(followerDone)
+		service.handleLTP(follower, httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil))
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// The leader's client goes away before upstream answers
+	cancelLeader()
+	time.Sleep(20 * time.Millisecond)
+	close(provider.release)
+	<-leaderDone
+	<-followerDone
+
+	if calls := provider.calls["BTC/USD"]; calls != 1 {
+		t.Errorf("Expected BTC/USD to be fetched once, got %d", calls)
+	}
+	if follower.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for the follower, got %d: %s", follower.Code, follower.Body.String())
+	}
+	if !strings.Contains(follower.Body.String(), `"amount":45000`) {
+		t.Errorf("Expected the follower to get the price, got %s", follower.Body.String())
+	}
+}
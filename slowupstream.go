@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Weight of the newest call in a provider's smoothed latency
+const latencySmoothing = 0.3
+
+// upstreamLatencies keeps an exponentially smoothed call latency per
+// provider, so one odd call doesn't decide on its own whether upstream is
+// slow. The zero value is ready to use.
+type upstreamLatencies struct {
+	mu        sync.Mutex
+	latencies map[string]time.Duration
+}
+
+// Record folds the latency of a call into the provider's smoothed latency
+func (l *upstreamLatencies) Record(name string, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.latencies == nil {
+		l.latencies = make(map[string]time.Duration)
+	}
+	if previous, ok := l.latencies[name]; ok {
+		latency = previous + time.Duration(latencySmoothing*float64(latency-previous))
+	}
+	l.latencies[name] = latency
+}
+
+// Latency returns the provider's smoothed latency, if it has been called
+func (l *upstreamLatencies) Latency(name string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	latency, ok := l.latencies[name]
+	return latency, ok
+}
+
+// How long a fetch of the pair is expected to take, judging by the smoothed
+// latency of the providers it would go to: the pinned provider, the first
+// provider in order that isn't cooling down, or in aggregate mode the
+// slowest of them
+func (s *Service) expectedLatency(pair string) time.Duration {
+	cfg := s.cfg()
+	names := cfg.Providers
+	if name, pinned := cfg.ProviderPins[pair]; pinned {
+		names = []string{name}
+	}
+
+	var expected time.Duration
+	for _, name := range names {
+		if s.providerHealth.CoolingDown(name) {
+			continue
+		}
+		latency, _ := s.upstreamLatency.Latency(name)
+		if cfg.ProviderMode != providerModeAggregate {
+			return latency
+		}
+		expected = max(expected, latency)
+	}
+	return expected
+}
+
+// With STALE_WHILE_SLOW, answer a request whose pairs are all cached but
+// expired from those entries at once when the providers they'd be fetched
+// from are slow, instead of blocking on any fetch. Every pair is refreshed in the background so a
+// later request finds it fresh. Reports false, leaving the request to the
+// normal path, when any pair is fresh, missing or too old to serve past
+// SYNC_REFRESH_AGE.
+func (s *Service) serveStaleWhileSlow(ctx context.Context, pairs []string, include IncludeOptions) ([]PairLTP, bool) {
+	threshold := s.cfg().StaleWhileSlow
+	if threshold <= 0 || providerOverride(ctx) != "" {
+		return nil, false
+	}
+
+	// Expired entries are only served in place of fetches when the
+	// fallback order allows both
+	order := s.cache.FallbackOrder()
+	if !slices.Contains(order, fallbackLive) || !slices.Contains(order, fallbackStale) {
+		return nil, false
+	}
+
+	var slowest time.Duration
+	entries := make([]CacheEntry, len(pairs))
+	for i, pair := range pairs {
+		pair = normalizePair(pair)
+		entry, fresh := s.cache.fresh(pair)
+		if fresh || !s.cache.refreshableAsync(entry) {
+			return nil, false
+		}
+		entries[i] = entry
+		slowest = max(slowest, s.expectedLatency(pair))
+	}
+	if slowest <= threshold {
+		return nil, false
+	}
+
+	log.Printf("Upstream slow (expected %v), serving %d expired pairs and refreshing them in the background",
+		slowest, len(pairs))
+
+	// The refreshes outlive the request that started them
+	fetchCtx := context.WithoutCancel(ctx)
+	result := make([]PairLTP, len(pairs))
+	for i, pair := range pairs {
+		pair = normalizePair(pair)
+		s.cache.RefreshInBackground(pair, func() (Ticker, error) {
+			return s.fetchTicker(fetchCtx, pair)
+		})
+		result[i] = s.pairLTP(pair, entries[i], cacheStale, include)
+	}
+	return result, true
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Provider that answers every pair after a delay with the current price
+type delayedProvider struct {
+	delay time.Duration
+	price atomic.Int64
+}
+
+func (p *delayedProvider) Name() string {
+	return "delayed"
+}
+
+func (p *delayedProvider) FetchTicker(ctx context.Context, pair string) (Ticker, error) {
+	select {
+	case <-time.After(p.delay):
+		return Ticker{Last: float64(p.price.Load())}, nil
+	case <-ctx.Done():
+		return Ticker{}, ctx.Err()
+	}
+}
+
+func TestHandleLTP_StaleWhileSlow(t *testing.T) {
+	provider := &delayedProvider{delay: 200 * time.Millisecond}
+	provider.price.Store(45000)
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"delayed"}
+	cfg.CacheTTL = 50 * time.Millisecond
+	cfg.StaleWhileSlow = 100 * time.Millisecond
+	service := NewServiceWithConfig(cfg)
+	service.providers = map[string]Provider{"delayed": provider}
+
+	// Populate the cache; the slow fetches mark upstream as slow
+	if _, err := service.getLTP(context.Background(), []string{"BTC/USD", "BTC/EUR"}, IncludeOptions{}); err != nil {
+		t.Fatalf("getLTP failed: %v", err)
+	}
+	time.Sleep(2 * cfg.CacheTTL)
+	provider.price.Store(46000)
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pairs=BTC/USD,BTC/EUR", nil)
+	rec := httptest.NewRecorder()
+
+	start := time.Now()
+	service.handleLTP(rec, req)
+	if elapsed := time.Since(start); elapsed > provider.delay/2 {
+		t.Errorf("Expected an immediate response, took %v", elapsed)
+	}
+
+	if rec.Header().Get("X-Cache-Status") != cacheStale {
+		t.Errorf("Expected X-Cache-Status stale, got %s", rec.Header().Get("X-Cache-Status"))
+	}
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.LTP) != 2 {
+		t.Fatalf("Expected 2 pairs, got %d", len(response.LTP))
+	}
+	for _, ltp := range response.LTP {
+		if !ltp.Stale || ltp.Amount.Value != 45000 {
+			t.Errorf("Expected stale 45000 for %s, got %+v", ltp.Pair, ltp)
+		}
+	}
+
+	// Both pairs are refreshed in the background
+	deadline := time.Now().Add(2 * time.Second)
+	for _, pair := range []string{"BTC/USD", "BTC/EUR"} {
+		for {
+			if entry, ok := service.cache.Peek(pair); ok && entry.ticker.Last == 46000 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %s to be refreshed in the background", pair)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestServeStaleWhileSlow_RequiresAllPairsCached(t *testing.T) {
+	provider := &delayedProvider{delay: 0}
+	provider.price.Store(45000)
+
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"delayed"}
+	cfg.StaleWhileSlow = time.Millisecond
+	service := NewServiceWithConfig(cfg)
+	service.providers = map[string]Provider{"delayed": provider}
+	service.upstreamLatency.Record("delayed", time.Second)
+
+	if _, ok := service.serveStaleWhileSlow(context.Background(), []string{"BTC/USD"}, IncludeOptions{}); ok {
+		t.Error("Expected the normal path for an uncached pair")
+	}
+}
+
+func TestServeStaleWhileSlow_OnlyProvidersUsed(t *testing.T) {
+	tests := []struct {
+		name  string
+		pins  map[string]string
+		order []string
+		want  bool
+	}{
+		{"slow provider", nil, nil, true},
+		{"pinned to a fast provider", map[string]string{"BTC/USD": "fast"}, nil, false},
+		{"stale not in fallback order", nil, []string{fallbackCache, fallbackLive}, false},
+	}
+
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		cfg.Providers = []string{"slow", "fast"}
+		cfg.ProviderPins = tt.pins
+		cfg.StaleWhileSlow = 100 * time.Millisecond
+		if tt.order != nil {
+			cfg.FallbackOrder = tt.order
+		}
+		service := NewServiceWithConfig(cfg)
+		service.upstreamLatency.Record("slow", time.Second)
+		service.upstreamLatency.Record("fast", 10*time.Millisecond)
+		service.cache.data["BTC/USD"] = CacheEntry{ticker: Ticker{Last: 45000}, timestamp: time.Now().Add(-time.Minute)}
+
+		if _, ok := service.serveStaleWhileSlow(context.Background(), []string{"BTC/USD"}, IncludeOptions{}); ok != tt.want {
+			t.Errorf("%s: Expected stale-while-slow %v, got %v", tt.name, tt.want, ok)
+		}
+	}
+}
+
+func TestServeStaleWhileSlow_SkipsCoolingDownProvider(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Providers = []string{"slow", "fast"}
+	cfg.StaleWhileSlow = 100 * time.Millisecond
+	service := NewServiceWithConfig(cfg)
+	service.upstreamLatency.Record("slow", time.Second)
+	service.upstreamLatency.Record("fast", 10*time.Millisecond)
+	service.providerHealth = newProviderHealth(1, time.Minute)
+	service.providerHealth.Record("slow", errors.New("down"))
+	service.cache.data["BTC/USD"] = CacheEntry{ticker: Ticker{Last: 45000}, timestamp: time.Now().Add(-time.Minute)}
+
+	// Fetches go to the fast provider while the slow one is skipped
+	if _, ok := service.serveStaleWhileSlow(context.Background(), []string{"BTC/USD"}, IncludeOptions{}); ok {
+		t.Error("Expected the normal path while the slow provider cools down")
+	}
+}
+
+func TestUpstreamLatencies_Smoothed(t *testing.T) {
+	var latencies upstreamLatencies
+	latencies.Record("kraken", 100*time.Millisecond)
+	latencies.Record("kraken", 2*time.Second)
+
+	// One slow call moves the estimate only part of the way
+	latency, ok := latencies.Latency("kraken")
+	if !ok || latency <= 100*time.Millisecond || latency >= time.Second {
+		t.Errorf("Expected a smoothed latency between 100ms and 1s, got %v", latency)
+	}
+	if _, ok := latencies.Latency("coinbase"); ok {
+		t.Error("Expected no latency for a provider never called")
+	}
+}
+
+func TestHandleLTP_SyncRefreshAge(t *testing.T) {
+	tests := []struct {
+		name      string
+		age       time.Duration
+		wantPrice float64
+		wantStale bool
+	}{
+		{"slightly stale", time.Minute, 45000, true},
+		{"very stale", time.Hour, 46000, false},
+	}
+
+	for _, tt := range tests {
+		provider := &delayedProvider{delay: 100 * time.Millisecond}
+		provider.price.Store(46000)
+
+		cfg := DefaultConfig()
+		cfg.Providers = []string{"delayed"}
+		cfg.StaleWhileSlow = time.Millisecond
+		cfg.SyncRefreshAge = 10 * time.Minute
+		service := NewServiceWithConfig(cfg)
+		service.providers = map[string]Provider{"delayed": provider}
+		service.upstreamLatency.Record("delayed", time.Second)
+		service.cache.data["BTC/USD"] = CacheEntry{ticker: Ticker{Last: 45000}, timestamp: time.Now().Add(-tt.age)}
+
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		service.handleLTP(rec, httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil))
+		elapsed := time.Since(start)
+
+		var response LTPResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("%s: Failed to decode response: %v", tt.name, err)
+		}
+		if len(response.LTP) != 1 {
+			t.Fatalf("%s: Expected 1 pair, got %d", tt.name, len(response.LTP))
+		}
+		if ltp := response.LTP[0]; ltp.Amount.Value != tt.wantPrice || ltp.Stale != tt.wantStale {
+			t.Errorf("%s: Expected price %v with stale %v, got %+v", tt.name, tt.wantPrice, tt.wantStale, ltp)
+		}
+		if waited := elapsed >= provider.delay; waited == tt.wantStale {
+			t.Errorf("%s: Expected to wait for the refresh: %v, took %v", tt.name, !tt.wantStale, elapsed)
+		}
+	}
+}
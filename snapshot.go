@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// On-disk representation of a cache entry
+type snapshotEntry struct {
+	Value     float64   `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Write the live cache entries to path. Entries still carrying a previous
+// snapshot's price are left out, so prices never fetched again age out
+// instead of being carried from run to run. The file is replaced atomically
+// so a crash mid-write never leaves a truncated snapshot behind.
+func (c *Cache) SaveSnapshot(path string) error {
+	entries := make(map[string]snapshotEntry)
+	for pair, entry := range c.Entries() {
+		if entry.source != "" {
+			continue
+		}
+		entries[pair] = snapshotEntry{
+			Value:     entry.ticker.Last,
+			Timestamp: entry.timestamp,
+		}
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".snapshot-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load entries from a snapshot written by SaveSnapshot. Loaded entries are
+// marked with the snapshot source until a live fetch replaces them, and
+// never overwrite live data already in the cache.
+func (c *Cache) LoadSnapshot(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var entries map[string]snapshotEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	loaded := 0
+	for pair, entry := range entries {
+		if _, exists := c.data[pair]; exists {
+			continue
+		}
+		c.data[pair] = CacheEntry{
+			ticker:    Ticker{Last: entry.Value},
+			timestamp: entry.Timestamp,
+			source:    sourceSnapshot,
+		}
+		loaded++
+	}
+
+	return loaded, nil
+}
+
+// Periodically persist the cache so the next start has last-known-good
+// prices, until ctx is cancelled
+func (s *Service) runSnapshotWriter(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.cache.SaveSnapshot(path); err != nil {
+				log.Printf("Error saving snapshot: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	cache := NewCache(time.Minute)
+	cache.GetOrFetch("BTC/USD", func() (float64, error) { return 45000.0, nil })
+
+	if err := cache.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	restored := NewCache(time.Minute)
+	count, err := restored.LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+
+	if count != 1 {
+		t.Errorf("Expected 1 loaded entry, got %d", count)
+	}
+
+	entry := restored.data["BTC/USD"]
+	if entry.ticker.Last != 45000.0 || entry.source != sourceSnapshot {
+		t.Errorf("Unexpected restored entry: %+v", entry)
+	}
+}
+
+func TestHandleLTP_ServesSnapshotBeforeFirstFetch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	previous := NewCache(time.Minute)
+	previous.GetOrFetch("BTC/USD", func() (float64, error) { return 44000.0, nil })
+	if err := previous.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	service := NewService()
+	if _, err := service.cache.LoadSnapshot(path); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+
+	// Kraken is down, so no live fetch can succeed yet
+	mockServer := failingKrakenServer()
+	defer mockServer.Close()
+
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp?pair=BTC/USD", nil)
+	rec := httptest.NewRecorder()
+	service.handleLTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var response LTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(response.LTP) != 1 {
+		t.Fatalf("Expected 1 LTP entry, got %d", len(response.LTP))
+	}
+
+	ltp := response.LTP[0]
+	if ltp.Amount.Value != 44000.0 || ltp.Source != sourceSnapshot || !ltp.Stale {
+		t.Errorf("Expected stale snapshot value 44000, got %+v", ltp)
+	}
+}
+
+func TestHandleLTP_SnapshotReplacedByLiveFetch(t *testing.T) {
+	service := NewService()
+	service.cache.data["BTC/USD"] = CacheEntry{
+		ticker:    Ticker{Last: 44000.0},
+		timestamp: time.Now(),
+		source:    sourceSnapshot,
+	}
+
+	mockServer := mockKrakenServer()
+	defer mockServer.Close()
+
+	service.krakenClient = mockServer.Client()
+	service.krakenBaseURL = mockServer.URL
+
+	ltpData, err := service.getLTP(context.Background(), []string{"BTC/USD"}, IncludeOptions{})
+	if err != nil {
+		t.Fatalf("getLTP failed: %v", err)
+	}
+
+	if ltpData[0].Amount.Value != 45000.0 || ltpData[0].Source != "" || ltpData[0].Stale {
+		t.Errorf("Expected live value 45000, got %+v", ltpData[0])
+	}
+}
+
+func TestSaveSnapshot_SkipsSnapshotEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	cache := NewCache(time.Minute)
+	cache.GetOrFetch("BTC/USD", func() (float64, error) { return 45000.0, nil })
+	cache.data["BTC/EUR"] = CacheEntry{ticker: Ticker{Last: 40000}, timestamp: time.Now().Add(-24 * time.Hour), source: sourceSnapshot}
+
+	if err := cache.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	restored := NewCache(time.Minute)
+	if _, err := restored.LoadSnapshot(path); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if _, ok := restored.data["BTC/USD"]; !ok {
+		t.Error("Expected the live entry to be saved")
+	}
+	if _, ok := restored.data["BTC/EUR"]; ok {
+		t.Error("Expected the entry loaded from a previous snapshot not to be saved again")
+	}
+}
+
+func TestRunSnapshotWriter_StopsOnCancel(t *testing.T) {
+	service := NewService()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		service.runSnapshotWriter(ctx, path, time.Millisecond)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the snapshot writer to stop when cancelled")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// PriceStats summarizes a pair's recorded prices within a window
+type PriceStats struct {
+	Pair          string    `json:"pair"`
+	WindowSeconds float64   `json:"window_seconds"`
+	Open          Price     `json:"open"`
+	High          Price     `json:"high"`
+	Low           Price     `json:"low"`
+	Close         Price     `json:"close"`
+	Mean          Price     `json:"mean"`
+	SampleCount   int       `json:"sample_count"`
+	From          Timestamp `json:"from"` // Time of the first sample in the window
+	To            Timestamp `json:"to"`   // Time of the last sample in the window
+}
+
+// Compute open, high, low, close and mean over the samples, oldest first,
+// as prices encoded with the given significant digits. Reports false when
+// there are none.
+func computeStats(samples []Sample, digits int) (PriceStats, bool) {
+	if len(samples) == 0 {
+		return PriceStats{}, false
+	}
+
+	first, last := samples[0], samples[len(samples)-1]
+	high, low, sum := first.Price, first.Price, 0.0
+	for _, sample := range samples {
+		sum += sample.Price
+		high = max(high, sample.Price)
+		low = min(low, sample.Price)
+	}
+
+	return PriceStats{
+		Open:        Price{Value: first.Price, digits: digits},
+		High:        Price{Value: high, digits: digits},
+		Low:         Price{Value: low, digits: digits},
+		Close:       Price{Value: last.Price, digits: digits},
+		Mean:        Price{Value: sum / float64(len(samples)), digits: digits},
+		SampleCount: len(samples),
+		From:        Timestamp{Time: first.Time},
+		To:          Timestamp{Time: last.Time},
+	}, true
+}
+
+// Serve OHLC, mean and sample count of one pair's history over a window
+func (s *Service) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pair := normalizePair(r.URL.Query().Get("pair"))
+	if pair == "" {
+		http.Error(w, "Missing pair", http.StatusBadRequest)
+		return
+	}
+	if !s.isPairServed(pair) {
+		http.Error(w, fmt.Sprintf("Pair not served: %s", pair), http.StatusBadRequest)
+		return
+	}
+
+	window := defaultRangeWindow
+	if windowParam := r.URL.Query().Get("window"); windowParam != "" {
+		parsed, err := time.ParseDuration(windowParam)
+		if err != nil || parsed <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid window: %s", windowParam), http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+
+	stats, ok := computeStats(s.history.Samples(pair, s.cache.Now().Add(-window)), s.cfg().SignificantDigits)
+	if !ok {
+		http.Error(w, fmt.Sprintf("No samples for %s in the last %v", pair, window), http.StatusNotFound)
+		return
+	}
+	stats.Pair = pair
+	stats.WindowSeconds = window.Seconds()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandleStats(t *testing.T) {
+	service := NewService()
+
+	// The window is measured on the service clock
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	service.cache.now = func() time.Time { return now }
+	// Outside the window, so not part of the stats
+	service.history.Record("BTC/USD", 10, now.Add(-10*time.Minute))
+	for i, price := range []float64{100, 104, 98, 102} {
+		service.history.Record("BTC/USD", price, now.Add(time.Duration(i-4)*time.Second))
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/ltp/stats?pair=btc/usd&window=300s", nil)
+	rec := httptest.NewRecorder()
+	service.handleStats(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var stats PriceStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if stats.Pair != "BTC/USD" || stats.WindowSeconds != 300 {
+		t.Errorf("Unexpected pair or window: %s, %v", stats.Pair, stats.WindowSeconds)
+	}
+	if stats.Open.Value != 100 || stats.High.Value != 104 || stats.Low.Value != 98 || stats.Close.Value != 102 {
+		t.Errorf("Expected OHLC 100/104/98/102, got %v/%v/%v/%v", stats.Open, stats.High, stats.Low, stats.Close)
+	}
+	if stats.Mean.Value != 101 || stats.SampleCount != 4 {
+		t.Errorf("Expected mean 101 over 4 samples, got %v over %d", stats.Mean, stats.SampleCount)
+	}
+}
+
+func TestHandleStats_Errors(t *testing.T) {
+	service := NewService()
+
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{"/api/v1/ltp/stats?pair=BTC/USD", http.StatusNotFound},
+		{"/api/v1/ltp/stats", http.StatusBadRequest},
+		{"/api/v1/ltp/stats?pair=BTC/USD&window=soon", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.url, nil)
+		rec := httptest.NewRecorder()
+		service.handleStats(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.url, tt.status, rec.Code)
+		}
+	}
+}
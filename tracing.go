@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context header propagated by tracing clients and proxies
+const traceparentHeader = "traceparent"
+
+// Store the trace ID of an incoming traceparent header in the request
+// context, so upstream latency observations can link to the trace
+func traceContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := parseTraceparent(r.Header.Get(traceparentHeader)); ok {
+			r = r.WithContext(context.WithValue(r.Context(), traceIDKey, id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Extract the trace ID from a traceparent value of the form
+// version-traceid-parentid-flags, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func parseTraceparent(value string) (string, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", false
+	}
+
+	version, traceID, parentID := parts[0], parts[1], parts[2]
+	if version == "00" && len(parts) != 4 {
+		return "", false
+	}
+	if len(traceID) != 32 || len(parentID) != 16 || !isLowerHex(traceID) || !isLowerHex(parentID) {
+		return "", false
+	}
+	if traceID == strings.Repeat("0", 32) {
+		return "", false
+	}
+	return traceID, true
+}
+
+func isLowerHex(s string) bool {
+	if _, err := hex.DecodeString(s); err != nil {
+		return false
+	}
+	return strings.ToLower(s) == s
+}
+
+// Trace ID of the request the context belongs to, if it was traced
+func traceID(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDKey).(string)
+	return id
+}
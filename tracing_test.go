@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value   string
+		traceID string
+		ok      bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "4bf92f3577b34da6a3ce929d0e0e4736", true},
+		{"", "", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "", false},
+		{"00-4bf92f3577b34da6-00f067aa0ba902b7-01", "", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", false},
+	}
+
+	for _, test := range tests {
+		traceID, ok := parseTraceparent(test.value)
+		if ok != test.ok || traceID != test.traceID {
+			t.Errorf("parseTraceparent(%q) = %q, %v; want %q, %v", test.value, traceID, ok, test.traceID, test.ok)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Backoff between warm-up attempts, doubling up to the maximum
+const (
+	warmupInitialBackoff = 100 * time.Millisecond
+	warmupMaxBackoff     = 5 * time.Second
+)
+
+// Fetch the warm pairs before serving, retrying the ones that fail with
+// backoff until all are cached or the timeout runs out. Startup carries on
+// either way; whatever is still cold is fetched on demand or by the refresher.
+func (s *Service) warmUp(ctx context.Context, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pending := s.warmPairs()
+	backoff := warmupInitialBackoff
+	for attempt := 1; ; attempt++ {
+		var failed []string
+		for _, pair := range pending {
+			if err := s.refreshPair(ctx, pair); err != nil {
+				failed = append(failed, pair)
+				log.Printf("Warm-up attempt %d for %s failed: %v", attempt, pair, err)
+			}
+		}
+		if len(failed) == 0 {
+			log.Printf("Warm-up complete after %d attempt(s)", attempt)
+			return
+		}
+		pending = failed
+
+		if err := sleepContext(ctx, backoff); err != nil {
+			log.Printf("Warm-up gave up after %v with %d pair(s) cold: %v", timeout, len(pending), pending)
+			return
+		}
+		backoff = min(backoff*2, warmupMaxBackoff)
+	}
+}
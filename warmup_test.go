@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWarmUp_RetriesUntilUpstreamRecovers(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Unreachable for the first two attempts
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"c":["45000.00","0.5"]}}}`))
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.KrakenHosts = []string{server.URL}
+	cfg.WarmPairs = []string{"BTC/USD"}
+	service := NewServiceWithConfig(cfg)
+
+	service.warmUp(context.Background(), 5*time.Second)
+
+	entry, ok := service.cache.Peek("BTC/USD")
+	if !ok || entry.ticker.Last != 45000.00 {
+		t.Errorf("Expected BTC/USD warmed at 45000.00, got %v (cached %v)", entry.ticker.Last, ok)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestWarmUp_GivesUpAfterTimeout(t *testing.T) {
+	server := failingKrakenServer()
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.KrakenHosts = []string{server.URL}
+	cfg.WarmPairs = []string{"BTC/USD"}
+	service := NewServiceWithConfig(cfg)
+
+	start := time.Now()
+	service.warmUp(context.Background(), 300*time.Millisecond)
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected warm-up to stop near its timeout, took %v", elapsed)
+	}
+	if _, ok := service.cache.Peek("BTC/USD"); ok {
+		t.Error("Expected BTC/USD to stay cold")
+	}
+}